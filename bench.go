@@ -0,0 +1,452 @@
+package main
+
+import (
+	"1brc-go/solver"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// statsPath is where bench records its runs
+const statsPath = "stat/timestats.csv"
+
+// statsHeader is the schema of statsPath, the first eight columns are the
+// ones of the rows recorded by hand before bench existed
+var statsHeader = []string{
+	"timestamp", "version", "input", "exec_count", "avg_exec_time", "min_exec_time", "max_exec_time", "exec_times",
+	"git_commit", "gomaxprocs", "buffer_size", "workers", "alloc_mb", "peak_rss_mb",
+}
+
+// legacyColumns is the number of columns of the rows recorded by hand
+const legacyColumns = 8
+
+const statsTimeLayout = "2006-01-02 15:04:05"
+
+// benchRecord is one row of statsPath, the times are in seconds. The rows
+// recorded by hand leave everything after Times empty.
+type benchRecord struct {
+	Timestamp  time.Time
+	Version    string
+	Input      string
+	Times      []float64
+	Commit     string
+	MaxProcs   int
+	BufferSize int
+	Workers    int
+	AllocMB    float64
+	PeakRSSMB  float64
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset: small, mid, full (recorded as large)")
+	in := fs.String("in", "", "input path, overrides the dataset path")
+	impl := fs.String("impl", "base", "registered solver to run")
+	version := fs.String("version", "", "version recorded for the runs, defaults to the solver name with its workers, e.g. iter_07_p50")
+	runs := fs.Int("runs", 5, "number of measured runs")
+	warmup := fs.Int("warmup", 1, "number of runs before the measured ones, not recorded")
+	numWorkers := fs.Int("workers", 0, "number of workers, 0 uses the solver default")
+	var buffer byteSize
+	fs.Var(&buffer, "buffer", "read buffer size, e.g. 4MiB or 512KiB, 0 uses the solver default")
+	knobs := fs.String("knobs", "", "solver specific knobs, comma separated, e.g. section=4194304 for iter_10")
+	path := fs.String("stats", statsPath, "CSV file the runs are appended to")
+	reportOnly := fs.Bool("report", false, "only print the comparison of the versions recorded for the input")
+	versions := fs.String("versions", "", "comma separated versions to compare, in this order, defaults to all recorded for the input")
+	baseline := fs.String("baseline", "", "version the others are compared with, defaults to the first one")
+	fs.Parse(args)
+
+	inputPath, _ := resolveFileSize(*size)
+	inputName := benchInputName(*size)
+	if *in != "" {
+		inputPath, inputName = *in, *in
+	}
+
+	if !*reportOnly {
+		if *runs < 1 {
+			return fmt.Errorf("invalid number of runs: %d", *runs)
+		}
+
+		s, err := solver.New(*impl, solver.Options{BufferSize: int(buffer), Workers: *numWorkers, Knobs: *knobs})
+		if err != nil {
+			return err
+		}
+		if *version == "" {
+			*version = measureLabel(s)
+		}
+
+		record, err := benchSolver(s, *version, inputPath, *warmup, *runs)
+		if err != nil {
+			return err
+		}
+		record.Input = inputName
+
+		if err := appendBenchRecord(*path, record); err != nil {
+			return err
+		}
+		fmt.Printf("➜ [%-15s] %d runs recorded in %s\n", *version, *runs, *path)
+	}
+
+	records, err := readBenchRecords(*path)
+	if err != nil {
+		return err
+	}
+
+	var selected []string
+	if *versions != "" {
+		selected = strings.Split(*versions, ",")
+	}
+	summaries := summarizeBench(records, inputName, selected)
+	if len(summaries) == 0 {
+		return fmt.Errorf("no runs recorded for input %q in %s", inputName, *path)
+	}
+
+	fmt.Println()
+	return printBenchComparison(os.Stdout, summaries, *baseline)
+}
+
+// benchInputName is the input a dataset is recorded as, the rows of the full
+// dataset are recorded as large
+func benchInputName(size string) string {
+	if size == "full" {
+		return "large"
+	}
+	return size
+}
+
+// benchSolver runs s warmup times, then measures runs runs on inputPath
+func benchSolver(s solver.Solver, version string, inputPath string, warmup int, runs int) (benchRecord, error) {
+	outputPath, err := benchOutput(inputPath)
+	if err != nil {
+		return benchRecord{}, err
+	}
+	defer os.Remove(outputPath)
+
+	ctx := context.Background()
+	for i := range warmup {
+		if err := s.Run(ctx, inputPath, outputPath); err != nil {
+			return benchRecord{}, fmt.Errorf("warm-up run %d failed: %w", i+1, err)
+		}
+	}
+
+	record := benchRecord{
+		Timestamp:  time.Now(),
+		Version:    version,
+		Commit:     gitCommit(),
+		MaxProcs:   runtime.GOMAXPROCS(0),
+		BufferSize: s.Options().BufferSize,
+		Workers:    s.Options().Workers,
+	}
+
+	var allocMB float64
+	for range runs {
+		var err error
+		measurement, _ := Measure(version, 0, func() {
+			err = s.Run(ctx, inputPath, outputPath)
+		})
+		if err != nil {
+			return benchRecord{}, err
+		}
+		record.Times = append(record.Times, measurement.Elapsed.Seconds())
+		allocMB += measurement.AllocMB
+	}
+
+	record.AllocMB = allocMB / float64(runs)
+	record.PeakRSSMB = peakRSSMB()
+	return record, nil
+}
+
+// benchOutput checks that the input exists and creates the temporary file the
+// measured runs write to, the results are not looked at, only the time it took
+// to write them
+func benchOutput(inputPath string) (string, error) {
+	if _, err := os.Stat(inputPath); err != nil {
+		return "", fmt.Errorf("input not available, run 'task generate' first: %w", err)
+	}
+
+	outputFile, err := os.CreateTemp("", "1brc-bench-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary output: %w", err)
+	}
+	outputFile.Close()
+	return outputFile.Name(), nil
+}
+
+// gitCommit is the short hash of HEAD with -dirty when tracked files are
+// modified, empty outside of a git checkout
+func gitCommit() string {
+	commit, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+
+	hash := strings.TrimSpace(string(commit))
+	if status, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output(); err == nil && len(bytes.TrimSpace(status)) > 0 {
+		hash += "-dirty"
+	}
+	return hash
+}
+
+// peakRSSMB is the peak resident set size of the process so far, warm-up
+// runs included
+func peakRSSMB() float64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+
+	// linux reports kilobytes, macOS bytes
+	maxRSS := float64(usage.Maxrss) * 1024
+	if runtime.GOOS == "darwin" {
+		maxRSS = float64(usage.Maxrss)
+	}
+	return maxRSS / 1024 / 1024
+}
+
+func (r benchRecord) row() []string {
+	row := []string{
+		r.Timestamp.Format(statsTimeLayout),
+		r.Version,
+		r.Input,
+		strconv.Itoa(len(r.Times)),
+		fmt.Sprintf("%.3f", mean(r.Times)),
+		fmt.Sprintf("%.3f", slices.Min(r.Times)),
+		fmt.Sprintf("%.3f", slices.Max(r.Times)),
+		fmt.Sprint(r.Times),
+	}
+	return append(row,
+		r.Commit,
+		strconv.Itoa(r.MaxProcs),
+		strconv.Itoa(r.BufferSize),
+		strconv.Itoa(r.Workers),
+		fmt.Sprintf("%.2f", r.AllocMB),
+		fmt.Sprintf("%.2f", r.PeakRSSMB),
+	)
+}
+
+// parseBenchRecord parses a row of statsPath, the times are taken from
+// exec_times, the aggregates are derived from them
+func parseBenchRecord(row []string) (benchRecord, error) {
+	var record benchRecord
+	if len(row) < legacyColumns {
+		return record, fmt.Errorf("expected at least %d columns, got %d", legacyColumns, len(row))
+	}
+
+	timestamp, err := time.ParseInLocation(statsTimeLayout, row[0], time.Local)
+	if err != nil {
+		return record, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	record.Timestamp, record.Version, record.Input = timestamp, row[1], row[2]
+
+	for _, field := range strings.Fields(strings.Trim(row[7], "[]")) {
+		seconds, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return record, fmt.Errorf("invalid exec time %q: %w", field, err)
+		}
+		record.Times = append(record.Times, seconds)
+	}
+	if len(record.Times) == 0 {
+		return record, errors.New("no exec times")
+	}
+
+	if len(row) < len(statsHeader) {
+		return record, nil
+	}
+	record.Commit = row[8]
+	for i, field := range []*int{&record.MaxProcs, &record.BufferSize, &record.Workers} {
+		if *field, err = strconv.Atoi(row[9+i]); err != nil {
+			return record, fmt.Errorf("invalid %s: %w", statsHeader[9+i], err)
+		}
+	}
+	for i, field := range []*float64{&record.AllocMB, &record.PeakRSSMB} {
+		if *field, err = strconv.ParseFloat(row[12+i], 64); err != nil {
+			return record, fmt.Errorf("invalid %s: %w", statsHeader[12+i], err)
+		}
+	}
+	return record, nil
+}
+
+// appendBenchRecord appends record to the CSV at path, creating it with the
+// header. A file still having the header of the rows recorded by hand gets
+// the new one, its rows are left as they are.
+func appendBenchRecord(path string, record benchRecord) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	header := strings.Join(statsHeader, ",")
+	firstLine, rest, _ := strings.Cut(string(data), "\n")
+	firstLine = strings.TrimSuffix(firstLine, "\r")
+
+	switch {
+	case len(data) == 0:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create stats directory: %w", err)
+		}
+		data = []byte(header + "\n")
+	case firstLine == strings.Join(statsHeader[:legacyColumns], ","):
+		data = []byte(header + "\n" + rest)
+	case firstLine != header:
+		return fmt.Errorf("unexpected header in %s: %s", path, firstLine)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(record.row())
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to format record: %w", err)
+	}
+
+	// rewritten as a whole so a failed write cannot leave half a row behind
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, buf.Bytes()...), 0666); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func readBenchRecords(path string) ([]benchRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// the rows recorded by hand have fewer columns
+	reader.FieldsPerRecord = -1
+
+	var records []benchRecord
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if line == 1 {
+			continue
+		}
+
+		record, err := parseBenchRecord(row)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// benchSummary combines every run of one version on one input
+type benchSummary struct {
+	version string
+	runs    int
+	min     float64
+	median  float64
+	mean    float64
+	commit  string
+}
+
+// summarizeBench summarizes the runs on input per version, in the order of
+// versions or of their first record when versions is empty
+func summarizeBench(records []benchRecord, input string, versions []string) []benchSummary {
+	times := make(map[string][]float64)
+	commits := make(map[string]string)
+	var order []string
+
+	for _, record := range records {
+		if record.Input != input {
+			continue
+		}
+		if _, seen := times[record.Version]; !seen {
+			order = append(order, record.Version)
+		}
+		times[record.Version] = append(times[record.Version], record.Times...)
+		if record.Commit != "" {
+			commits[record.Version] = record.Commit
+		}
+	}
+	if len(versions) > 0 {
+		order = versions
+	}
+
+	var summaries []benchSummary
+	for _, version := range order {
+		versionTimes := times[version]
+		if len(versionTimes) == 0 {
+			continue
+		}
+		summaries = append(summaries, benchSummary{
+			version: version,
+			runs:    len(versionTimes),
+			min:     slices.Min(versionTimes),
+			median:  median(versionTimes),
+			mean:    mean(versionTimes),
+			commit:  commits[version],
+		})
+	}
+	return summaries
+}
+
+// printBenchComparison writes the summaries as a markdown table, the change
+// is the difference of the medians to the baseline
+func printBenchComparison(w io.Writer, summaries []benchSummary, baseline string) error {
+	base := summaries[0]
+	if baseline != "" {
+		i := slices.IndexFunc(summaries, func(s benchSummary) bool { return s.version == baseline })
+		if i == -1 {
+			return fmt.Errorf("no runs recorded for baseline %q", baseline)
+		}
+		base = summaries[i]
+	}
+
+	fmt.Fprintf(w, "| version | runs | min | median | mean | commit | vs %s |\n", base.version)
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---|---:|")
+	for _, s := range summaries {
+		change := "-"
+		if s.version != base.version {
+			change = fmt.Sprintf("%+.1f%%", 100*(s.median-base.median)/base.median)
+		}
+		fmt.Fprintf(w, "| %s | %d | %.3fs | %.3fs | %.3fs | %s | %s |\n", s.version, s.runs, s.min, s.median, s.mean, s.commit, change)
+	}
+	return nil
+}
+
+func mean(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Sorted(slices.Values(values))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBenchRecord_LegacyRowRoundTrip(t *testing.T) {
+	line := "2024-04-01 20:15:39,v2,large,5,14.877,14.607,15.389,[15.389157833 14.861671708 14.748635833 14.778699875000001 14.607268959]"
+
+	record, err := parseBenchRecord(strings.Split(line, ","))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Version != "v2" || record.Input != "large" || len(record.Times) != 5 || record.Commit != "" {
+		t.Errorf("got %+v", record)
+	}
+
+	// the columns recorded by hand are reproduced exactly
+	if got := strings.Join(record.row()[:legacyColumns], ","); got != line {
+		t.Errorf("got  %s\nwant %s", got, line)
+	}
+}
+
+func TestBenchInputName(t *testing.T) {
+	tests := map[string]string{
+		"small": "small",
+		"mid":   "mid",
+		"full":  "large",
+	}
+	for size, want := range tests {
+		if got := benchInputName(size); got != want {
+			t.Errorf("benchInputName(%q) = %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestRunBench_ReportsFullAsLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timestats.csv")
+	legacy := "2024-04-01 20:15:39,v2,large,1,14.877,14.877,14.877,[14.877]"
+	os.WriteFile(path, []byte(strings.Join(statsHeader[:legacyColumns], ",")+"\n"+legacy+"\n"), 0666)
+
+	if err := runBench([]string{"-f", "full", "-report", "-stats", path}); err != nil {
+		t.Errorf("expected the large rows for -f full, got %v", err)
+	}
+	if err := runBench([]string{"-f", "mid", "-report", "-stats", path}); err == nil {
+		t.Errorf("expected an error for an input without runs")
+	}
+}
+
+func TestAppendBenchRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat", "timestats.csv")
+	record := benchRecord{
+		Timestamp:  time.Date(2024, 5, 27, 12, 0, 0, 0, time.Local),
+		Version:    "iter_10",
+		Input:      "mid",
+		Times:      []float64{0.25, 0.2, 0.3},
+		Commit:     "54e15cd",
+		MaxProcs:   8,
+		BufferSize: 10485760,
+		AllocMB:    1.16,
+		PeakRSSMB:  42.5,
+	}
+
+	if err := appendBenchRecord(path, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(path)
+	want := strings.Join(statsHeader, ",") + "\n" +
+		"2024-05-27 12:00:00,iter_10,mid,3,0.250,0.200,0.300,[0.25 0.2 0.3],54e15cd,8,10485760,0,1.16,42.50\n"
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	records, err := readBenchRecords(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Commit != "54e15cd" || records[0].PeakRSSMB != 42.5 || records[0].BufferSize != 10485760 {
+		t.Errorf("got %+v", records)
+	}
+}
+
+func TestAppendBenchRecord_UpgradesLegacyHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timestats.csv")
+	legacy := "2024-04-01 20:12:45,v2,mid,2,0.160,0.153,0.170,[0.17 0.15]"
+	os.WriteFile(path, []byte(strings.Join(statsHeader[:legacyColumns], ",")+"\n"+legacy+"\n"), 0666)
+
+	record := benchRecord{Timestamp: time.Now(), Version: "iter_10", Input: "mid", Times: []float64{0.1}}
+	if err := appendBenchRecord(path, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(statsHeader, ",") || lines[1] != legacy {
+		t.Errorf("expected the new header and the legacy row untouched, got\n%s", got)
+	}
+
+	records, err := readBenchRecords(path)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("got %d records, %v", len(records), err)
+	}
+}
+
+func TestAppendBenchRecord_UnexpectedHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timestats.csv")
+	os.WriteFile(path, []byte("a,b,c\n"), 0666)
+
+	err := appendBenchRecord(path, benchRecord{Times: []float64{0.1}})
+	if err == nil || !strings.Contains(err.Error(), "unexpected header") {
+		t.Errorf("expected an error for a foreign CSV, got %v", err)
+	}
+}
+
+func TestBenchComparison(t *testing.T) {
+	records := []benchRecord{
+		{Version: "v2", Input: "mid", Times: []float64{0.2, 0.4, 0.3}},
+		{Version: "iter_10", Input: "mid", Times: []float64{0.1, 0.2}, Commit: "54e15cd"},
+		{Version: "iter_10", Input: "full", Times: []float64{9}},
+		{Version: "v2", Input: "mid", Times: []float64{0.1}},
+	}
+
+	summaries := summarizeBench(records, "mid", nil)
+	if len(summaries) != 2 || summaries[0].version != "v2" || summaries[0].runs != 4 || summaries[0].median != 0.25 {
+		t.Fatalf("got %+v", summaries)
+	}
+
+	var buf bytes.Buffer
+	if err := printBenchComparison(&buf, summaries, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "| version | runs | min | median | mean | commit | vs v2 |\n" +
+		"|---|---:|---:|---:|---:|---|---:|\n" +
+		"| v2 | 4 | 0.100s | 0.250s | 0.250s |  | - |\n" +
+		"| iter_10 | 2 | 0.100s | 0.150s | 0.150s | 54e15cd | -40.0% |\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if err := printBenchComparison(&buf, summaries, "v3"); err == nil {
+		t.Errorf("expected an error for a baseline without runs")
+	}
+	if got := summarizeBench(records, "mid", []string{"iter_10", "v9"}); len(got) != 1 || got[0].version != "iter_10" {
+		t.Errorf("got %+v, want only iter_10", got)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"1brc-go/solver"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// comparison is the outcome of the interleaved runs of two solvers
+type comparison struct {
+	base, candidate string
+	// wall times in seconds, one per round
+	baseTimes, candidateTimes []float64
+}
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset: small, mid, full")
+	in := fs.String("in", "", "input path, overrides the dataset path")
+	base := fs.String("base", "", "registered solver the candidate is compared with")
+	candidate := fs.String("candidate", "", "registered solver that should not be slower")
+	rounds := fs.Int("rounds", 10, "number of rounds, every round runs both solvers once")
+	warmup := fs.Int("warmup", 1, "number of unmeasured runs of both solvers before the rounds")
+	numWorkers := fs.Int("workers", 0, "number of workers for both solvers, 0 uses the solver defaults")
+	var buffer byteSize
+	fs.Var(&buffer, "buffer", "read buffer size for both solvers, e.g. 4MiB, 0 uses the solver defaults")
+	baseKnobs := fs.String("base-knobs", "", "solver specific knobs of the base, e.g. section=4194304")
+	candidateKnobs := fs.String("candidate-knobs", "", "solver specific knobs of the candidate")
+	threshold := fs.Float64("threshold", 2, "slowdown of the median in percent tolerated before failing")
+	alpha := fs.Float64("alpha", 0.05, "significance level of the Mann-Whitney test, also sets the confidence of the intervals")
+	fs.Parse(args)
+
+	if *base == "" || *candidate == "" {
+		return fmt.Errorf("both -base and -candidate are required")
+	}
+	if *rounds < 2 {
+		return fmt.Errorf("invalid number of rounds: %d, at least 2 are needed", *rounds)
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return fmt.Errorf("invalid significance level: %v", *alpha)
+	}
+
+	inputPath, _ := resolveFileSize(*size)
+	if *in != "" {
+		inputPath = *in
+	}
+
+	baseSolver, err := solver.New(*base, solver.Options{BufferSize: int(buffer), Workers: *numWorkers, Knobs: *baseKnobs})
+	if err != nil {
+		return err
+	}
+	candidateSolver, err := solver.New(*candidate, solver.Options{BufferSize: int(buffer), Workers: *numWorkers, Knobs: *candidateKnobs})
+	if err != nil {
+		return err
+	}
+
+	c := comparison{base: measureLabel(baseSolver), candidate: measureLabel(candidateSolver)}
+	if c.base == c.candidate {
+		c.base, c.candidate = "base", "candidate"
+	}
+	if err := c.run(baseSolver, candidateSolver, inputPath, *warmup, *rounds); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	return c.report(os.Stdout, *threshold, *alpha)
+}
+
+// run measures both solvers once per round. The order alternates between the
+// rounds, so a drift of the machine (thermal throttling, page cache, a
+// neighbour) hits both solvers alike instead of always the second one.
+func (c *comparison) run(base, candidate solver.Solver, inputPath string, warmup int, rounds int) error {
+	outputPath, err := benchOutput(inputPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(outputPath)
+
+	ctx := context.Background()
+	for i := range warmup {
+		for _, s := range []solver.Solver{base, candidate} {
+			if err := s.Run(ctx, inputPath, outputPath); err != nil {
+				return fmt.Errorf("warm-up run %d of %s failed: %w", i+1, s.Name(), err)
+			}
+		}
+	}
+
+	type contender struct {
+		label  string
+		solver solver.Solver
+		times  *[]float64
+	}
+	contenders := []contender{{c.base, base, &c.baseTimes}, {c.candidate, candidate, &c.candidateTimes}}
+
+	for round := range rounds {
+		for i := range contenders {
+			contender := contenders[(i+round)%len(contenders)]
+			var err error
+			measurement, _ := Measure(contender.label, 0, func() {
+				err = contender.solver.Run(ctx, inputPath, outputPath)
+			})
+			if err != nil {
+				return fmt.Errorf("round %d of %s failed: %w", round+1, contender.label, err)
+			}
+			*contender.times = append(*contender.times, measurement.Elapsed.Seconds())
+		}
+	}
+	return nil
+}
+
+// report prints the medians with their confidence intervals and the result of
+// the Mann-Whitney test. It returns an error when the candidate is slower than
+// the base by more than threshold percent and the test finds the difference
+// significant at alpha.
+func (c comparison) report(w io.Writer, threshold float64, alpha float64) error {
+	confidence := 100 * (1 - alpha)
+	fmt.Fprintf(w, "| version | runs | min | median | %.0f%% CI of the median | max |\n", confidence)
+	fmt.Fprintf(w, "|---|---:|---:|---:|---|---:|\n")
+	for _, row := range []struct {
+		label string
+		times []float64
+	}{{c.base, c.baseTimes}, {c.candidate, c.candidateTimes}} {
+		low, high := medianCI(row.times, alpha)
+		fmt.Fprintf(w, "| %s | %d | %.3fs | %.3fs | %.3fs – %.3fs | %.3fs |\n",
+			row.label, len(row.times), slices.Min(row.times), median(row.times), low, high, slices.Max(row.times))
+	}
+
+	baseMedian, candidateMedian := median(c.baseTimes), median(c.candidateTimes)
+	change := (candidateMedian - baseMedian) / baseMedian * 100
+	u, p := mannWhitney(c.candidateTimes, c.baseTimes)
+
+	verdict := "no significant difference"
+	switch {
+	case p < alpha && change > 0:
+		verdict = "slower"
+	case p < alpha && change < 0:
+		verdict = "faster"
+	}
+	fmt.Fprintf(w, "\n➜ %s vs %s: %+.1f%% median, Mann-Whitney U=%.1f, p=%.4f, %s at alpha %v\n",
+		c.candidate, c.base, change, u, p, verdict, alpha)
+
+	// with few rounds no ordering of the times is significant, so a
+	// regression could never fail the comparison
+	if minP := mannWhitneyMinP(len(c.candidateTimes), len(c.baseTimes)); minP >= alpha {
+		fmt.Fprintf(w, "➜ %d rounds cannot show a difference at alpha %v (the smallest p is %.4f), run more rounds\n",
+			len(c.candidateTimes), alpha, minP)
+	}
+
+	if verdict == "slower" && change > threshold {
+		return fmt.Errorf("%s is %.1f%% slower than %s (p=%.4f), more than the %.1f%% threshold", c.candidate, change, c.base, p, threshold)
+	}
+	return nil
+}
+
+// medianCI is the distribution free confidence interval of the median: the
+// order statistics x(k) and x(n-k+1) for the largest k with
+// P(Binomial(n, 1/2) < k) <= alpha/2. Samples too small for the confidence
+// give the full range.
+func medianCI(values []float64, alpha float64) (float64, float64) {
+	sorted := slices.Sorted(slices.Values(values))
+	n := len(sorted)
+
+	k, cdf, probability := 0, 0.0, math.Pow(0.5, float64(n))
+	for k < n/2 && cdf+probability <= alpha/2 {
+		cdf += probability
+		// P(X = k+1) from P(X = k)
+		probability *= float64(n-k) / float64(k+1)
+		k++
+	}
+	// x(k) is the k-th smallest value, counting from 1
+	if k == 0 {
+		k = 1
+	}
+	return sorted[k-1], sorted[n-k]
+}
+
+// mannWhitney returns the U statistic of x, the number of pairs in which x is
+// larger than y with ties counting half, and the two sided p-value of x and y
+// coming from the same distribution. Without ties and with up to 20 samples a
+// side the p-value is exact, otherwise it comes from the normal approximation
+// with tie and continuity correction.
+func mannWhitney(x, y []float64) (float64, float64) {
+	m, n := len(x), len(y)
+
+	ties := false
+	var u float64
+	for _, a := range x {
+		for _, b := range y {
+			switch {
+			case a > b:
+				u++
+			case a == b:
+				u += 0.5
+				ties = true
+			}
+		}
+	}
+
+	if !ties && m <= 20 && n <= 20 {
+		counts := mannWhitneyCounts(m, n)
+		var total, below, above float64
+		for value, count := range counts {
+			total += count
+			if float64(value) <= u {
+				below += count
+			}
+			if float64(value) >= u {
+				above += count
+			}
+		}
+		return u, min(1, 2*min(below, above)/total)
+	}
+
+	// the variance shrinks with every group of equal values across both samples
+	all := slices.Sorted(slices.Values(append(slices.Clone(x), y...)))
+	var tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j] == all[i] {
+			j++
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+	size := float64(m + n)
+	mean := float64(m*n) / 2
+	variance := float64(m*n) / 12 * (size + 1 - tieTerm/(size*(size-1)))
+	if variance == 0 {
+		return u, 1
+	}
+	z := max(0, math.Abs(u-mean)-0.5) / math.Sqrt(variance)
+	return u, min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// mannWhitneyCounts returns how many of the orderings of m and n distinct
+// values give every U from 0 to m*n. The largest value belongs to one of the
+// samples, if it is in the first it is larger than all n values of the second.
+func mannWhitneyCounts(m, n int) []float64 {
+	// counts[i][j] for i and j values, the zero samples have U=0 only
+	counts := make([][][]float64, m+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n+1)
+		for j := range counts[i] {
+			if i == 0 || j == 0 {
+				counts[i][j] = []float64{1}
+				continue
+			}
+			current := make([]float64, i*j+1)
+			for u, count := range counts[i-1][j] {
+				current[u+j] += count
+			}
+			for u, count := range counts[i][j-1] {
+				current[u] += count
+			}
+			counts[i][j] = current
+		}
+	}
+	return counts[m][n]
+}
+
+// mannWhitneyMinP is the smallest two sided p-value of m and n samples, when
+// one sample is entirely above the other
+func mannWhitneyMinP(m, n int) float64 {
+	// 2 of the C(m+n, m) orderings are the extreme ones
+	orderings := 1.0
+	for i := 1; i <= m; i++ {
+		orderings = orderings * float64(n+i) / float64(i)
+	}
+	return min(1, 2/orderings)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMedianCI(t *testing.T) {
+	values := []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}
+
+	// 10 samples at 95% give the 2nd and the 9th value
+	if low, high := medianCI(values, 0.05); low != 2 || high != 9 {
+		t.Errorf("got %v – %v, want 2 – 9", low, high)
+	}
+	// too few samples for the confidence give the full range
+	if low, high := medianCI([]float64{3, 1, 2}, 0.05); low != 1 || high != 3 {
+		t.Errorf("got %v – %v, want 1 – 3", low, high)
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name  string
+		x, y  []float64
+		wantU float64
+		wantP float64
+	}{
+		// one sample above the other is 2 of the C(8, 4) = 70 orderings
+		{name: "separated", x: []float64{5, 6, 7, 8}, y: []float64{1, 2, 3, 4}, wantU: 16, wantP: 2.0 / 70},
+		{name: "interleaved", x: []float64{1, 4, 5, 8}, y: []float64{2, 3, 6, 7}, wantU: 8, wantP: 1},
+		// ties take the normal approximation
+		{name: "ties", x: []float64{1, 1, 1}, y: []float64{1, 1, 1}, wantU: 4.5, wantP: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, p := mannWhitney(tt.x, tt.y)
+			if u != tt.wantU || math.Abs(p-tt.wantP) > 1e-9 {
+				t.Errorf("got U=%v p=%v, want U=%v p=%v", u, p, tt.wantU, tt.wantP)
+			}
+		})
+	}
+
+	// the exact counts of every U add up to all orderings
+	var total float64
+	for _, count := range mannWhitneyCounts(5, 7) {
+		total += count
+	}
+	if total != 792 {
+		t.Errorf("got %v orderings, want C(12, 5) = 792", total)
+	}
+	if minP := mannWhitneyMinP(4, 4); math.Abs(minP-2.0/70) > 1e-12 {
+		t.Errorf("got smallest p %v, want %v", minP, 2.0/70)
+	}
+}
+
+func TestComparisonReport(t *testing.T) {
+	base := []float64{1.00, 1.02, 0.99, 1.01, 1.00, 1.03}
+	slower := []float64{1.10, 1.12, 1.09, 1.11, 1.13, 1.10}
+
+	var buf bytes.Buffer
+	err := comparison{base: "iter_09", candidate: "iter_10", baseTimes: base, candidateTimes: slower}.report(&buf, 2, 0.05)
+	if err == nil || !strings.Contains(err.Error(), "iter_10 is 10.0% slower than iter_09") {
+		t.Errorf("expected the regression to fail, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "| iter_09 | 6 | 0.990s | 1.005s | 0.990s – 1.030s | 1.030s |") ||
+		!strings.Contains(buf.String(), "p=0.0022, slower") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+
+	// significant but within the threshold
+	buf.Reset()
+	if err := (comparison{base: "a", candidate: "b", baseTimes: base, candidateTimes: slower}).report(&buf, 15, 0.05); err != nil {
+		t.Errorf("expected a slowdown below the threshold to pass, got %v", err)
+	}
+
+	// faster never fails
+	buf.Reset()
+	if err := (comparison{base: "a", candidate: "b", baseTimes: slower, candidateTimes: base}).report(&buf, 2, 0.05); err != nil {
+		t.Errorf("expected a faster candidate to pass, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "faster") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+
+	// 3 rounds cannot be significant, so the report says so
+	buf.Reset()
+	if err := (comparison{base: "a", candidate: "b", baseTimes: base[:3], candidateTimes: slower[:3]}).report(&buf, 2, 0.05); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "3 rounds cannot show a difference") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,189 @@
+package datagen
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// temperatures are kept in the 1BRC range, stored as tenths
+const (
+	minTemp = -999
+	maxTemp = 999
+)
+
+// DefaultBlockRows is the number of rows a worker generates in one go.
+// The output only depends on the seed and the block size, not on the worker count.
+const DefaultBlockRows = 64 * 1024
+
+type Station struct {
+	Name   string
+	Mean   float64
+	StdDev float64
+}
+
+type Config struct {
+	Rows      int64
+	Seed      uint64
+	Stations  []Station
+	Workers   int
+	BlockRows int
+}
+
+// LoadStations reads a station list with one `name;mean[;stddev]` entry per line.
+// Empty lines and lines starting with # are ignored, a missing stddev defaults to 10.
+func LoadStations(reader io.Reader) ([]Station, error) {
+	var stations []Station
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: expected 'name;mean[;stddev]', got: %s", lineNum, line)
+		}
+
+		station := Station{Name: fields[0], StdDev: defaultStdDev}
+
+		mean, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid mean %q: %w", lineNum, fields[1], err)
+		}
+		station.Mean = mean
+
+		if len(fields) == 3 {
+			stdDev, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil || stdDev < 0 {
+				return nil, fmt.Errorf("line %d: invalid stddev %q", lineNum, fields[2])
+			}
+			station.StdDev = stdDev
+		}
+
+		stations = append(stations, station)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read station list: %w", err)
+	}
+	if len(stations) == 0 {
+		return nil, errors.New("station list is empty")
+	}
+
+	return stations, nil
+}
+
+// Generate writes cfg.Rows `station;temp\n` records to writer.
+// Blocks of rows are generated concurrently but written in order, every block
+// has its own random source derived from the seed and the block index.
+func Generate(writer io.Writer, cfg Config) error {
+	if cfg.Rows < 0 {
+		return fmt.Errorf("row count must not be negative: %d", cfg.Rows)
+	}
+	if len(cfg.Stations) == 0 {
+		cfg.Stations = DefaultStations
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.BlockRows <= 0 {
+		cfg.BlockRows = DefaultBlockRows
+	}
+
+	numBlocks := (cfg.Rows + int64(cfg.BlockRows) - 1) / int64(cfg.BlockRows)
+
+	type job struct {
+		index int64
+		out   chan []byte
+	}
+
+	jobs := make(chan job)
+	// blocks are queued in order, the channel size bounds how far the workers can run ahead
+	ordered := make(chan chan []byte, cfg.Workers*2)
+	done := make(chan struct{})
+	defer close(done)
+
+	bufferPool := sync.Pool{New: func() any { return []byte(nil) }}
+
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+
+		for i := range numBlocks {
+			out := make(chan []byte, 1)
+			select {
+			case ordered <- out:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- job{index: i, out: out}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for range cfg.Workers {
+		go func() {
+			for j := range jobs {
+				rows := min(int64(cfg.BlockRows), cfg.Rows-j.index*int64(cfg.BlockRows))
+				buf := bufferPool.Get().([]byte)
+				j.out <- generateBlock(buf[:0], cfg.Stations, cfg.Seed, j.index, int(rows))
+			}
+		}()
+	}
+
+	for out := range ordered {
+		block := <-out
+		if _, err := writer.Write(block); err != nil {
+			return fmt.Errorf("failed to write generated data: %w", err)
+		}
+		bufferPool.Put(block)
+	}
+
+	return nil
+}
+
+func generateBlock(buf []byte, stations []Station, seed uint64, blockIndex int64, rows int) []byte {
+	rng := rand.New(rand.NewPCG(seed, uint64(blockIndex)))
+
+	for range rows {
+		station := &stations[rng.IntN(len(stations))]
+		temp := station.Mean + station.StdDev*rng.NormFloat64()
+
+		buf = append(buf, station.Name...)
+		buf = append(buf, ';')
+		buf = AppendTemperature(buf, toTenths(temp))
+		buf = append(buf, '\n')
+	}
+
+	return buf
+}
+
+// toTenths rounds the temperature to one decimal and clamps it to the 1BRC range
+func toTenths(temp float64) int {
+	tenths := int(math.Round(temp * 10))
+	return min(max(tenths, minTemp), maxTemp)
+}
+
+// AppendTemperature appends a temperature given in tenths with exactly one decimal digit
+func AppendTemperature(buf []byte, tenths int) []byte {
+	if tenths < 0 {
+		buf = append(buf, '-')
+		tenths = -tenths
+	}
+	buf = strconv.AppendInt(buf, int64(tenths/10), 10)
+	return append(buf, '.', byte('0'+tenths%10))
+}
@@ -0,0 +1,144 @@
+package datagen
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGenerate_RowCountAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := Generate(&buf, Config{Rows: 1000, Seed: 7, Workers: 3, BlockRows: 64})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("got %d rows, want %d", len(lines), 1000)
+	}
+
+	for i, line := range lines {
+		idx := strings.LastIndexByte(line, ';')
+		if idx <= 0 {
+			t.Fatalf("row %d: missing station or separator: %q", i, line)
+		}
+		temp := line[idx+1:]
+		dot := strings.IndexByte(temp, '.')
+		if dot == -1 || dot != len(temp)-2 {
+			t.Fatalf("row %d: temperature must have exactly one decimal: %q", i, temp)
+		}
+		value, err := strconv.ParseFloat(temp, 64)
+		if err != nil {
+			t.Fatalf("row %d: invalid temperature %q: %v", i, temp, err)
+		}
+		if value < -99.9 || value > 99.9 {
+			t.Errorf("row %d: temperature out of range: %v", i, value)
+		}
+	}
+}
+
+func TestGenerate_DeterministicAcrossWorkerCounts(t *testing.T) {
+	var single, parallel bytes.Buffer
+
+	if err := Generate(&single, Config{Rows: 5000, Seed: 42, Workers: 1, BlockRows: 100}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Generate(&parallel, Config{Rows: 5000, Seed: 42, Workers: 8, BlockRows: 100}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(single.Bytes(), parallel.Bytes()) {
+		t.Errorf("output differs between 1 and 8 workers for the same seed")
+	}
+}
+
+func TestGenerate_DifferentSeeds(t *testing.T) {
+	var a, b bytes.Buffer
+
+	Generate(&a, Config{Rows: 100, Seed: 1})
+	Generate(&b, Config{Rows: 100, Seed: 2})
+
+	if bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("expected different output for different seeds")
+	}
+}
+
+func TestGenerate_CustomStations(t *testing.T) {
+	var buf bytes.Buffer
+	stations := []Station{{Name: "Hot", Mean: 50, StdDev: 0}, {Name: "Cold", Mean: -20, StdDev: 0}}
+
+	if err := Generate(&buf, Config{Rows: 200, Seed: 3, Stations: stations}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if line != "Hot;50.0" && line != "Cold;-20.0" {
+			t.Fatalf("unexpected row with zero stddev stations: %q", line)
+		}
+	}
+}
+
+func TestLoadStations(t *testing.T) {
+	input := "# name;mean;stddev\nHamburg;9.7\n\nOslo;5.7;3.5\n"
+
+	stations, err := LoadStations(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Station{
+		{Name: "Hamburg", Mean: 9.7, StdDev: defaultStdDev},
+		{Name: "Oslo", Mean: 5.7, StdDev: 3.5},
+	}
+	if len(stations) != len(want) {
+		t.Fatalf("got %d stations, want %d", len(stations), len(want))
+	}
+	for i := range want {
+		if stations[i] != want[i] {
+			t.Errorf("station %d: got %+v, want %+v", i, stations[i], want[i])
+		}
+	}
+}
+
+func TestLoadStations_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing mean", "Hamburg\n"},
+		{"invalid mean", "Hamburg;warm\n"},
+		{"negative stddev", "Hamburg;9.7;-1\n"},
+		{"empty list", "# nothing here\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadStations(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestAppendTemperature(t *testing.T) {
+	tests := []struct {
+		tenths int
+		want   string
+	}{
+		{0, "0.0"},
+		{5, "0.5"},
+		{-5, "-0.5"},
+		{123, "12.3"},
+		{-999, "-99.9"},
+		{999, "99.9"},
+	}
+
+	for _, tt := range tests {
+		got := string(AppendTemperature(nil, tt.tenths))
+		if got != tt.want {
+			t.Errorf("AppendTemperature(%d) = %q, want %q", tt.tenths, got, tt.want)
+		}
+	}
+}
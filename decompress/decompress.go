@@ -0,0 +1,255 @@
+// Package decompress recognises gzip and bzip2 inputs by their magic bytes
+// and decodes them with the standard library.
+//
+// Gzip files made of several concatenated members (cat a.gz b.gz, bgzip,
+// shards compressed one by one) can also be split at member starts, so that
+// every member range is decompressed by its own goroutine.
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type Compression int
+
+const (
+	None Compression = iota
+	Gzip
+	Bzip2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	default:
+		return "none"
+	}
+}
+
+// HeaderSize is enough bytes of the input for Detect
+const HeaderSize = 4
+
+// Detect returns the compression the header starts with, plain text and
+// headers too short to tell are None
+func Detect(header []byte) Compression {
+	switch {
+	case isGzipHeader(header):
+		return Gzip
+	// "BZh" followed by the block size '1'-'9'
+	case len(header) >= 4 && header[0] == 'B' && header[1] == 'Z' && header[2] == 'h' && header[3] >= '1' && header[3] <= '9':
+		return Bzip2
+	default:
+		return None
+	}
+}
+
+// the gzip magic, deflate as method and none of the reserved flag bits set
+func isGzipHeader(header []byte) bool {
+	return len(header) >= 4 && header[0] == 0x1f && header[1] == 0x8b && header[2] == 8 && header[3]&0xe0 == 0
+}
+
+// NewReader peeks at the start of r and returns a reader of the decoded data
+// together with the detected compression, uncompressed input is returned
+// as is (buffered)
+func NewReader(r io.Reader) (io.Reader, Compression, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(HeaderSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, None, fmt.Errorf("failed to read input header: %w", err)
+	}
+
+	compression := Detect(header)
+	switch compression {
+	case Gzip:
+		// every member of a multi-member file is read in sequence
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, compression, fmt.Errorf("failed to open gzip input: %w", err)
+		}
+		return gz, compression, nil
+	case Bzip2:
+		return bzip2.NewReader(buffered), compression, nil
+	default:
+		return buffered, compression, nil
+	}
+}
+
+// MemberStarts looks for up to n-1 gzip member starts evenly spread over the
+// first size bytes of r and returns them after 0, in increasing order. The
+// i-th start is looked for between i/n and (i+1)/n of the input, so an input
+// without member starts is scanned once.
+//
+// A candidate has to have a gzip header and decode for its first
+// memberCheckSize bytes, header bytes occurring by chance inside compressed
+// data are skipped. A false candidate getting through anyway fails later: a
+// MemberReader ending at it fails with ErrNotMemberBoundary, and one starting
+// at it fails to decode.
+func MemberStarts(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	starts := []int64{0}
+	buffer := make([]byte, 64*1024)
+
+	for i := 1; i < n; i++ {
+		target := max(size*int64(i)/int64(n), starts[len(starts)-1]+1)
+		limit := size * int64(i+1) / int64(n)
+
+		start, err := nextMemberStart(r, target, limit, size, buffer)
+		if err != nil {
+			return nil, err
+		}
+		if start >= 0 {
+			starts = append(starts, start)
+		}
+	}
+
+	return starts, nil
+}
+
+// memberHeaderSize is the fixed part of a gzip member header
+const memberHeaderSize = 10
+
+// memberCheckSize is how much of a candidate member is decoded to tell it
+// from header bytes occurring by chance in compressed data
+const memberCheckSize = 64 * 1024
+
+// nextMemberStart returns the offset of the first gzip member start at or
+// after offset and before limit, or -1 when there is none
+func nextMemberStart(r io.ReaderAt, offset int64, limit int64, size int64, buffer []byte) (int64, error) {
+	for offset < limit {
+		n, err := r.ReadAt(buffer, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read input at offset %d: %w", offset, err)
+		}
+		if n < memberHeaderSize {
+			return -1, nil
+		}
+
+		data := buffer[:n]
+		for i := 0; i+memberHeaderSize <= n; {
+			idx := bytes.IndexByte(data[i:n-memberHeaderSize+1], 0x1f)
+			if idx == -1 {
+				break
+			}
+			candidate := offset + int64(i+idx)
+			if candidate >= limit {
+				return -1, nil
+			}
+			if isMemberHeader(data[i+idx:]) && decodesMember(r, candidate, size) {
+				return candidate, nil
+			}
+			i += idx + 1
+		}
+
+		// the last bytes are read again, a header may straddle the buffers
+		offset += int64(n - memberHeaderSize + 1)
+	}
+
+	return -1, nil
+}
+
+// isMemberHeader checks the fixed header of a gzip member: the magic, deflate
+// with a valid flags byte, an XFL of 0, 2 (best compression) or 4 (fastest)
+// and a known OS
+func isMemberHeader(header []byte) bool {
+	if len(header) < memberHeaderSize || !isGzipHeader(header) {
+		return false
+	}
+	xfl, os := header[8], header[9]
+	return (xfl == 0 || xfl == 2 || xfl == 4) && (os <= 13 || os == 255)
+}
+
+// decodesMember reports whether the data at start decodes as a gzip member
+// for memberCheckSize bytes or up to its end
+func decodesMember(r io.ReaderAt, start int64, size int64) bool {
+	gz, err := gzip.NewReader(bufio.NewReader(io.NewSectionReader(r, start, size-start)))
+	if err != nil {
+		return false
+	}
+	gz.Multistream(false)
+
+	_, err = io.CopyN(io.Discard, gz, memberCheckSize)
+	return err == nil || err == io.EOF
+}
+
+// ErrNotMemberBoundary is returned by a MemberReader whose end turned out not
+// to be the start of a gzip member
+var ErrNotMemberBoundary = errors.New("range does not end at a gzip member boundary")
+
+// MemberReader decodes the gzip members lying between two member starts of r
+type MemberReader struct {
+	input  *countingReader
+	gz     *gzip.Reader
+	length int64
+}
+
+// NewMemberReader returns a reader of the data compressed in the members
+// starting at start, reading stops after the member that ends at end
+func NewMemberReader(r io.ReaderAt, start int64, end int64) (*MemberReader, error) {
+	// the section runs to the end of the input so a member crossing end can be
+	// detected, gzip reads its members byte by byte through the counting reader
+	section := io.NewSectionReader(r, start, 1<<62)
+	input := &countingReader{reader: bufio.NewReader(section)}
+
+	gz, err := gzip.NewReader(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip member at offset %d: %w", start, err)
+	}
+	gz.Multistream(false)
+
+	return &MemberReader{input: input, gz: gz, length: end - start}, nil
+}
+
+func (m *MemberReader) Read(p []byte) (int, error) {
+	for {
+		n, err := m.gz.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		switch {
+		case m.input.count > m.length:
+			return n, ErrNotMemberBoundary
+		case m.input.count == m.length:
+			return n, io.EOF
+		}
+
+		// the member ended before the range, go on with the next one
+		if err := m.gz.Reset(m.input); err != nil {
+			return n, fmt.Errorf("failed to open gzip member: %w", err)
+		}
+		m.gz.Multistream(false)
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// countingReader counts the compressed bytes gzip consumed, it implements
+// io.ByteReader so gzip does not add a buffer of its own that reads ahead
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.reader.ReadByte()
+	if err == nil {
+		c.count++
+	}
+	return b, err
+}
@@ -0,0 +1,202 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func gzipMembers(t *testing.T, members ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, member := range members {
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write([]byte(member)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// "Hamburg;12.3\n" compressed with bzip2 -9
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x03, 0x94, 0x5d, 0xf9, 0x00, 0x00,
+	0x03, 0x5d, 0x80, 0x00, 0x10, 0x00, 0x01, 0x38, 0x08, 0x00, 0x40, 0x30, 0x82, 0x12, 0x00, 0x20,
+	0x00, 0x22, 0x01, 0xa0, 0x02, 0x01, 0xa0, 0x07, 0x70, 0x05, 0xc4, 0xe6, 0xe7, 0x77, 0x8b, 0xb9,
+	0x22, 0x9c, 0x28, 0x48, 0x01, 0xca, 0x2e, 0xfc, 0x80,
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   Compression
+	}{
+		{"plain", []byte("Hamburg;12.3\n"), None},
+		{"gzip", gzipMembers(t, "Hamburg;12.3\n"), Gzip},
+		{"bzip2", bzip2Data, Bzip2},
+		{"gzip magic with reserved flags", []byte{0x1f, 0x8b, 8, 0xe0}, None},
+		{"bzip2 magic without block size", []byte("BZh0"), None},
+		{"too short", []byte{0x1f, 0x8b}, None},
+		{"empty", nil, None},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.header); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  Compression
+	}{
+		{"plain", []byte("Hamburg;12.3\n"), None},
+		{"gzip", gzipMembers(t, "Hamburg;12.3\n"), Gzip},
+		{"multi-member gzip", gzipMembers(t, "Hamburg;", "12.3\n"), Gzip},
+		{"bzip2", bzip2Data, Bzip2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, compression, err := NewReader(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if compression != tt.want {
+				t.Errorf("got compression %v, want %v", compression, tt.want)
+			}
+
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != "Hamburg;12.3\n" {
+				t.Errorf("got %q, want %q", data, "Hamburg;12.3\n")
+			}
+		})
+	}
+}
+
+func TestNewReader_Empty(t *testing.T) {
+	reader, compression, err := NewReader(strings.NewReader(""))
+	if err != nil || compression != None {
+		t.Fatalf("got %v, %v, want none and no error", compression, err)
+	}
+	if data, _ := io.ReadAll(reader); len(data) != 0 {
+		t.Errorf("got %q, want no data", data)
+	}
+}
+
+func TestMemberStarts(t *testing.T) {
+	members := []string{
+		strings.Repeat("Hamburg;12.3\n", 1000),
+		strings.Repeat("Oslo;-5.5\n", 1000),
+		strings.Repeat("Rome;20.1\n", 1000),
+		strings.Repeat("Berlin;1.0\n", 1000),
+	}
+	var want []int64
+	var data []byte
+	for _, member := range members {
+		want = append(want, int64(len(data)))
+		data = append(data, gzipMembers(t, member)...)
+	}
+
+	starts, err := MemberStarts(bytes.NewReader(data), int64(len(data)), 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(starts) == 0 || starts[0] != 0 {
+		t.Fatalf("got starts %v, want the first one at 0", starts)
+	}
+	for _, start := range starts {
+		if !slices.Contains(want, start) {
+			t.Errorf("start %d is not a member start, members start at %v", start, want)
+		}
+	}
+
+	// every range decodes to its members, together they give back the input
+	var decoded strings.Builder
+	for i, start := range starts {
+		end := int64(len(data))
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		reader, err := NewMemberReader(bytes.NewReader(data), start, end)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := io.Copy(&decoded, reader); err != nil {
+			t.Fatalf("range %d-%d: unexpected error: %v", start, end, err)
+		}
+	}
+	if decoded.String() != strings.Join(members, "") {
+		t.Errorf("decoded ranges differ from the members")
+	}
+}
+
+func TestMemberStarts_SingleMember(t *testing.T) {
+	data := gzipMembers(t, "Hamburg;12.3\n")
+
+	starts, err := MemberStarts(bytes.NewReader(data), int64(len(data)), 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(starts) != 1 || starts[0] != 0 {
+		t.Errorf("got starts %v, want [0]", starts)
+	}
+}
+
+func TestMemberStarts_FalseHeaders(t *testing.T) {
+	// a stored member keeps its data as is, so header bytes in the data show
+	// up in the compressed input like they can by chance in deflate data
+	fakeHeaders := []byte{
+		0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff, 'n', 'o', 't', ' ', 'd', 'e', 'f', 'l', 'a', 't', 'e',
+		0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 7, 0xff, // unknown XFL
+		0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 42, // unknown OS
+	}
+	var stored bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&stored, gzip.NoCompression)
+	for range 2000 {
+		gz.Write(fakeHeaders)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := append(stored.Bytes(), gzipMembers(t, "Hamburg;12.3\n")...)
+	starts, err := MemberStarts(bytes.NewReader(data), int64(len(data)), 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(starts, []int64{0, int64(stored.Len())}) {
+		t.Errorf("got starts %v, want [0 %d]", starts, stored.Len())
+	}
+}
+
+func TestMemberReader_NotMemberBoundary(t *testing.T) {
+	data := gzipMembers(t, strings.Repeat("Hamburg;12.3\n", 100), "Oslo;-5.5\n")
+
+	// the range ends inside the first member
+	reader, err := NewMemberReader(bytes.NewReader(data), 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrNotMemberBoundary) {
+		t.Errorf("expected ErrNotMemberBoundary, got %v", err)
+	}
+}
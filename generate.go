@@ -0,0 +1,80 @@
+package main
+
+import (
+	"1brc-go/datagen"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// number of rows generated for the datasets known by resolveFileSize
+var datasetRows = map[string]int64{
+	"small": 100_000,
+	"mid":   10_000_000,
+	"full":  1_000_000_000,
+}
+
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset to generate: small, mid, full")
+	rows := fs.Int64("rows", 0, "number of rows, overrides the dataset default")
+	out := fs.String("out", "", "output path, defaults to the dataset path")
+	seed := fs.Uint64("seed", 1, "random seed, the same seed always produces the same file")
+	stationsPath := fs.String("stations", "", "station list with 'name;mean[;stddev]' lines, defaults to the 1BRC stations")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of generator goroutines")
+	fs.Parse(args)
+
+	cfg := datagen.Config{
+		Rows:    *rows,
+		Seed:    *seed,
+		Workers: *workers,
+	}
+	if cfg.Rows == 0 {
+		defaultRows, ok := datasetRows[*size]
+		if !ok {
+			return fmt.Errorf("unknown dataset: %s", *size)
+		}
+		cfg.Rows = defaultRows
+	}
+
+	if *stationsPath != "" {
+		stationsFile, err := os.Open(*stationsPath)
+		if err != nil {
+			return fmt.Errorf("failed to open station list: %w", err)
+		}
+		defer stationsFile.Close()
+
+		cfg.Stations, err = datagen.LoadStations(stationsFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	outputPath := *out
+	if outputPath == "" {
+		outputPath, _ = resolveFileSize(*size)
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	start := time.Now()
+	if err := datagen.Generate(outputFile, cfg); err != nil {
+		return err
+	}
+	if err := outputFile.Close(); err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+
+	fmt.Printf("➜ generated %d rows into %s in %s\n", cfg.Rows, outputPath, time.Since(start))
+	return nil
+}
@@ -5,3 +5,7 @@ go 1.25.0
 require golang.org/x/exp v0.0.0-20260527015227-08cc5374adb3
 
 require golang.org/x/sys v0.45.0
+
+require golang.org/x/sync v0.20.0
+
+require github.com/google/pprof v0.0.0-20260115054156-294ebfa9ad83
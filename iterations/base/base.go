@@ -1,6 +1,8 @@
 package base
 
 import (
+	"1brc-go/solver"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -248,3 +250,9 @@ func Execute(inputPath string, outputPath string, bufferSize int) error {
 	}
 	return nil
 }
+
+func init() {
+	solver.Register("base", solver.Options{BufferSize: 8 * 1024 * 1024, Workers: 1}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize)
+	})
+}
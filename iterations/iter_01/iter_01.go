@@ -1,6 +1,8 @@
 package iter01
 
 import (
+	"1brc-go/solver"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -260,3 +262,9 @@ func Execute(inputPath string, outputPath string, bufferSize int) error {
 	}
 	return nil
 }
+
+func init() {
+	solver.Register("iter_01", solver.Options{BufferSize: 8 * 1024 * 1024, Workers: 1}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize)
+	})
+}
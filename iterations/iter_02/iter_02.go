@@ -1,7 +1,9 @@
 package iter02
 
 import (
+	"1brc-go/solver"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -296,3 +298,9 @@ func Execute(inputPath string, outputPath string, bufferSize int) error {
 	}
 	return nil
 }
+
+func init() {
+	solver.Register("iter_02", solver.Options{BufferSize: 8 * 1024 * 1024, Workers: 1}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize)
+	})
+}
@@ -1,7 +1,9 @@
 package iter03
 
 import (
+	"1brc-go/solver"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,7 +12,8 @@ import (
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type Chunk struct {
@@ -168,6 +171,26 @@ func (rg *RecordGenerator) HasNext() bool {
 	return rg.hasNext
 }
 
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	ChunkStart int64
+	Offset     int64
+	Line       string
+	Err        error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("chunk at offset %d: failed at offset %d: %v", e.ChunkStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("chunk at offset %d: record at offset %d %q: %v", e.ChunkStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
 type Record struct {
 	station []byte
 	temp    float64
@@ -323,29 +346,49 @@ func FormatMetrics(city string, metrics Metrics) string {
 	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
 }
 
-func ProcessChunk(reader io.ReaderAt, chunk Chunk, bufferSize int) (*MeasurementAggregator, error) {
+// ProcessChunk stops with ctx.Err() before the next buffer refill once ctx is cancelled
+func ProcessChunk(ctx context.Context, reader io.ReaderAt, chunk Chunk, bufferSize int) (*MeasurementAggregator, error) {
 	chunkReader := NewChunkReader(reader, chunk, bufferSize, '\n')
 	aggregator := NewMeasurementAggregator()
 
 	// read and aggregate data
 	for chunkReader.HasNext() {
-		chunk, err := chunkReader.ReadNextChunk()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		bufferStart := chunkReader.offset
+		buffer, err := chunkReader.ReadNextChunk()
 		if err != nil {
-			return nil, fmt.Errorf("failed reading chunk: %w", err)
+			return nil, &RecordError{
+				ChunkStart: chunk.start,
+				Offset:     bufferStart,
+				Err:        fmt.Errorf("failed reading chunk: %w", err),
+			}
 		}
 
-		recordGenerator := NewRecordGenerator(chunk, '\n')
+		recordGenerator := NewRecordGenerator(buffer, '\n')
 
 		for recordGenerator.HasNext() {
+			recordOffset := bufferStart + int64(recordGenerator.offset)
 
 			rawRec, err := recordGenerator.ReadNextRecord()
 			if err != nil {
-				return nil, fmt.Errorf("failed reading record from chunk: %w", err)
+				return nil, &RecordError{
+					ChunkStart: chunk.start,
+					Offset:     recordOffset,
+					Err:        fmt.Errorf("failed reading record from chunk: %w", err),
+				}
 			}
 
 			record, err := ParseRecord(rawRec)
 			if err != nil {
-				return nil, fmt.Errorf("failed parsing record '%s': %w", rawRec, err)
+				return nil, &RecordError{
+					ChunkStart: chunk.start,
+					Offset:     recordOffset,
+					Line:       string(rawRec),
+					Err:        err,
+				}
 			}
 
 			aggregator.AddRecord(record)
@@ -374,42 +417,29 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 		return fmt.Errorf("failed to creat chunks from file: %w", err)
 	}
 
-	type partialResult struct {
-		res *MeasurementAggregator
-		err error
-	}
-	resultsChan := make(chan partialResult, len(chunks))
-	var wg sync.WaitGroup
-
-	for _, chunk := range chunks {
-		wg.Add(1)
+	// the first failing worker cancels the others and no output is written
+	group, ctx := errgroup.WithContext(context.Background())
+	partialResults := make([]*MeasurementAggregator, len(chunks))
 
-		go func(c Chunk) {
-			defer wg.Done()
-			res, err := ProcessChunk(inputFile, c, bufferSize)
+	for i, chunk := range chunks {
+		group.Go(func() error {
+			res, err := ProcessChunk(ctx, inputFile, chunk, bufferSize)
+			if err != nil {
+				return err
+			}
 
-			resultsChan <- partialResult{res: res, err: err}
-		}(chunk)
+			partialResults[i] = res
+			return nil
+		})
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("failed to process input: %w", err)
+	}
 
-	errCount := 0
 	resultAgg := NewResultAggregator()
-
-	for msg := range resultsChan {
-		// Unpack and check the error first
-		if msg.err != nil {
-			fmt.Printf("Worker error: %v\n", msg.err)
-			errCount++
-			continue // Skip aggregating this failed record
-		}
-
-		// Because we checked the error, it's now safe to use msg.res
-		resultAgg.AddPartialResults(msg.res.cityMeasurements)
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
 	}
 
 	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
@@ -452,3 +482,9 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 	}
 	return nil
 }
+
+func init() {
+	solver.Register("iter_03", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize, opts.Workers)
+	})
+}
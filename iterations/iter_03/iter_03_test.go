@@ -2,6 +2,10 @@ package iter03
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -618,3 +622,61 @@ func TestRoundToOneDecimal(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessChunk_RecordError(t *testing.T) {
+	// the malformed record starts at offset 23
+	data := "Hamburg;12.3\nOslo;-5.5\nRome9.9\nBerlin;1.0\n"
+	reader := strings.NewReader(data)
+
+	_, err := ProcessChunk(context.Background(), reader, Chunk{start: 0, end: int64(len(data))}, 16)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.ChunkStart != 0 {
+		t.Errorf("got chunk start %d, want 0", recordErr.ChunkStart)
+	}
+	if recordErr.Offset != 23 {
+		t.Errorf("got offset %d, want 23", recordErr.Offset)
+	}
+	if recordErr.Line != "Rome9.9" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "Rome9.9")
+	}
+}
+
+func TestProcessChunk_CancelledContext(t *testing.T) {
+	data := "Hamburg;12.3\nOslo;-5.5\n"
+	reader := strings.NewReader(data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ProcessChunk(ctx, reader, Chunk{start: 0, end: int64(len(data))}, 64); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExecute_NoOutputOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "measurements.txt")
+	outputPath := filepath.Join(dir, "results.txt")
+
+	data := strings.Repeat("Hamburg;12.3\n", 100) + "broken\n" + strings.Repeat("Oslo;-5.5\n", 100)
+	if err := os.WriteFile(inputPath, []byte(data), 0666); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	err := Execute(inputPath, outputPath, 64, 4)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Line != "broken" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "broken")
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file on failure, got %v", err)
+	}
+}
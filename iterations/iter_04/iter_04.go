@@ -1,7 +1,9 @@
 package iter04
 
 import (
+	"1brc-go/solver"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,7 +12,8 @@ import (
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type Section struct {
@@ -57,19 +60,25 @@ func nextRecordBoundary(reader io.ReaderAt, targetOffset int64, bufferSize int,
 }
 
 type RecordGenerator struct {
+	ctx           context.Context
 	reader        *io.SectionReader
+	sectionStart  int64
 	sectionOffset int64
+	recordOffset  int64
 	buffer        []byte
 	safeBuffer    []byte
 	separator     byte
 }
 
 // bufferSize must be greater than record size
-func NewRecordGenerator(reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
+// ctx is checked before every buffer refill so a cancelled section stops early
+func NewRecordGenerator(ctx context.Context, reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
 	sectionReader := io.NewSectionReader(reader, section.start, section.length)
 	buffer := make([]byte, bufferSize)
 	return &RecordGenerator{
+		ctx:           ctx,
 		reader:        sectionReader,
+		sectionStart:  section.start,
 		sectionOffset: 0,
 		buffer:        buffer,
 		separator:     separator,
@@ -77,6 +86,9 @@ func NewRecordGenerator(reader io.ReaderAt, section Section, bufferSize int, sep
 }
 
 func (rg *RecordGenerator) readNextChunk() error {
+	if err := rg.ctx.Err(); err != nil {
+		return err
+	}
 
 	n, err := rg.reader.ReadAt(rg.buffer, rg.sectionOffset)
 
@@ -111,9 +123,12 @@ func (rg *RecordGenerator) ReadRecord() ([]byte, error) {
 	if len(rg.safeBuffer) == 0 || rg.safeBuffer == nil {
 		err := rg.readNextChunk()
 		if err != nil {
+			rg.recordOffset = rg.sectionStart + rg.sectionOffset
 			return nil, err
 		}
 	}
+	rg.recordOffset = rg.sectionStart + rg.sectionOffset - int64(len(rg.safeBuffer))
+
 	// find next record end
 	idx := bytes.IndexByte(rg.safeBuffer, rg.separator)
 
@@ -127,6 +142,32 @@ func (rg *RecordGenerator) ReadRecord() ([]byte, error) {
 	return record, nil
 }
 
+// Offset returns the absolute input offset of the last record read, or of the
+// position where reading failed
+func (rg *RecordGenerator) Offset() int64 {
+	return rg.recordOffset
+}
+
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	SectionStart int64
+	Offset       int64
+	Line         string
+	Err          error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("section at offset %d: failed at offset %d: %v", e.SectionStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("section at offset %d: record at offset %d %q: %v", e.SectionStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
 type Record struct {
 	station []byte
 	temp    float64
@@ -257,8 +298,8 @@ func FormatMetrics(city string, metrics Metrics) string {
 	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
 }
 
-func ProcessSection(reader io.ReaderAt, chunk Section, bufferSize int) (*MeasurementAggregator, error) {
-	recordGenerator := NewRecordGenerator(reader, chunk, bufferSize, '\n')
+func ProcessSection(ctx context.Context, reader io.ReaderAt, chunk Section, bufferSize int) (*MeasurementAggregator, error) {
+	recordGenerator := NewRecordGenerator(ctx, reader, chunk, bufferSize, '\n')
 	aggregator := NewMeasurementAggregator()
 
 	// read and aggregate data
@@ -268,13 +309,25 @@ func ProcessSection(reader io.ReaderAt, chunk Section, bufferSize int) (*Measure
 			if err == io.EOF {
 				break
 			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
 
-			return nil, fmt.Errorf("failed reading record: %w", err)
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Err:          fmt.Errorf("failed reading record: %w", err),
+			}
 		}
 
 		record, err := ParseRecord(rawRec)
 		if err != nil {
-			return nil, fmt.Errorf("failed parsing record '%s': %w", rawRec, err)
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Line:         string(rawRec),
+				Err:          err,
+			}
 		}
 
 		aggregator.AddRecord(record)
@@ -303,42 +356,29 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 		return fmt.Errorf("failed to creat chunks from file: %w", err)
 	}
 
-	type partialResult struct {
-		res *MeasurementAggregator
-		err error
-	}
-	resultsChan := make(chan partialResult, len(chunks))
-	var wg sync.WaitGroup
+	// the first failing worker cancels the others and no output is written
+	group, ctx := errgroup.WithContext(context.Background())
+	partialResults := make([]*MeasurementAggregator, len(chunks))
 
-	for _, chunk := range chunks {
-		wg.Add(1)
-
-		go func(c Section) {
-			defer wg.Done()
-			res, err := ProcessSection(inputFile, c, bufferSize)
+	for i, chunk := range chunks {
+		group.Go(func() error {
+			res, err := ProcessSection(ctx, inputFile, chunk, bufferSize)
+			if err != nil {
+				return err
+			}
 
-			resultsChan <- partialResult{res: res, err: err}
-		}(chunk)
+			partialResults[i] = res
+			return nil
+		})
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("failed to process input: %w", err)
+	}
 
-	errCount := 0
 	resultAgg := NewResultAggregator()
-
-	for msg := range resultsChan {
-		// Unpack and check the error first
-		if msg.err != nil {
-			fmt.Printf("Worker error: %v\n", msg.err)
-			errCount++
-			continue // Skip aggregating this failed record
-		}
-
-		// Because we checked the error, it's now safe to use msg.res
-		resultAgg.AddPartialResults(msg.res.cityMeasurements)
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
 	}
 
 	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
@@ -381,3 +421,9 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 	}
 	return nil
 }
+
+func init() {
+	solver.Register("iter_04", solver.Options{BufferSize: 16 * 1024 * 1024, Workers: 50}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize, opts.Workers)
+	})
+}
@@ -2,8 +2,11 @@ package iter06
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -161,7 +164,7 @@ func TestRecordGenerator_ReadRecord_AcrossBufferRefills(t *testing.T) {
 	// the section covers "45678\n0123\n5\n" -> start 4, length 13
 	section := Section{start: 4, length: 13}
 	// a 6-byte buffer cannot hold the whole section, so it must refill
-	rg := NewRecordGenerator(reader, section, 6, '\n')
+	rg := NewRecordGenerator(context.Background(), reader, section, 6, '\n')
 
 	want := []string{"45678", "0123", "5"}
 	for i, w := range want {
@@ -184,7 +187,7 @@ func TestRecordGenerator_ReadRecord_WholeSection(t *testing.T) {
 	data := "abc\ndefg\nhi\n"
 	reader := strings.NewReader(data)
 	section := Section{start: 0, length: int64(len(data))}
-	rg := NewRecordGenerator(reader, section, 64, '\n')
+	rg := NewRecordGenerator(context.Background(), reader, section, 64, '\n')
 
 	want := []string{"abc", "defg", "hi"}
 	for i, w := range want {
@@ -205,7 +208,7 @@ func TestRecordGenerator_ReadRecord_WholeSection(t *testing.T) {
 func TestRecordGenerator_ReadRecord_SingleRecord(t *testing.T) {
 	data := "solo\n"
 	reader := strings.NewReader(data)
-	rg := NewRecordGenerator(reader, Section{start: 0, length: int64(len(data))}, 64, '\n')
+	rg := NewRecordGenerator(context.Background(), reader, Section{start: 0, length: int64(len(data))}, 64, '\n')
 
 	got, err := rg.ReadRecord()
 	if err != nil {
@@ -223,7 +226,7 @@ func TestRecordGenerator_ReadRecord_SingleRecord(t *testing.T) {
 func TestRecordGenerator_ReadRecord_NoSeparator(t *testing.T) {
 	data := "noseparator"
 	reader := strings.NewReader(data)
-	rg := NewRecordGenerator(reader, Section{start: 0, length: int64(len(data))}, 64, '\n')
+	rg := NewRecordGenerator(context.Background(), reader, Section{start: 0, length: int64(len(data))}, 64, '\n')
 
 	if _, err := rg.ReadRecord(); err == nil {
 		t.Errorf("expected error when no separator is present, got nil")
@@ -635,3 +638,61 @@ func TestRoundToOneDecimal(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessSection_RecordError(t *testing.T) {
+	// the malformed record starts at offset 23
+	data := "Hamburg;12.3\nOslo;-5.5\nRome9.9\nBerlin;1.0\n"
+	reader := strings.NewReader(data)
+
+	_, err := ProcessSection(context.Background(), reader, Section{start: 0, length: int64(len(data))}, 16)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.SectionStart != 0 {
+		t.Errorf("got section start %d, want 0", recordErr.SectionStart)
+	}
+	if recordErr.Offset != 23 {
+		t.Errorf("got offset %d, want 23", recordErr.Offset)
+	}
+	if recordErr.Line != "Rome9.9" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "Rome9.9")
+	}
+}
+
+func TestProcessSection_CancelledContext(t *testing.T) {
+	data := "Hamburg;12.3\nOslo;-5.5\n"
+	reader := strings.NewReader(data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ProcessSection(ctx, reader, Section{start: 0, length: int64(len(data))}, 64); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExecute_NoOutputOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "measurements.txt")
+	outputPath := filepath.Join(dir, "results.txt")
+
+	data := strings.Repeat("Hamburg;12.3\n", 100) + "broken\n" + strings.Repeat("Oslo;-5.5\n", 100)
+	if err := os.WriteFile(inputPath, []byte(data), 0666); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	err := Execute(inputPath, outputPath, 64, 4)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Line != "broken" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "broken")
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file on failure, got %v", err)
+	}
+}
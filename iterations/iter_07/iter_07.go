@@ -1,15 +1,17 @@
 package iter07
 
 import (
+	"1brc-go/solver"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"slices"
-	"strings"
-	"sync"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type Section struct {
@@ -56,19 +58,25 @@ func nextRecordBoundary(reader io.ReaderAt, targetOffset int64, bufferSize int,
 }
 
 type RecordGenerator struct {
+	ctx           context.Context
 	reader        *io.SectionReader
+	sectionStart  int64
 	sectionOffset int64
+	recordOffset  int64
 	buffer        []byte
 	safeBuffer    []byte
 	separator     byte
 }
 
 // bufferSize must be greater than record size
-func NewRecordGenerator(reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
+// ctx is checked before every buffer refill so a cancelled section stops early
+func NewRecordGenerator(ctx context.Context, reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
 	sectionReader := io.NewSectionReader(reader, section.start, section.length)
 	buffer := make([]byte, bufferSize)
 	return &RecordGenerator{
+		ctx:           ctx,
 		reader:        sectionReader,
+		sectionStart:  section.start,
 		sectionOffset: 0,
 		buffer:        buffer,
 		separator:     separator,
@@ -76,6 +84,9 @@ func NewRecordGenerator(reader io.ReaderAt, section Section, bufferSize int, sep
 }
 
 func (rg *RecordGenerator) readNextChunk() error {
+	if err := rg.ctx.Err(); err != nil {
+		return err
+	}
 
 	n, err := rg.reader.ReadAt(rg.buffer, rg.sectionOffset)
 
@@ -110,9 +121,12 @@ func (rg *RecordGenerator) ReadRecord() ([]byte, error) {
 	if len(rg.safeBuffer) == 0 || rg.safeBuffer == nil {
 		err := rg.readNextChunk()
 		if err != nil {
+			rg.recordOffset = rg.sectionStart + rg.sectionOffset
 			return nil, err
 		}
 	}
+	rg.recordOffset = rg.sectionStart + rg.sectionOffset - int64(len(rg.safeBuffer))
+
 	// find next record end
 	idx := bytes.IndexByte(rg.safeBuffer, rg.separator)
 
@@ -126,6 +140,32 @@ func (rg *RecordGenerator) ReadRecord() ([]byte, error) {
 	return record, nil
 }
 
+// Offset returns the absolute input offset of the last record read, or of the
+// position where reading failed
+func (rg *RecordGenerator) Offset() int64 {
+	return rg.recordOffset
+}
+
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	SectionStart int64
+	Offset       int64
+	Line         string
+	Err          error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("section at offset %d: failed at offset %d: %v", e.SectionStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("section at offset %d: record at offset %d %q: %v", e.SectionStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
 type Record struct {
 	station []byte
 	temp    int
@@ -136,14 +176,17 @@ func ParseRecord(rawRecord []byte) (Record, error) {
 
 	separatorIdx := bytes.IndexByte(rawRecord, ';')
 	if separatorIdx == -1 {
-		return record, fmt.Errorf("separator ';' not found in record: %s", rawRecord)
+		return record, parseErrorf(ReasonMissingSeparator, "separator ';' not found in record: %s", rawRecord)
+	}
+	if separatorIdx == 0 {
+		return record, parseErrorf(ReasonBadLength, "empty station name in record: %s", rawRecord)
 	}
 
 	record.station = rawRecord[:separatorIdx]
 
 	temp, err := parseTemperature(rawRecord[separatorIdx+1:])
 	if err != nil {
-		return record, fmt.Errorf("failed to convert temperature to float: %s in record: %s", rawRecord[separatorIdx+1:], rawRecord)
+		return record, err
 	}
 	record.temp = temp
 
@@ -155,12 +198,14 @@ func ParseRecord(rawRecord []byte) (Record, error) {
 // 1 decimal precision, there is always one and only one decimal place number
 // decimal are separated by . from the integer part
 // it will return the 10x the measurement as an int
+// a third integer digit is parsed only to report the value as out of range
 func parseTemperature(temp []byte) (int, error) {
-	// shortest eg 1.1 longest eg -23.5
-	if len(temp) < 3 || len(temp) > 5 {
-		return 0.0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	// shortest eg 1.1 longest eg -23.5 (or -123.5 when out of range)
+	if len(temp) < 3 || len(temp) > 6 {
+		return 0, parseErrorf(ReasonBadLength, "unexpected length (%d) for temperature data: %s", len(temp), temp)
 	}
 
+	raw := temp
 	sign := 1
 	result := 0
 
@@ -170,21 +215,49 @@ func parseTemperature(temp []byte) (int, error) {
 		temp = temp[1:]
 	}
 
+	// the digits are unsigned, so anything below '0' wraps around and fails the > 9 check too
+	var d0, d1, d2, d3 byte
 	if len(temp) == 4 {
-		result = 100*(int(temp[0]-'0')) + 10*(int(temp[1]-'0')) + int(temp[3]-'0')
+		d0, d1, d2 = temp[0]-'0', temp[1]-'0', temp[3]-'0'
+		result = 100*int(d0) + 10*int(d1) + int(d2)
 	} else if len(temp) == 3 {
-		result = 10*(int(temp[0]-'0')) + int(temp[2]-'0')
+		d0, d1 = temp[0]-'0', temp[2]-'0'
+		result = 10*int(d0) + int(d1)
+	} else if len(temp) == 5 {
+		d0, d1, d2, d3 = temp[0]-'0', temp[1]-'0', temp[2]-'0', temp[4]-'0'
+		result = 1000*int(d0) + 100*int(d1) + 10*int(d2) + int(d3)
 	} else {
-		return 0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+		return 0, parseErrorf(ReasonBadLength, "unexpected length (%d) for temperature data: %s", len(raw), raw)
+	}
+
+	if d0 > 9 || d1 > 9 || d2 > 9 || d3 > 9 || temp[len(temp)-2] != '.' {
+		return 0, parseErrorf(ReasonNonDigit, "unexpected character in temperature data: %s", raw)
+	}
+	if result > maxTemperature {
+		return 0, parseErrorf(ReasonOutOfRange, "temperature out of range: %s", raw)
 	}
 
 	return sign * result, nil
 }
 
+// largest accepted absolute temperature in tenths
+const maxTemperature = 999
+
 type Metrics struct {
-	min float64
-	avg float64
-	max float64
+	min   float64
+	avg   float64
+	max   float64
+	sum   float64
+	count int
+
+	// optional, see Stats
+	stats    Stats
+	variance float64
+	stddev   float64
+	median   float64
+	p90      float64
+	p99      float64
+	mode     float64
 }
 
 type AggregatedMeasurements struct {
@@ -192,10 +265,18 @@ type AggregatedMeasurements struct {
 	max   int
 	sum   int
 	count int
+
+	// only tracked with StatsSpread, in tenths²
+	sumSquares int64
+	// only with StatsHistogram, shared by the aggregators of a run
+	histogram *Histogram
 }
 
 type MeasurementAggregator struct {
 	cityMeasurements map[string]*AggregatedMeasurements
+	rejected         RejectStats
+	stats            Stats
+	histograms       *Histograms
 }
 
 func NewMeasurementAggregator() MeasurementAggregator {
@@ -209,14 +290,17 @@ func (a *MeasurementAggregator) AddRecord(record Record) {
 	aggMeasurement, ok := a.cityMeasurements[string(record.station)]
 
 	if !ok { // no previous measurement for the city
-		aggMeasurement := AggregatedMeasurements{
+		aggMeasurement = &AggregatedMeasurements{
 			min:   record.temp,
 			max:   record.temp,
 			sum:   record.temp,
 			count: 1,
 		}
 
-		a.cityMeasurements[string(record.station)] = &aggMeasurement
+		a.cityMeasurements[string(record.station)] = aggMeasurement
+		if a.stats&StatsHistogram != 0 {
+			aggMeasurement.histogram = a.histograms.get(string(record.station))
+		}
 
 	} else { // there's already previous measurements, modify in place
 		aggMeasurement.min = min(aggMeasurement.min, record.temp)
@@ -225,10 +309,14 @@ func (a *MeasurementAggregator) AddRecord(record Record) {
 		aggMeasurement.count++
 	}
 
+	if a.stats != 0 {
+		aggMeasurement.addExtended(record.temp, a.stats)
+	}
 }
 
 type ResultAggregator struct {
 	allResults map[string]*AggregatedMeasurements
+	stats      Stats
 }
 
 func NewResultAggregator() ResultAggregator {
@@ -247,6 +335,7 @@ func (ra *ResultAggregator) AddPartialResults(partialResults map[string]*Aggrega
 			currentMeasurements.max = max(currentMeasurements.max, v.max)
 			currentMeasurements.sum += v.sum
 			currentMeasurements.count += v.count
+			currentMeasurements.mergeExtended(v)
 		}
 	}
 }
@@ -272,6 +361,12 @@ func (ra *ResultAggregator) CalculateMetricsForCity(city string) (Metrics, error
 	metrics.max = float64(aggregatedData.max) / 10.0
 	metrics.min = float64(aggregatedData.min) / 10.0
 	metrics.avg = float64(aggregatedData.sum) / float64(aggregatedData.count*10)
+	metrics.sum = float64(aggregatedData.sum) / 10.0
+	metrics.count = aggregatedData.count
+
+	if ra.stats != 0 {
+		calculateExtended(&metrics, aggregatedData, ra.stats)
+	}
 
 	return metrics, nil
 }
@@ -288,9 +383,15 @@ func FormatMetrics(city string, metrics Metrics) string {
 	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
 }
 
-func ProcessSection(reader io.ReaderAt, chunk Section, bufferSize int) (*MeasurementAggregator, error) {
-	recordGenerator := NewRecordGenerator(reader, chunk, bufferSize, '\n')
+// a nil rejector fails on the first malformed record, otherwise the record is
+// counted in the aggregator's rejected stats and handed to the rejector. The
+// histograms of StatsHistogram are added to histograms, a nil one gives the
+// section its own.
+func ProcessSection(ctx context.Context, reader io.ReaderAt, chunk Section, bufferSize int, rejector *Rejector, stats Stats, histograms *Histograms) (*MeasurementAggregator, error) {
+	recordGenerator := NewRecordGenerator(ctx, reader, chunk, bufferSize, '\n')
 	aggregator := NewMeasurementAggregator()
+	aggregator.stats = stats
+	aggregator.histograms = histograms
 
 	// read and aggregate data
 	for {
@@ -299,13 +400,34 @@ func ProcessSection(reader io.ReaderAt, chunk Section, bufferSize int) (*Measure
 			if err == io.EOF {
 				break
 			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
 
-			return nil, fmt.Errorf("failed reading record: %w", err)
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Err:          fmt.Errorf("failed reading record: %w", err),
+			}
 		}
 
 		record, err := ParseRecord(rawRec)
 		if err != nil {
-			return nil, fmt.Errorf("failed parsing record '%s': %w", rawRec, err)
+			var parseErr *ParseError
+			if rejector != nil && errors.As(err, &parseErr) {
+				aggregator.rejected[parseErr.Reason]++
+				if err := rejector.Reject(recordGenerator.Offset(), rawRec, parseErr.Reason); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Line:         string(rawRec),
+				Err:          err,
+			}
 		}
 
 		aggregator.AddRecord(record)
@@ -315,11 +437,36 @@ func ProcessSection(reader io.ReaderAt, chunk Section, bufferSize int) (*Measure
 	return &aggregator, nil
 }
 
+type Options struct {
+	BufferSize int
+	Workers    int
+	OnError    ErrorMode
+	// receives the rejected records in quarantine mode
+	QuarantinePath string
+	Format         OutputFormat
+	Stats          Stats
+}
+
 func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int) error {
+	_, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: bufferSize, Workers: numWorkers})
+	return err
+}
+
+// ExecuteWithOptions returns the number of rejected records, which is always
+// zero in fail mode. Cancelling ctx stops the workers before their next
+// buffer refill, writes no output and returns ctx.Err().
+func ExecuteWithOptions(ctx context.Context, inputPath string, outputPath string, opts Options) (RejectStats, error) {
+	var rejected RejectStats
+
+	// the canonical output is min/avg/max only, the optional statistics need
+	// the named fields or columns of the other formats
+	if opts.Stats != 0 && opts.Format == FormatCanonical {
+		return rejected, fmt.Errorf("the optional statistics require the json, csv or ndjson output format")
+	}
 
 	inputFile, err := os.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to open file at %s: %w", inputPath, err)
+		return rejected, fmt.Errorf("failed to open file at %s: %w", inputPath, err)
 	}
 	defer inputFile.Close()
 
@@ -329,52 +476,73 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 	}
 	fileSize := info.Size()
 
-	chunks, err := CalculateSections(inputFile, fileSize, 128, '\n', numWorkers)
+	chunks, err := CalculateSections(inputFile, fileSize, 128, '\n', opts.Workers)
 	if err != nil {
-		return fmt.Errorf("failed to creat chunks from file: %w", err)
+		return rejected, fmt.Errorf("failed to creat chunks from file: %w", err)
 	}
 
-	type partialResult struct {
-		res *MeasurementAggregator
-		err error
+	var quarantine io.Writer
+	if opts.OnError == OnErrorQuarantine {
+		if opts.QuarantinePath == "" {
+			return rejected, fmt.Errorf("quarantine mode requires a quarantine path")
+		}
+		quarantineFile, err := os.Create(opts.QuarantinePath)
+		if err != nil {
+			return rejected, fmt.Errorf("failed to create quarantine file: %w", err)
+		}
+		defer quarantineFile.Close()
+		quarantine = quarantineFile
 	}
-	resultsChan := make(chan partialResult, len(chunks))
-	var wg sync.WaitGroup
-
-	for _, chunk := range chunks {
-		wg.Add(1)
 
-		go func(c Section) {
-			defer wg.Done()
-			res, err := ProcessSection(inputFile, c, bufferSize)
+	rejector, err := NewRejector(opts.OnError, quarantine)
+	if err != nil {
+		return rejected, err
+	}
 
-			resultsChan <- partialResult{res: res, err: err}
-		}(chunk)
+	var histograms *Histograms
+	if opts.Stats&StatsHistogram != 0 {
+		histograms = NewHistograms()
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
+	// the first failing worker cancels the others and no output is written
+	group, groupCtx := errgroup.WithContext(ctx)
+	partialResults := make([]*MeasurementAggregator, len(chunks))
 
-	errCount := 0
-	resultAgg := NewResultAggregator()
+	for i, chunk := range chunks {
+		group.Go(func() error {
+			res, err := ProcessSection(groupCtx, inputFile, chunk, opts.BufferSize, rejector, opts.Stats, histograms)
+			if err != nil {
+				return err
+			}
+
+			partialResults[i] = res
+			return nil
+		})
+	}
 
-	for msg := range resultsChan {
-		// Unpack and check the error first
-		if msg.err != nil {
-			fmt.Printf("Worker error: %v\n", msg.err)
-			errCount++
-			continue // Skip aggregating this failed record
+	if err := group.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return rejected, ctx.Err()
 		}
+		return rejected, fmt.Errorf("failed to process input: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return rejected, err
+	}
+	if err := rejector.Flush(); err != nil {
+		return rejected, fmt.Errorf("failed to write quarantine file: %w", err)
+	}
 
-		// Because we checked the error, it's now safe to use msg.res
-		resultAgg.AddPartialResults(msg.res.cityMeasurements)
+	resultAgg := NewResultAggregator()
+	resultAgg.stats = opts.Stats
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
+		rejected.Add(res.rejected)
 	}
 
 	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
+		return rejected, fmt.Errorf("failed to open output file: %w", err)
 	}
 	defer outputFile.Close()
 
@@ -383,32 +551,51 @@ func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int
 	cities := resultAgg.ListCities()
 	slices.Sort(cities)
 
-	var sb strings.Builder
-
-	sb.WriteString("{")
+	resultWriter := NewResultWriter(opts.Format, opts.Stats, outputFile)
 
-	for i, city := range cities {
+	for _, city := range cities {
 		metrics, err := resultAgg.CalculateMetricsForCity(city)
 		if err != nil {
-			return fmt.Errorf("failed to calculate metrics for city '%s': %w", city, err)
+			return rejected, fmt.Errorf("failed to calculate metrics for city '%s': %w", city, err)
 		}
 
-		formattedOutput := FormatMetrics(city, metrics)
-		sb.WriteString(formattedOutput)
-
-		// don't add separator after last element
-		if i+1 < len(cities) {
-			sb.WriteString(", ")
+		if err := resultWriter.WriteCity(city, metrics); err != nil {
+			return rejected, fmt.Errorf("failed to write output: %w", err)
 		}
 	}
 
-	sb.WriteString("}\n")
+	if err := resultWriter.Close(); err != nil {
+		return rejected, fmt.Errorf("failed to write output: %w", err)
+	}
+	return rejected, nil
+}
 
-	results := sb.String()
+func init() {
+	solver.Register("iter_07", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		onError, err := ParseErrorMode(opts.OnError)
+		if err != nil {
+			return err
+		}
+		format, err := ParseOutputFormat(opts.Format)
+		if err != nil {
+			return err
+		}
+		stats, err := ParseStats(opts.Stats)
+		if err != nil {
+			return err
+		}
 
-	_, err = outputFile.WriteString(results)
-	if err != nil {
-		panic(err)
-	}
-	return nil
+		rejected, err := ExecuteWithOptions(ctx, inputPath, outputPath, Options{
+			BufferSize:     opts.BufferSize,
+			Workers:        opts.Workers,
+			OnError:        onError,
+			QuarantinePath: opts.QuarantinePath,
+			Format:         format,
+			Stats:          stats,
+		})
+		if rejected.Total() > 0 {
+			fmt.Fprintf(os.Stderr, "➜ [%-15s] %s\n", "iter_07", rejected)
+		}
+		return err
+	}, solver.LenientParsing, solver.OutputFormats, solver.ExtendedStats, solver.Cancellation)
 }
@@ -0,0 +1,248 @@
+package iter07
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type OutputFormat int
+
+const (
+	FormatCanonical OutputFormat = iota // {A=1.0/2.0/3.0, B=...}
+	FormatJSON                          // one object keyed by station
+	FormatCSV                           // header line followed by one row per station
+	FormatNDJSON                        // one JSON object per station and line
+)
+
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch format {
+	case "", "canonical":
+		return FormatCanonical, nil
+	case "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	case "ndjson":
+		return FormatNDJSON, nil
+	default:
+		return FormatCanonical, fmt.Errorf("unknown output format %q, expected canonical, json, csv or ndjson", format)
+	}
+}
+
+// ResultWriter writes the per-city metrics in the order they are passed in,
+// Close must be called to finish the output. The optional statistics are
+// written as extra values, fields or columns.
+type ResultWriter interface {
+	WriteCity(city string, metrics Metrics) error
+	Close() error
+}
+
+func NewResultWriter(format OutputFormat, stats Stats, writer io.Writer) ResultWriter {
+	buffered := bufio.NewWriter(writer)
+
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{writer: buffered}
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(buffered), buffered: buffered, stats: stats}
+	case FormatNDJSON:
+		return &ndjsonWriter{writer: buffered}
+	default:
+		return &canonicalWriter{writer: buffered}
+	}
+}
+
+// formatTenths formats a value with the one decimal rounding of FormatMetrics
+func formatTenths(x float64) string {
+	return strconv.FormatFloat(RoundToOneDecimal(x), 'f', 1, 64)
+}
+
+// formatSquared formats a value in degrees² as is, rounding it to tenths
+// would hide the spread of measurements less than a degree apart
+func formatSquared(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+type canonicalWriter struct {
+	writer  *bufio.Writer
+	written int
+}
+
+func (w *canonicalWriter) WriteCity(city string, metrics Metrics) error {
+	if w.written == 0 {
+		w.writer.WriteString("{")
+	} else {
+		// don't add separator before the first element
+		w.writer.WriteString(", ")
+	}
+	w.written++
+
+	_, err := w.writer.WriteString(FormatMetrics(city, metrics))
+	return err
+}
+
+func (w *canonicalWriter) Close() error {
+	if w.written == 0 {
+		w.writer.WriteString("{")
+	}
+	w.writer.WriteString("}\n")
+	return w.writer.Flush()
+}
+
+// jsonMetrics uses json.Number so values keep their single decimal, e.g. 12.0 instead of 12
+type jsonMetrics struct {
+	Station string      `json:"station,omitempty"`
+	Min     json.Number `json:"min"`
+	Avg     json.Number `json:"avg"`
+	Max     json.Number `json:"max"`
+	Count   int         `json:"count"`
+	Sum     json.Number `json:"sum"`
+
+	Stddev   json.Number `json:"stddev,omitempty"`
+	Variance json.Number `json:"variance,omitempty"`
+	Median   json.Number `json:"median,omitempty"`
+	P90      json.Number `json:"p90,omitempty"`
+	P99      json.Number `json:"p99,omitempty"`
+	Mode     json.Number `json:"mode,omitempty"`
+}
+
+func newJSONMetrics(station string, metrics Metrics) jsonMetrics {
+	m := jsonMetrics{
+		Station: station,
+		Min:     json.Number(formatTenths(metrics.min)),
+		Avg:     json.Number(formatTenths(metrics.avg)),
+		Max:     json.Number(formatTenths(metrics.max)),
+		Count:   metrics.count,
+		Sum:     json.Number(formatTenths(metrics.sum)),
+	}
+
+	if metrics.stats&StatsSpread != 0 {
+		m.Stddev = json.Number(formatTenths(metrics.stddev))
+		m.Variance = json.Number(formatSquared(metrics.variance))
+	}
+	if metrics.stats&StatsHistogram != 0 {
+		m.Median = json.Number(formatTenths(metrics.median))
+		m.P90 = json.Number(formatTenths(metrics.p90))
+		m.P99 = json.Number(formatTenths(metrics.p99))
+		m.Mode = json.Number(formatTenths(metrics.mode))
+	}
+
+	return m
+}
+
+type jsonWriter struct {
+	writer  *bufio.Writer
+	written int
+}
+
+func (w *jsonWriter) WriteCity(city string, metrics Metrics) error {
+	key, err := json.Marshal(city)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(newJSONMetrics("", metrics))
+	if err != nil {
+		return err
+	}
+
+	if w.written == 0 {
+		w.writer.WriteString("{\n  ")
+	} else {
+		w.writer.WriteString(",\n  ")
+	}
+	w.written++
+
+	w.writer.Write(key)
+	w.writer.WriteString(": ")
+	_, err = w.writer.Write(value)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	if w.written == 0 {
+		w.writer.WriteString("{}\n")
+	} else {
+		w.writer.WriteString("\n}\n")
+	}
+	return w.writer.Flush()
+}
+
+type ndjsonWriter struct {
+	writer *bufio.Writer
+}
+
+func (w *ndjsonWriter) WriteCity(city string, metrics Metrics) error {
+	line, err := json.Marshal(newJSONMetrics(city, metrics))
+	if err != nil {
+		return err
+	}
+
+	w.writer.Write(line)
+	return w.writer.WriteByte('\n')
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.writer.Flush()
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	buffered      *bufio.Writer
+	headerWritten bool
+	stats         Stats
+}
+
+func (w *csvWriter) writeHeader() error {
+	w.headerWritten = true
+
+	header := []string{"station", "min", "avg", "max", "count", "sum"}
+	if w.stats&StatsSpread != 0 {
+		header = append(header, "stddev", "variance")
+	}
+	if w.stats&StatsHistogram != 0 {
+		header = append(header, "median", "p90", "p99", "mode")
+	}
+	return w.writer.Write(header)
+}
+
+func (w *csvWriter) WriteCity(city string, metrics Metrics) error {
+	if !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	row := []string{
+		city,
+		formatTenths(metrics.min),
+		formatTenths(metrics.avg),
+		formatTenths(metrics.max),
+		strconv.Itoa(metrics.count),
+		formatTenths(metrics.sum),
+	}
+	if w.stats&StatsSpread != 0 {
+		row = append(row, formatTenths(metrics.stddev), formatSquared(metrics.variance))
+	}
+	if w.stats&StatsHistogram != 0 {
+		row = append(row, formatTenths(metrics.median), formatTenths(metrics.p90), formatTenths(metrics.p99), formatTenths(metrics.mode))
+	}
+	return w.writer.Write(row)
+}
+
+func (w *csvWriter) Close() error {
+	if !w.headerWritten {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	return w.buffered.Flush()
+}
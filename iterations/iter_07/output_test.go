@@ -0,0 +1,151 @@
+package iter07
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestResults(t *testing.T, format OutputFormat) string {
+	t.Helper()
+
+	var sb strings.Builder
+	w := NewResultWriter(format, 0, &sb)
+
+	results := []struct {
+		city    string
+		metrics Metrics
+	}{
+		{"Hamburg", Metrics{min: -1.5, avg: 12.0, max: 25.5, sum: 36.0, count: 3}},
+		{"Washington, D.C.", Metrics{min: 3.0, avg: 4.25, max: 5.5, sum: 8.5, count: 2}},
+	}
+	for _, r := range results {
+		if err := w.WriteCity(r.city, r.metrics); err != nil {
+			t.Fatalf("WriteCity failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	return sb.String()
+}
+
+func TestResultWriter_Canonical(t *testing.T) {
+	got := writeTestResults(t, FormatCanonical)
+	want := "{Hamburg=-1.5/12.0/25.5, Washington, D.C.=3.0/4.3/5.5}\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResultWriter_JSON(t *testing.T) {
+	got := writeTestResults(t, FormatJSON)
+
+	var decoded map[string]map[string]float64
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("invalid JSON %q: %v", got, err)
+	}
+	if decoded["Washington, D.C."]["count"] != 2 || decoded["Hamburg"]["sum"] != 36 {
+		t.Errorf("unexpected values: %v", decoded)
+	}
+	// values keep their single decimal
+	if !strings.Contains(got, `"avg":12.0`) {
+		t.Errorf("expected one decimal place in %q", got)
+	}
+}
+
+func TestResultWriter_NDJSON(t *testing.T) {
+	got := writeTestResults(t, FormatNDJSON)
+
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", got)
+	}
+
+	want := `{"station":"Hamburg","min":-1.5,"avg":12.0,"max":25.5,"count":3,"sum":36.0}`
+	if lines[0] != want {
+		t.Errorf("got %s, want %s", lines[0], want)
+	}
+}
+
+func TestResultWriter_CSV(t *testing.T) {
+	got := writeTestResults(t, FormatCSV)
+
+	records, err := csv.NewReader(strings.NewReader(got)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV %q: %v", got, err)
+	}
+
+	want := [][]string{
+		{"station", "min", "avg", "max", "count", "sum"},
+		{"Hamburg", "-1.5", "12.0", "25.5", "3", "36.0"},
+		{"Washington, D.C.", "3.0", "4.3", "5.5", "2", "8.5"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d: got %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestResultWriter_Empty(t *testing.T) {
+	tests := map[OutputFormat]string{
+		FormatCanonical: "{}\n",
+		FormatJSON:      "{}\n",
+		FormatCSV:       "station,min,avg,max,count,sum\n",
+		FormatNDJSON:    "",
+	}
+
+	for format, want := range tests {
+		var sb strings.Builder
+		if err := NewResultWriter(format, 0, &sb).Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if sb.String() != want {
+			t.Errorf("format %d: got %q, want %q", format, sb.String(), want)
+		}
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for input, want := range map[string]OutputFormat{"": FormatCanonical, "canonical": FormatCanonical, "json": FormatJSON, "csv": FormatCSV, "ndjson": FormatNDJSON} {
+		got, err := ParseOutputFormat(input)
+		if err != nil || got != want {
+			t.Errorf("ParseOutputFormat(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestExecute_CSVOutput(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	outputPath := filepath.Join(dir, "output.csv")
+
+	if err := os.WriteFile(inputPath, []byte("Rome;10.0\nOslo;-3.5\nRome;20.0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: 64, Workers: 1, Format: FormatCSV}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "station,min,avg,max,count,sum\nOslo,-3.5,-3.5,-3.5,1,-3.5\nRome,10.0,15.0,20.0,2,30.0\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
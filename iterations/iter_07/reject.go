@@ -0,0 +1,162 @@
+package iter07
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrorMode controls what happens with records that fail to parse
+type ErrorMode int
+
+const (
+	OnErrorFail       ErrorMode = iota // abort the whole run on the first bad record
+	OnErrorSkip                        // count the bad record and continue
+	OnErrorQuarantine                  // count, write the record to the quarantine file and continue
+)
+
+func ParseErrorMode(mode string) (ErrorMode, error) {
+	switch mode {
+	case "", "fail":
+		return OnErrorFail, nil
+	case "skip":
+		return OnErrorSkip, nil
+	case "quarantine":
+		return OnErrorQuarantine, nil
+	default:
+		return OnErrorFail, fmt.Errorf("unknown error mode %q, expected fail, skip or quarantine", mode)
+	}
+}
+
+func (m ErrorMode) String() string {
+	switch m {
+	case OnErrorSkip:
+		return "skip"
+	case OnErrorQuarantine:
+		return "quarantine"
+	default:
+		return "fail"
+	}
+}
+
+type RejectReason int
+
+const (
+	ReasonMissingSeparator RejectReason = iota
+	ReasonBadLength
+	ReasonNonDigit
+	ReasonOutOfRange
+	numRejectReasons
+)
+
+var rejectReasonNames = [numRejectReasons]string{
+	ReasonMissingSeparator: "missing separator",
+	ReasonBadLength:        "bad length",
+	ReasonNonDigit:         "non-digit",
+	ReasonOutOfRange:       "out of range",
+}
+
+func (r RejectReason) String() string {
+	if r < 0 || r >= numRejectReasons {
+		return fmt.Sprintf("RejectReason(%d)", int(r))
+	}
+	return rejectReasonNames[r]
+}
+
+// ParseError is returned by ParseRecord, Reason tells why the record was rejected
+type ParseError struct {
+	Reason RejectReason
+	msg    string
+}
+
+func (e *ParseError) Error() string {
+	return e.msg
+}
+
+func parseErrorf(reason RejectReason, format string, args ...any) *ParseError {
+	return &ParseError{Reason: reason, msg: fmt.Sprintf(format, args...)}
+}
+
+// RejectStats counts the rejected records per reason
+type RejectStats [numRejectReasons]int64
+
+func (s *RejectStats) Add(other RejectStats) {
+	for i := range s {
+		s[i] += other[i]
+	}
+}
+
+func (s RejectStats) Total() int64 {
+	var total int64
+	for _, count := range s {
+		total += count
+	}
+	return total
+}
+
+func (s RejectStats) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "rejected %d records", s.Total())
+	for reason, count := range s {
+		if count == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, ", %s: %d", RejectReason(reason), count)
+	}
+
+	return sb.String()
+}
+
+// Rejector handles the malformed records of every worker in skip and quarantine mode.
+// Quarantined records are written as `offset<TAB>reason<TAB>record` lines, the
+// order between workers is not defined.
+type Rejector struct {
+	mu         sync.Mutex
+	quarantine *bufio.Writer
+}
+
+// NewRejector returns nil in fail mode, quarantine is only used in quarantine mode
+func NewRejector(mode ErrorMode, quarantine io.Writer) (*Rejector, error) {
+	switch mode {
+	case OnErrorFail:
+		return nil, nil
+	case OnErrorQuarantine:
+		if quarantine == nil {
+			return nil, fmt.Errorf("quarantine mode requires a quarantine output")
+		}
+		return &Rejector{quarantine: bufio.NewWriter(quarantine)}, nil
+	default:
+		return &Rejector{}, nil
+	}
+}
+
+// Reject records a malformed record found at the absolute input offset
+func (r *Rejector) Reject(offset int64, rawRecord []byte, reason RejectReason) error {
+	if r.quarantine == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := fmt.Fprintf(r.quarantine, "%d\t%s\t%s\n", offset, reason, rawRecord)
+	if err != nil {
+		return fmt.Errorf("failed to write quarantined record: %w", err)
+	}
+	return nil
+}
+
+// Flush writes out the buffered quarantined records
+func (r *Rejector) Flush() error {
+	if r == nil || r.quarantine == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.quarantine.Flush()
+}
@@ -0,0 +1,156 @@
+package iter07
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRecord_RejectReasons(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  RejectReason
+	}{
+		{"missing separator", "Hamburg12.3", ReasonMissingSeparator},
+		{"empty station", ";12.3", ReasonBadLength},
+		{"temperature too short", "Hamburg;1.", ReasonBadLength},
+		{"temperature too long", "Hamburg;-1234.5", ReasonBadLength},
+		{"letters", "Hamburg;ab.c", ReasonNonDigit},
+		{"missing decimal point", "Hamburg;1234", ReasonNonDigit},
+		{"trailing carriage return", "Hamburg;1.2\r", ReasonNonDigit},
+		{"above range", "Hamburg;100.0", ReasonOutOfRange},
+		{"below range", "Hamburg;-123.4", ReasonOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRecord([]byte(tt.input))
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if parseErr.Reason != tt.want {
+				t.Errorf("got reason %q, want %q", parseErr.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ErrorMode
+		wantErr bool
+	}{
+		{input: "", want: OnErrorFail},
+		{input: "fail", want: OnErrorFail},
+		{input: "skip", want: OnErrorSkip},
+		{input: "quarantine", want: OnErrorQuarantine},
+		{input: "ignore", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseErrorMode(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseErrorMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseErrorMode(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRejectStats_String(t *testing.T) {
+	var stats RejectStats
+	stats[ReasonMissingSeparator] = 2
+	stats[ReasonOutOfRange] = 1
+
+	want := "rejected 3 records, missing separator: 2, out of range: 1"
+	if got := stats.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcessSection_SkipMode(t *testing.T) {
+	data := "Hamburg;12.3\nbroken\nOslo;-5.5\nRome;ab.c\nHamburg;1.0\n"
+	reader := strings.NewReader(data)
+
+	rejector, err := NewRejector(OnErrorSkip, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	aggregator, err := ProcessSection(context.Background(), reader, Section{start: 0, length: int64(len(data))}, 16, rejector, 0, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if aggregator.rejected[ReasonMissingSeparator] != 1 || aggregator.rejected[ReasonNonDigit] != 1 || aggregator.rejected.Total() != 2 {
+		t.Errorf("unexpected rejected stats: %v", aggregator.rejected)
+	}
+	assertMeasurements(t, aggregator.cityMeasurements, "Hamburg", AggregatedMeasurements{min: 10, max: 123, sum: 133, count: 2})
+	assertMeasurements(t, aggregator.cityMeasurements, "Oslo", AggregatedMeasurements{min: -55, max: -55, sum: -55, count: 1})
+	if len(aggregator.cityMeasurements) != 2 {
+		t.Errorf("expected 2 cities, got %d", len(aggregator.cityMeasurements))
+	}
+}
+
+func TestExecuteWithOptions_Quarantine(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "measurements.txt")
+	outputPath := filepath.Join(dir, "results.txt")
+	quarantinePath := filepath.Join(dir, "rejected.txt")
+
+	// the broken record starts at offset 13
+	data := "Hamburg;12.3\nbroken\nOslo;-5.5\n"
+	if err := os.WriteFile(inputPath, []byte(data), 0666); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	rejected, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{
+		BufferSize:     64,
+		Workers:        1,
+		OnError:        OnErrorQuarantine,
+		QuarantinePath: quarantinePath,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rejected.Total() != 1 || rejected[ReasonMissingSeparator] != 1 {
+		t.Errorf("unexpected rejected stats: %v", rejected)
+	}
+
+	quarantined, err := os.ReadFile(quarantinePath)
+	if err != nil {
+		t.Fatalf("failed to read quarantine file: %v", err)
+	}
+	if string(quarantined) != "13\tmissing separator\tbroken\n" {
+		t.Errorf("unexpected quarantine content: %q", quarantined)
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if string(output) != "{Hamburg=12.3/12.3/12.3, Oslo=-5.5/-5.5/-5.5}\n" {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestExecuteWithOptions_QuarantineRequiresPath(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "measurements.txt")
+	if err := os.WriteFile(inputPath, []byte("Hamburg;12.3\n"), 0666); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	_, err := ExecuteWithOptions(context.Background(), inputPath, filepath.Join(dir, "results.txt"), Options{BufferSize: 64, Workers: 1, OnError: OnErrorQuarantine})
+	if err == nil {
+		t.Errorf("expected error without quarantine path, got nil")
+	}
+}
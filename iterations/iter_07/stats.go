@@ -0,0 +1,181 @@
+package iter07
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats selects the optional per-station statistics, the zero value keeps
+// only min, max, sum and count on the fast path
+type Stats uint
+
+const (
+	StatsSpread    Stats = 1 << iota // sum of squares for the variance and standard deviation
+	StatsHistogram                   // exact histogram for the median, p90, p99 and mode
+)
+
+// ParseStats parses a comma separated list, e.g. "stddev,percentiles"
+func ParseStats(list string) (Stats, error) {
+	var stats Stats
+	for name := range strings.SplitSeq(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "stddev", "variance":
+			stats |= StatsSpread
+		case "percentiles", "median", "mode":
+			stats |= StatsHistogram
+		default:
+			return 0, fmt.Errorf("unknown statistic %q, expected stddev, variance or percentiles", name)
+		}
+	}
+	return stats, nil
+}
+
+// Histogram counts the measurements of every possible temperature, bucket i
+// holds the temperature i-maxTemperature in tenths. uint32 keeps it at 8 KiB
+// per station, a bucket overflows only after more than 4 billion identical
+// measurements of one station.
+type Histogram [2*maxTemperature + 1]uint32
+
+// Histograms holds the histogram of every station for all the workers of a
+// run, so they take 8 KiB per station however many workers there are. The
+// workers add to the buckets atomically.
+type Histograms struct {
+	mu        sync.Mutex
+	byStation map[string]*Histogram
+}
+
+func NewHistograms() *Histograms {
+	return &Histograms{byStation: make(map[string]*Histogram)}
+}
+
+// get returns the histogram of station, a nil Histograms gives every caller
+// its own
+func (h *Histograms) get(station string) *Histogram {
+	if h == nil {
+		return new(Histogram)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	histogram, ok := h.byStation[station]
+	if !ok {
+		histogram = new(Histogram)
+		h.byStation[station] = histogram
+	}
+	return histogram
+}
+
+// addExtended updates the optional statistics, it is only called when stats
+// were requested
+func (m *AggregatedMeasurements) addExtended(temp int, stats Stats) {
+	if stats&StatsSpread != 0 {
+		// at most 999² per record, so int64 holds the squares of ~9e12 records
+		m.sumSquares += int64(temp) * int64(temp)
+	}
+	if stats&StatsHistogram != 0 {
+		atomic.AddUint32(&m.histogram[temp+maxTemperature], 1)
+	}
+}
+
+func (m *AggregatedMeasurements) mergeExtended(other *AggregatedMeasurements) {
+	m.sumSquares += other.sumSquares
+
+	switch {
+	case other.histogram == nil, other.histogram == m.histogram:
+		// the aggregators of a run share the histogram of a station
+	case m.histogram == nil:
+		histogram := *other.histogram
+		m.histogram = &histogram
+	default:
+		for i, count := range other.histogram {
+			m.histogram[i] += count
+		}
+	}
+}
+
+// variance returns the population variance in degrees², the numerator
+// count*sumSquares - sum² is computed exactly in integer tenths and converted
+// to float only once
+func variance(count int, sum int, sumSquares int64) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	n := big.NewInt(int64(count))
+	s := big.NewInt(int64(sum))
+
+	numerator := new(big.Int).Mul(n, big.NewInt(sumSquares))
+	numerator.Sub(numerator, s.Mul(s, s))
+
+	denominator := new(big.Int).Mul(n, n)
+	denominator.Mul(denominator, big.NewInt(100))
+
+	v, _ := new(big.Rat).SetFrac(numerator, denominator).Float64()
+	return v
+}
+
+// percentile returns the nearest-rank percentile in tenths: the smallest
+// temperature with at least p% of the count measurements at or below it
+func (h *Histogram) percentile(p int, count int) int {
+	rank := (p*count + 99) / 100
+	return h.nth(max(rank, 1))
+}
+
+// median returns the exact median in tenths, the mean of the two middle
+// measurements when the count is even
+func (h *Histogram) median(count int) float64 {
+	if count%2 == 1 {
+		return float64(h.nth(count/2 + 1))
+	}
+	return float64(h.nth(count/2)+h.nth(count/2+1)) / 2
+}
+
+// nth returns the rank-th smallest measurement in tenths, counting from 1
+func (h *Histogram) nth(rank int) int {
+	seen := 0
+	for i, bucket := range h {
+		seen += int(bucket)
+		if seen >= rank {
+			return i - maxTemperature
+		}
+	}
+	return maxTemperature
+}
+
+// mode returns the most frequent temperature in tenths. Of several equally
+// frequent temperatures the lowest one wins, so the mode does not depend on
+// the order the sections were merged in.
+func (h *Histogram) mode() int {
+	best := 0
+	for i, bucket := range h {
+		if bucket > h[best] {
+			best = i
+		}
+	}
+	return best - maxTemperature
+}
+
+// calculateExtended fills the optional metrics of a city, the median is exact
+// and the percentiles are nearest-rank
+func calculateExtended(metrics *Metrics, aggregatedData *AggregatedMeasurements, stats Stats) {
+	metrics.stats = stats
+
+	if stats&StatsSpread != 0 {
+		metrics.variance = variance(aggregatedData.count, aggregatedData.sum, aggregatedData.sumSquares)
+		metrics.stddev = math.Sqrt(metrics.variance)
+	}
+
+	if stats&StatsHistogram != 0 && aggregatedData.histogram != nil {
+		h := aggregatedData.histogram
+		metrics.median = h.median(aggregatedData.count) / 10.0
+		metrics.p90 = float64(h.percentile(90, aggregatedData.count)) / 10.0
+		metrics.p99 = float64(h.percentile(99, aggregatedData.count)) / 10.0
+		metrics.mode = float64(h.mode()) / 10.0
+	}
+}
@@ -0,0 +1,338 @@
+package iter07
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseStats(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Stats
+		wantErr bool
+	}{
+		{input: "", want: 0},
+		{input: "stddev", want: StatsSpread},
+		{input: "variance, stddev", want: StatsSpread},
+		{input: "kurtosis", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStats(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseStats(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseStats(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestVariance(t *testing.T) {
+	temps := []int{-123, 0, 45, 999, -999, 12, 12}
+
+	sum, sumSquares := 0, int64(0)
+	for _, temp := range temps {
+		sum += temp
+		sumSquares += int64(temp) * int64(temp)
+	}
+
+	mean := float64(sum) / float64(len(temps)) / 10
+	want := 0.0
+	for _, temp := range temps {
+		d := float64(temp)/10 - mean
+		want += d * d
+	}
+	want /= float64(len(temps))
+
+	if got := variance(len(temps), sum, sumSquares); math.Abs(got-want) > 1e-9 {
+		t.Errorf("got variance %v, want %v", got, want)
+	}
+	if got := variance(3, 30, 300); got != 0 {
+		t.Errorf("constant measurements must have zero variance, got %v", got)
+	}
+}
+
+func TestVariance_NoOverflow(t *testing.T) {
+	// a billion extreme records overflow count*sumSquares in int64
+	count := 1_000_000_000
+	sum := 0
+	sumSquares := int64(count) * 999 * 999
+
+	if got, want := variance(count, sum, sumSquares), 9980.01; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got variance %v, want %v", got, want)
+	}
+}
+
+func TestAggregator_SpreadOnlyWhenRequested(t *testing.T) {
+	plain := NewMeasurementAggregator()
+	plain.AddRecord(Record{station: []byte("Oslo"), temp: 20})
+	if plain.cityMeasurements["Oslo"].sumSquares != 0 {
+		t.Errorf("sum of squares tracked without StatsSpread")
+	}
+
+	a1 := NewMeasurementAggregator()
+	a1.stats = StatsSpread
+	a1.AddRecord(Record{station: []byte("Oslo"), temp: 20})
+	a1.AddRecord(Record{station: []byte("Oslo"), temp: -40})
+
+	a2 := NewMeasurementAggregator()
+	a2.stats = StatsSpread
+	a2.AddRecord(Record{station: []byte("Oslo"), temp: 80})
+
+	ra := NewResultAggregator()
+	ra.stats = StatsSpread
+	ra.AddPartialResults(a1.cityMeasurements)
+	ra.AddPartialResults(a2.cityMeasurements)
+
+	metrics, err := ra.CalculateMetricsForCity("Oslo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 2.0, -4.0 and 8.0: mean 2.0, variance (0 + 36 + 36) / 3
+	if metrics.variance != 24 {
+		t.Errorf("got variance %v, want 24", metrics.variance)
+	}
+	if math.Abs(metrics.stddev-math.Sqrt(24)) > 1e-12 {
+		t.Errorf("got stddev %v, want %v", metrics.stddev, math.Sqrt(24))
+	}
+}
+
+func TestExecute_SpreadInAllFormats(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte("Oslo;2.0\nOslo;-4.0\nOslo;8.0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[OutputFormat]string{
+		FormatJSON:   "{\n  \"Oslo\": {\"min\":-4.0,\"avg\":2.0,\"max\":8.0,\"count\":3,\"sum\":6.0,\"stddev\":4.9,\"variance\":24}\n}\n",
+		FormatNDJSON: "{\"station\":\"Oslo\",\"min\":-4.0,\"avg\":2.0,\"max\":8.0,\"count\":3,\"sum\":6.0,\"stddev\":4.9,\"variance\":24}\n",
+		FormatCSV:    "station,min,avg,max,count,sum,stddev,variance\nOslo,-4.0,2.0,8.0,3,6.0,4.9,24\n",
+	}
+
+	for format, want := range tests {
+		outputPath := filepath.Join(dir, "output.txt")
+		opts := Options{BufferSize: 64, Workers: 1, Format: format, Stats: StatsSpread}
+		if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, opts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("format %d: got %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestExecute_StatsNeedNamedFields(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	outputPath := filepath.Join(dir, "output.txt")
+	if err := os.WriteFile(inputPath, []byte("Oslo;1.0\nOslo;1.1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// the canonical output stays min/avg/max
+	opts := Options{BufferSize: 64, Workers: 1, Stats: StatsSpread}
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, opts); err == nil {
+		t.Errorf("expected an error for statistics in the canonical format")
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		t.Errorf("expected no output")
+	}
+
+	// a variance below a tenth of a degree² is not rounded away
+	opts.Format = FormatCSV
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "station,min,avg,max,count,sum,stddev,variance\nOslo,1.0,1.1,1.1,2,2.1,0.1,0.0025\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHistogram_MatchesSortedValues(t *testing.T) {
+	temps := []int{-999, 999, 0, 0, 15, 15, 15, -3, 42, 250, -120, 7, 7, 999}
+
+	var h Histogram
+	for _, temp := range temps {
+		h[temp+maxTemperature]++
+	}
+
+	sorted := slices.Clone(temps)
+	slices.Sort(sorted)
+	for _, p := range []int{1, 50, 90, 99, 100} {
+		// nearest rank: the ceil(p/100*n)-th smallest value
+		rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+		if got, want := h.percentile(p, len(temps)), sorted[rank-1]; got != want {
+			t.Errorf("p%d: got %d, want %d", p, got, want)
+		}
+	}
+
+	if got := h.mode(); got != 15 {
+		t.Errorf("got mode %d, want 15", got)
+	}
+}
+
+func TestHistogram_MedianEvenCount(t *testing.T) {
+	var h Histogram
+	for _, temp := range []int{-20, 10, 35, 35, 40, 990} {
+		h[temp+maxTemperature]++
+	}
+
+	// the mean of the 3rd and 4th of six measurements
+	if got := h.median(6); got != 35 {
+		t.Errorf("got median %v, want 35", got)
+	}
+
+	h[35+maxTemperature]--
+	if got := h.median(5); got != 35 {
+		t.Errorf("got median %v of an odd count, want 35", got)
+	}
+
+	h[40+maxTemperature]--
+	if got := h.median(4); got != 22.5 {
+		t.Errorf("got median %v, want 22.5", got)
+	}
+}
+
+func TestHistogram_ModeTieTakesLowest(t *testing.T) {
+	var h Histogram
+	h[30+maxTemperature] = 2
+	h[-30+maxTemperature] = 2
+
+	if got := h.mode(); got != -30 {
+		t.Errorf("got mode %d, want -30", got)
+	}
+}
+
+func TestAggregator_HistogramMerge(t *testing.T) {
+	a1 := NewMeasurementAggregator()
+	a1.stats = StatsHistogram
+	a2 := NewMeasurementAggregator()
+	a2.stats = StatsHistogram
+
+	// 1.0 .. 10.0 split across two sections
+	for temp := 10; temp <= 100; temp += 10 {
+		if temp%20 == 0 {
+			a1.AddRecord(Record{station: []byte("Oslo"), temp: temp})
+		} else {
+			a2.AddRecord(Record{station: []byte("Oslo"), temp: temp})
+		}
+	}
+	a2.AddRecord(Record{station: []byte("Oslo"), temp: 30})
+
+	ra := NewResultAggregator()
+	ra.stats = StatsHistogram
+	ra.AddPartialResults(a1.cityMeasurements)
+	ra.AddPartialResults(a2.cityMeasurements)
+
+	metrics, err := ra.CalculateMetricsForCity("Oslo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 11 values: 1, 2, 3, 3, 4, ..., 10
+	if metrics.median != 5.0 || metrics.p90 != 9.0 || metrics.p99 != 10.0 || metrics.mode != 3.0 {
+		t.Errorf("got median %v, p90 %v, p99 %v, mode %v, want 5, 9, 10, 3", metrics.median, metrics.p90, metrics.p99, metrics.mode)
+	}
+}
+
+func TestAggregator_SharedHistograms(t *testing.T) {
+	histograms := NewHistograms()
+	a1 := NewMeasurementAggregator()
+	a1.stats, a1.histograms = StatsHistogram, histograms
+	a2 := NewMeasurementAggregator()
+	a2.stats, a2.histograms = StatsHistogram, histograms
+
+	a1.AddRecord(Record{station: []byte("Oslo"), temp: 10})
+	a2.AddRecord(Record{station: []byte("Oslo"), temp: 20})
+	a2.AddRecord(Record{station: []byte("Oslo"), temp: 20})
+
+	// one histogram per station, not one per aggregator
+	if a1.cityMeasurements["Oslo"].histogram != a2.cityMeasurements["Oslo"].histogram || len(histograms.byStation) != 1 {
+		t.Fatalf("expected the aggregators to share the histogram of Oslo")
+	}
+
+	ra := NewResultAggregator()
+	ra.stats = StatsHistogram
+	ra.AddPartialResults(a1.cityMeasurements)
+	ra.AddPartialResults(a2.cityMeasurements)
+
+	// the shared histogram is not added to itself
+	metrics, err := ra.CalculateMetricsForCity("Oslo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metrics.count != 3 || metrics.median != 2.0 || metrics.mode != 2.0 {
+		t.Errorf("got count %d, median %v, mode %v, want 3, 2, 2", metrics.count, metrics.median, metrics.mode)
+	}
+}
+
+func TestMergeExtended_CopiesHistogram(t *testing.T) {
+	other := &AggregatedMeasurements{histogram: new(Histogram)}
+	other.histogram[maxTemperature] = 1
+
+	var m AggregatedMeasurements
+	m.mergeExtended(other)
+	if m.histogram == other.histogram || m.histogram[maxTemperature] != 1 {
+		t.Fatalf("expected a copy of the histogram")
+	}
+
+	m.histogram[maxTemperature]++
+	if other.histogram[maxTemperature] != 1 {
+		t.Errorf("merging into a copy changed the histogram it was copied from")
+	}
+}
+
+func TestExecute_Percentiles(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.txt")
+	outputPath := filepath.Join(dir, "output.csv")
+	if err := os.WriteFile(inputPath, []byte("Oslo;2.0\nOslo;-4.0\nOslo;8.0\nOslo;2.0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{BufferSize: 64, Workers: 2, Format: FormatCSV, Stats: StatsHistogram}
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "station,min,avg,max,count,sum,median,p90,p99,mode\nOslo,-4.0,2.0,8.0,4,8.0,2.0,8.0,8.0,2.0\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// an even count between two different readings, the median is exact
+	if err := os.WriteFile(inputPath, []byte("Oslo;1.0\nOslo;4.0\nOslo;2.0\nOslo;3.0\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err = os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "station,min,avg,max,count,sum,median,p90,p99,mode\nOslo,1.0,2.5,4.0,4,10.0,2.5,4.0,4.0,1.0\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
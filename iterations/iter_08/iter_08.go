@@ -0,0 +1,577 @@
+package iter08
+
+import (
+	"1brc-go/solver"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+type Section struct {
+	start  int64
+	length int64
+}
+
+func CalculateSections(reader io.ReaderAt, dataSize int64, bufferSize int, separator byte, numSections int) ([]Section, error) {
+	chunks := make([]Section, numSections)
+	chunkSize := dataSize / int64(numSections)
+
+	start := int64(0)
+	for i := range numSections {
+		end := dataSize
+		if i < numSections-1 {
+			var err error
+			end, err = nextRecordBoundary(reader, start+chunkSize, bufferSize, separator)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		chunks[i] = Section{start: start, length: end - start}
+		start = end
+	}
+
+	return chunks, nil
+}
+
+// nextRecordBoundary returns the offset just past the first separator at or after targetOffset.
+func nextRecordBoundary(reader io.ReaderAt, targetOffset int64, bufferSize int, separator byte) (int64, error) {
+	peekBuf := make([]byte, bufferSize)
+	n, err := reader.ReadAt(peekBuf, targetOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	idx := bytes.IndexByte(peekBuf[:n], separator)
+	if idx == -1 {
+		return 0, fmt.Errorf("separator not found within %d bytes of offset %d", bufferSize, targetOffset)
+	}
+
+	return targetOffset + int64(idx) + 1, nil
+}
+
+type RecordGenerator struct {
+	ctx           context.Context
+	reader        *io.SectionReader
+	sectionStart  int64
+	sectionOffset int64
+	recordOffset  int64
+	buffer        []byte
+	safeBuffer    []byte
+	separator     byte
+}
+
+// bufferSize must be greater than record size
+// ctx is checked before every buffer refill so a cancelled section stops early
+func NewRecordGenerator(ctx context.Context, reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
+	sectionReader := io.NewSectionReader(reader, section.start, section.length)
+	buffer := make([]byte, bufferSize)
+	return &RecordGenerator{
+		ctx:           ctx,
+		reader:        sectionReader,
+		sectionStart:  section.start,
+		sectionOffset: 0,
+		buffer:        buffer,
+		separator:     separator,
+	}
+}
+
+func (rg *RecordGenerator) readNextChunk() error {
+	if err := rg.ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := rg.reader.ReadAt(rg.buffer, rg.sectionOffset)
+
+	// handle read errors
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read data chunk: %w", err)
+	}
+
+	if n == 0 {
+		return io.EOF
+	}
+
+	dataRead := rg.buffer[:n]
+
+	// adjust end to last record end
+	lastSeparator := bytes.LastIndexByte(dataRead, rg.separator)
+
+	// no record separator found -> should never happen
+	if lastSeparator == -1 {
+		return fmt.Errorf("no separator found in the data chunk.")
+	}
+
+	rg.safeBuffer = dataRead[:lastSeparator+1]
+	rg.sectionOffset += int64(lastSeparator + 1)
+
+	return nil
+}
+
+func (rg *RecordGenerator) ReadRecord() ([]byte, error) {
+
+	// refill buffer if needed
+	if len(rg.safeBuffer) == 0 || rg.safeBuffer == nil {
+		err := rg.readNextChunk()
+		if err != nil {
+			rg.recordOffset = rg.sectionStart + rg.sectionOffset
+			return nil, err
+		}
+	}
+	rg.recordOffset = rg.sectionStart + rg.sectionOffset - int64(len(rg.safeBuffer))
+
+	// find next record end
+	idx := bytes.IndexByte(rg.safeBuffer, rg.separator)
+
+	if idx == -1 {
+		return nil, fmt.Errorf("no record separator found in buffer")
+	}
+
+	record := rg.safeBuffer[:idx]
+	rg.safeBuffer = rg.safeBuffer[idx+1:]
+
+	return record, nil
+}
+
+// Offset returns the absolute input offset of the last record read, or of the
+// position where reading failed
+func (rg *RecordGenerator) Offset() int64 {
+	return rg.recordOffset
+}
+
+// RecordReader returns the records of one section one by one, io.EOF marks
+// the end of the section
+type RecordReader interface {
+	ReadRecord() ([]byte, error)
+	Offset() int64
+}
+
+// the mapped generator has no buffer refills, it checks the context whenever
+// it moved this many bytes past the last check instead
+const ctxCheckInterval = 4 * 1024 * 1024
+
+// MappedRecordGenerator returns the records of a section as sub-slices of the
+// mapped input, nothing is copied
+type MappedRecordGenerator struct {
+	ctx          context.Context
+	data         []byte
+	sectionStart int64
+	position     int
+	nextCheck    int
+	recordOffset int64
+	separator    byte
+}
+
+// data is the whole mapped input, the generator only reads the section
+func NewMappedRecordGenerator(ctx context.Context, data []byte, section Section, separator byte) *MappedRecordGenerator {
+	return &MappedRecordGenerator{
+		ctx:          ctx,
+		data:         data[section.start : section.start+section.length],
+		sectionStart: section.start,
+		separator:    separator,
+	}
+}
+
+func (mg *MappedRecordGenerator) ReadRecord() ([]byte, error) {
+	mg.recordOffset = mg.sectionStart + int64(mg.position)
+
+	if mg.position >= len(mg.data) {
+		return nil, io.EOF
+	}
+
+	if mg.position >= mg.nextCheck {
+		if err := mg.ctx.Err(); err != nil {
+			return nil, err
+		}
+		mg.nextCheck = mg.position + ctxCheckInterval
+	}
+
+	idx := bytes.IndexByte(mg.data[mg.position:], mg.separator)
+	if idx == -1 {
+		return nil, fmt.Errorf("no record separator found in section")
+	}
+
+	record := mg.data[mg.position : mg.position+idx]
+	mg.position += idx + 1
+
+	return record, nil
+}
+
+// Offset returns the absolute input offset of the last record read, or of the
+// position where reading failed
+func (mg *MappedRecordGenerator) Offset() int64 {
+	return mg.recordOffset
+}
+
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	SectionStart int64
+	Offset       int64
+	Line         string
+	Err          error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("section at offset %d: failed at offset %d: %v", e.SectionStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("section at offset %d: record at offset %d %q: %v", e.SectionStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+type Record struct {
+	station []byte
+	temp    int
+}
+
+func ParseRecord(rawRecord []byte) (Record, error) {
+	var record Record
+
+	separatorIdx := bytes.IndexByte(rawRecord, ';')
+	if separatorIdx == -1 {
+		return record, fmt.Errorf("separator ';' not found in record: %s", rawRecord)
+	}
+
+	record.station = rawRecord[:separatorIdx]
+
+	temp, err := parseTemperature(rawRecord[separatorIdx+1:])
+	if err != nil {
+		return record, fmt.Errorf("failed to convert temperature to float: %s in record: %s", rawRecord[separatorIdx+1:], rawRecord)
+	}
+	record.temp = temp
+
+	return record, nil
+}
+
+// temperature can be positive (no sign) or negative (-)
+// temperature -100 < t < 100
+// 1 decimal precision, there is always one and only one decimal place number
+// decimal are separated by . from the integer part
+// it will return the 10x the measurement as an int
+func parseTemperature(temp []byte) (int, error) {
+	// shortest eg 1.1 longest eg -23.5
+	if len(temp) < 3 || len(temp) > 5 {
+		return 0.0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	sign := 1
+	result := 0
+
+	// handle negaitive sign
+	if temp[0] == '-' {
+		sign = -1
+		temp = temp[1:]
+	}
+
+	if len(temp) == 4 {
+		result = 100*(int(temp[0]-'0')) + 10*(int(temp[1]-'0')) + int(temp[3]-'0')
+	} else if len(temp) == 3 {
+		result = 10*(int(temp[0]-'0')) + int(temp[2]-'0')
+	} else {
+		return 0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	return sign * result, nil
+}
+
+type Metrics struct {
+	min float64
+	avg float64
+	max float64
+}
+
+type AggregatedMeasurements struct {
+	min   int
+	max   int
+	sum   int
+	count int
+}
+
+type MeasurementAggregator struct {
+	cityMeasurements map[string]*AggregatedMeasurements
+}
+
+func NewMeasurementAggregator() MeasurementAggregator {
+	cityMeasurements := make(map[string]*AggregatedMeasurements)
+
+	return MeasurementAggregator{cityMeasurements: cityMeasurements}
+}
+
+func (a *MeasurementAggregator) AddRecord(record Record) {
+
+	aggMeasurement, ok := a.cityMeasurements[string(record.station)]
+
+	if !ok { // no previous measurement for the city
+		aggMeasurement := AggregatedMeasurements{
+			min:   record.temp,
+			max:   record.temp,
+			sum:   record.temp,
+			count: 1,
+		}
+
+		a.cityMeasurements[string(record.station)] = &aggMeasurement
+
+	} else { // there's already previous measurements, modify in place
+		aggMeasurement.min = min(aggMeasurement.min, record.temp)
+		aggMeasurement.max = max(aggMeasurement.max, record.temp)
+		aggMeasurement.sum += record.temp
+		aggMeasurement.count++
+	}
+
+}
+
+type ResultAggregator struct {
+	allResults map[string]*AggregatedMeasurements
+}
+
+func NewResultAggregator() ResultAggregator {
+	allResults := make(map[string]*AggregatedMeasurements)
+
+	return ResultAggregator{allResults: allResults}
+}
+
+func (ra *ResultAggregator) AddPartialResults(partialResults map[string]*AggregatedMeasurements) {
+	for k, v := range partialResults {
+		currentMeasurements, ok := ra.allResults[k]
+		if !ok { // no previous measurement for the city, store the pointer directly
+			ra.allResults[k] = v
+		} else { // there's already previous measuremnts, modify in place
+			currentMeasurements.min = min(currentMeasurements.min, v.min)
+			currentMeasurements.max = max(currentMeasurements.max, v.max)
+			currentMeasurements.sum += v.sum
+			currentMeasurements.count += v.count
+		}
+	}
+}
+
+func (ra *ResultAggregator) ListCities() []string {
+	cities := make([]string, 0, len(ra.allResults))
+
+	for k := range ra.allResults {
+		cities = append(cities, k)
+	}
+
+	return cities
+}
+
+func (ra *ResultAggregator) CalculateMetricsForCity(city string) (Metrics, error) {
+	var metrics Metrics
+
+	aggregatedData, ok := ra.allResults[city]
+	if !ok {
+		return metrics, fmt.Errorf("city not found: %s", city)
+	}
+
+	metrics.max = float64(aggregatedData.max) / 10.0
+	metrics.min = float64(aggregatedData.min) / 10.0
+	metrics.avg = float64(aggregatedData.sum) / float64(aggregatedData.count*10)
+
+	return metrics, nil
+}
+
+func RoundToOneDecimal(x float64) float64 {
+	return math.Floor(x*10.0+0.5) / 10.0
+}
+
+func FormatMetrics(city string, metrics Metrics) string {
+	min := RoundToOneDecimal(metrics.min)
+	max := RoundToOneDecimal(metrics.max)
+	avg := RoundToOneDecimal(metrics.avg)
+
+	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
+}
+
+// ProcessSection reads the section through a copying RecordGenerator, it is
+// the fallback when the input cannot be mapped
+func ProcessSection(ctx context.Context, reader io.ReaderAt, chunk Section, bufferSize int) (*MeasurementAggregator, error) {
+	return processRecords(ctx, NewRecordGenerator(ctx, reader, chunk, bufferSize, '\n'), chunk)
+}
+
+// ProcessMappedSection parses the records of the section in place in the mapped input
+func ProcessMappedSection(ctx context.Context, data []byte, chunk Section) (*MeasurementAggregator, error) {
+	return processRecords(ctx, NewMappedRecordGenerator(ctx, data, chunk, '\n'), chunk)
+}
+
+func processRecords(ctx context.Context, recordGenerator RecordReader, chunk Section) (*MeasurementAggregator, error) {
+	aggregator := NewMeasurementAggregator()
+
+	// read and aggregate data
+	for {
+		rawRec, err := recordGenerator.ReadRecord()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Err:          fmt.Errorf("failed reading record: %w", err),
+			}
+		}
+
+		record, err := ParseRecord(rawRec)
+		if err != nil {
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Line:         string(rawRec),
+				Err:          err,
+			}
+		}
+
+		aggregator.AddRecord(record)
+
+	}
+
+	return &aggregator, nil
+}
+
+// mapFile maps the whole input read only, it is a variable so the tests can
+// force the ReadAt fallback
+var mapFile = func(file *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("cannot map input of %d bytes", size)
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map input: %w", err)
+	}
+
+	// the advice only helps the kernel's read ahead, failing it is harmless
+	unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return data, nil
+}
+
+func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int) error {
+
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file at %s: %w", inputPath, err)
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		panic(err)
+	}
+	fileSize := info.Size()
+
+	// fall back to reading through the file when the input cannot be mapped,
+	// e.g. it is empty
+	data, err := mapFile(inputFile, fileSize)
+	if err != nil {
+		data = nil
+	}
+	if data != nil {
+		// the station names are copied into the map keys, nothing refers to
+		// the mapping once the workers are done
+		defer unix.Munmap(data)
+	}
+
+	var reader io.ReaderAt = inputFile
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+
+	chunks, err := CalculateSections(reader, fileSize, 128, '\n', numWorkers)
+	if err != nil {
+		return fmt.Errorf("failed to creat chunks from file: %w", err)
+	}
+
+	// the first failing worker cancels the others and no output is written
+	group, ctx := errgroup.WithContext(context.Background())
+	partialResults := make([]*MeasurementAggregator, len(chunks))
+
+	for i, chunk := range chunks {
+		group.Go(func() error {
+			var res *MeasurementAggregator
+			var err error
+			if data != nil {
+				res, err = ProcessMappedSection(ctx, data, chunk)
+			} else {
+				res, err = ProcessSection(ctx, inputFile, chunk, bufferSize)
+			}
+			if err != nil {
+				return err
+			}
+
+			partialResults[i] = res
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("failed to process input: %w", err)
+	}
+
+	resultAgg := NewResultAggregator()
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
+	}
+
+	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	// write output
+
+	cities := resultAgg.ListCities()
+	slices.Sort(cities)
+
+	var sb strings.Builder
+
+	sb.WriteString("{")
+
+	for i, city := range cities {
+		metrics, err := resultAgg.CalculateMetricsForCity(city)
+		if err != nil {
+			return fmt.Errorf("failed to calculate metrics for city '%s': %w", city, err)
+		}
+
+		formattedOutput := FormatMetrics(city, metrics)
+		sb.WriteString(formattedOutput)
+
+		// don't add separator after last element
+		if i+1 < len(cities) {
+			sb.WriteString(", ")
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	results := sb.String()
+
+	_, err = outputFile.WriteString(results)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func init() {
+	// BufferSize is only used by the ReadAt fallback
+	solver.Register("iter_08", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize, opts.Workers)
+	})
+}
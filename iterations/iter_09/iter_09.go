@@ -0,0 +1,538 @@
+package iter09
+
+import (
+	"1brc-go/solver"
+	"1brc-go/stationtable"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+type Section struct {
+	start  int64
+	length int64
+}
+
+func CalculateSections(reader io.ReaderAt, dataSize int64, bufferSize int, separator byte, numSections int) ([]Section, error) {
+	chunks := make([]Section, numSections)
+	chunkSize := dataSize / int64(numSections)
+
+	start := int64(0)
+	for i := range numSections {
+		end := dataSize
+		if i < numSections-1 {
+			var err error
+			end, err = nextRecordBoundary(reader, start+chunkSize, bufferSize, separator)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		chunks[i] = Section{start: start, length: end - start}
+		start = end
+	}
+
+	return chunks, nil
+}
+
+// nextRecordBoundary returns the offset just past the first separator at or after targetOffset.
+func nextRecordBoundary(reader io.ReaderAt, targetOffset int64, bufferSize int, separator byte) (int64, error) {
+	peekBuf := make([]byte, bufferSize)
+	n, err := reader.ReadAt(peekBuf, targetOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	idx := bytes.IndexByte(peekBuf[:n], separator)
+	if idx == -1 {
+		return 0, fmt.Errorf("separator not found within %d bytes of offset %d", bufferSize, targetOffset)
+	}
+
+	return targetOffset + int64(idx) + 1, nil
+}
+
+type RecordGenerator struct {
+	ctx           context.Context
+	reader        *io.SectionReader
+	sectionStart  int64
+	sectionOffset int64
+	recordOffset  int64
+	buffer        []byte
+	safeBuffer    []byte
+	separator     byte
+}
+
+// bufferSize must be greater than record size
+// ctx is checked before every buffer refill so a cancelled section stops early
+func NewRecordGenerator(ctx context.Context, reader io.ReaderAt, section Section, bufferSize int, separator byte) *RecordGenerator {
+	sectionReader := io.NewSectionReader(reader, section.start, section.length)
+	buffer := make([]byte, bufferSize)
+	return &RecordGenerator{
+		ctx:           ctx,
+		reader:        sectionReader,
+		sectionStart:  section.start,
+		sectionOffset: 0,
+		buffer:        buffer,
+		separator:     separator,
+	}
+}
+
+func (rg *RecordGenerator) readNextChunk() error {
+	if err := rg.ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := rg.reader.ReadAt(rg.buffer, rg.sectionOffset)
+
+	// handle read errors
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read data chunk: %w", err)
+	}
+
+	if n == 0 {
+		return io.EOF
+	}
+
+	dataRead := rg.buffer[:n]
+
+	// adjust end to last record end
+	lastSeparator := bytes.LastIndexByte(dataRead, rg.separator)
+
+	// no record separator found -> should never happen
+	if lastSeparator == -1 {
+		return fmt.Errorf("no separator found in the data chunk.")
+	}
+
+	rg.safeBuffer = dataRead[:lastSeparator+1]
+	rg.sectionOffset += int64(lastSeparator + 1)
+
+	return nil
+}
+
+// ReadBlock returns the next buffer of complete records and its absolute
+// offset in the input, the block is only valid until the next call
+func (rg *RecordGenerator) ReadBlock() ([]byte, int64, error) {
+	if err := rg.readNextChunk(); err != nil {
+		rg.recordOffset = rg.sectionStart + rg.sectionOffset
+		return nil, rg.recordOffset, err
+	}
+	rg.recordOffset = rg.sectionStart + rg.sectionOffset - int64(len(rg.safeBuffer))
+
+	return rg.safeBuffer, rg.recordOffset, nil
+}
+
+// Offset returns the absolute input offset of the last block read, or of the
+// position where reading failed
+func (rg *RecordGenerator) Offset() int64 {
+	return rg.recordOffset
+}
+
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	SectionStart int64
+	Offset       int64
+	Line         string
+	Err          error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("section at offset %d: failed at offset %d: %v", e.SectionStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("section at offset %d: record at offset %d %q: %v", e.SectionStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+type Record struct {
+	station []byte
+	hash    uint64
+	temp    int
+}
+
+func ParseRecord(rawRecord []byte) (Record, error) {
+	var record Record
+
+	separatorIdx := bytes.IndexByte(rawRecord, ';')
+	if separatorIdx == -1 {
+		return record, fmt.Errorf("separator ';' not found in record: %s", rawRecord)
+	}
+
+	record.station = rawRecord[:separatorIdx]
+	record.hash = hashStation(record.station)
+
+	temp, err := parseTemperature(rawRecord[separatorIdx+1:])
+	if err != nil {
+		return record, fmt.Errorf("failed to convert temperature to float: %s in record: %s", rawRecord[separatorIdx+1:], rawRecord)
+	}
+	record.temp = temp
+
+	return record, nil
+}
+
+// temperature can be positive (no sign) or negative (-)
+// temperature -100 < t < 100
+// 1 decimal precision, there is always one and only one decimal place number
+// decimal are separated by . from the integer part
+// it will return the 10x the measurement as an int
+func parseTemperature(temp []byte) (int, error) {
+	// shortest eg 1.1 longest eg -23.5
+	if len(temp) < 3 || len(temp) > 5 {
+		return 0.0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	sign := 1
+	result := 0
+
+	// handle negaitive sign
+	if temp[0] == '-' {
+		sign = -1
+		temp = temp[1:]
+	}
+
+	if len(temp) == 4 {
+		result = 100*(int(temp[0]-'0')) + 10*(int(temp[1]-'0')) + int(temp[3]-'0')
+	} else if len(temp) == 3 {
+		result = 10*(int(temp[0]-'0')) + int(temp[2]-'0')
+	} else {
+		return 0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	return sign * result, nil
+}
+
+type Metrics struct {
+	min float64
+	avg float64
+	max float64
+}
+
+type AggregatedMeasurements struct {
+	min   int
+	max   int
+	sum   int
+	count int
+}
+
+type MeasurementAggregator struct {
+	cityMeasurements *stationtable.Table[AggregatedMeasurements]
+}
+
+func NewMeasurementAggregator() MeasurementAggregator {
+	cityMeasurements := stationtable.New[AggregatedMeasurements](stationtable.DefaultCapacity)
+
+	return MeasurementAggregator{cityMeasurements: cityMeasurements}
+}
+
+func (a *MeasurementAggregator) AddRecord(record Record) error {
+
+	aggMeasurement, inserted := a.cityMeasurements.GetOrInsert(record.station, record.hash)
+
+	if aggMeasurement == nil {
+		return fmt.Errorf("more than %d stations", stationtable.DefaultCapacity)
+	}
+
+	if inserted { // no previous measurement for the city
+		*aggMeasurement = AggregatedMeasurements{
+			min:   record.temp,
+			max:   record.temp,
+			sum:   record.temp,
+			count: 1,
+		}
+
+	} else { // there's already previous measurements, modify in place
+		aggMeasurement.min = min(aggMeasurement.min, record.temp)
+		aggMeasurement.max = max(aggMeasurement.max, record.temp)
+		aggMeasurement.sum += record.temp
+		aggMeasurement.count++
+	}
+
+	return nil
+}
+
+type ResultAggregator struct {
+	allResults map[string]*AggregatedMeasurements
+}
+
+func NewResultAggregator() ResultAggregator {
+	allResults := make(map[string]*AggregatedMeasurements)
+
+	return ResultAggregator{allResults: allResults}
+}
+
+func (ra *ResultAggregator) AddPartialResults(partialResults *stationtable.Table[AggregatedMeasurements]) {
+	for k, v := range partialResults.All() {
+		currentMeasurements, ok := ra.allResults[string(k)]
+		if !ok { // no previous measurement for the city, copy it out of the table
+			measurements := *v
+			ra.allResults[string(k)] = &measurements
+		} else { // there's already previous measuremnts, modify in place
+			currentMeasurements.min = min(currentMeasurements.min, v.min)
+			currentMeasurements.max = max(currentMeasurements.max, v.max)
+			currentMeasurements.sum += v.sum
+			currentMeasurements.count += v.count
+		}
+	}
+}
+
+func (ra *ResultAggregator) ListCities() []string {
+	cities := make([]string, 0, len(ra.allResults))
+
+	for k := range ra.allResults {
+		cities = append(cities, k)
+	}
+
+	return cities
+}
+
+func (ra *ResultAggregator) CalculateMetricsForCity(city string) (Metrics, error) {
+	var metrics Metrics
+
+	aggregatedData, ok := ra.allResults[city]
+	if !ok {
+		return metrics, fmt.Errorf("city not found: %s", city)
+	}
+
+	metrics.max = float64(aggregatedData.max) / 10.0
+	metrics.min = float64(aggregatedData.min) / 10.0
+	metrics.avg = float64(aggregatedData.sum) / float64(aggregatedData.count*10)
+
+	return metrics, nil
+}
+
+func RoundToOneDecimal(x float64) float64 {
+	return math.Floor(x*10.0+0.5) / 10.0
+}
+
+func FormatMetrics(city string, metrics Metrics) string {
+	min := RoundToOneDecimal(metrics.min)
+	max := RoundToOneDecimal(metrics.max)
+	avg := RoundToOneDecimal(metrics.avg)
+
+	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
+}
+
+// ProcessSection reads the section through a copying RecordGenerator, it is
+// the fallback when the input cannot be mapped
+func ProcessSection(ctx context.Context, reader io.ReaderAt, chunk Section, bufferSize int) (*MeasurementAggregator, error) {
+	recordGenerator := NewRecordGenerator(ctx, reader, chunk, bufferSize, '\n')
+	aggregator := NewMeasurementAggregator()
+
+	for {
+		block, blockStart, err := recordGenerator.ReadBlock()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			return nil, &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Err:          fmt.Errorf("failed reading record: %w", err),
+			}
+		}
+
+		if err := processBlock(ctx, block, blockStart, chunk, &aggregator); err != nil {
+			return nil, err
+		}
+	}
+
+	return &aggregator, nil
+}
+
+// ProcessMappedSection scans the records of the section in place in the mapped input
+func ProcessMappedSection(ctx context.Context, data []byte, chunk Section) (*MeasurementAggregator, error) {
+	aggregator := NewMeasurementAggregator()
+
+	block := data[chunk.start : chunk.start+chunk.length]
+	if err := processBlock(ctx, block, chunk.start, chunk, &aggregator); err != nil {
+		return nil, err
+	}
+
+	return &aggregator, nil
+}
+
+// the mapped sections have no buffer refills, so the context is also checked
+// whenever the scanner moved this many bytes past the last check
+const ctxCheckInterval = 4 * 1024 * 1024
+
+// processBlock aggregates a block of complete records starting at blockStart
+// in the input
+func processBlock(ctx context.Context, block []byte, blockStart int64, chunk Section, aggregator *MeasurementAggregator) error {
+	scanner := NewRecordScanner(block)
+	nextCheck := 0
+
+	for {
+		if scanner.pos >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			nextCheck = scanner.pos + ctxCheckInterval
+		}
+
+		record, err := scanner.Next()
+		if err == nil {
+			err = aggregator.AddRecord(record)
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return &RecordError{
+				SectionStart: chunk.start,
+				Offset:       blockStart + int64(scanner.Offset()),
+				Line:         string(scanner.Line()),
+				Err:          err,
+			}
+		}
+	}
+}
+
+// mapFile maps the whole input read only, it is a variable so the tests can
+// force the ReadAt fallback
+var mapFile = func(file *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("cannot map input of %d bytes", size)
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map input: %w", err)
+	}
+
+	// the advice only helps the kernel's read ahead, failing it is harmless
+	unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return data, nil
+}
+
+func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int) error {
+
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file at %s: %w", inputPath, err)
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		panic(err)
+	}
+	fileSize := info.Size()
+
+	// fall back to reading through the file when the input cannot be mapped,
+	// e.g. it is empty
+	data, err := mapFile(inputFile, fileSize)
+	if err != nil {
+		data = nil
+	}
+	if data != nil {
+		// the station names are copied into the map keys, nothing refers to
+		// the mapping once the workers are done
+		defer unix.Munmap(data)
+	}
+
+	var reader io.ReaderAt = inputFile
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+
+	chunks, err := CalculateSections(reader, fileSize, 128, '\n', numWorkers)
+	if err != nil {
+		return fmt.Errorf("failed to creat chunks from file: %w", err)
+	}
+
+	// the first failing worker cancels the others and no output is written
+	group, ctx := errgroup.WithContext(context.Background())
+	partialResults := make([]*MeasurementAggregator, len(chunks))
+
+	for i, chunk := range chunks {
+		group.Go(func() error {
+			var res *MeasurementAggregator
+			var err error
+			if data != nil {
+				res, err = ProcessMappedSection(ctx, data, chunk)
+			} else {
+				res, err = ProcessSection(ctx, inputFile, chunk, bufferSize)
+			}
+			if err != nil {
+				return err
+			}
+
+			partialResults[i] = res
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("failed to process input: %w", err)
+	}
+
+	resultAgg := NewResultAggregator()
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
+	}
+
+	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	// write output
+
+	cities := resultAgg.ListCities()
+	slices.Sort(cities)
+
+	var sb strings.Builder
+
+	sb.WriteString("{")
+
+	for i, city := range cities {
+		metrics, err := resultAgg.CalculateMetricsForCity(city)
+		if err != nil {
+			return fmt.Errorf("failed to calculate metrics for city '%s': %w", city, err)
+		}
+
+		formattedOutput := FormatMetrics(city, metrics)
+		sb.WriteString(formattedOutput)
+
+		// don't add separator after last element
+		if i+1 < len(cities) {
+			sb.WriteString(", ")
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	results := sb.String()
+
+	_, err = outputFile.WriteString(results)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func init() {
+	// BufferSize is only used by the ReadAt fallback
+	solver.Register("iter_09", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		return Execute(inputPath, outputPath, opts.BufferSize, opts.Workers)
+	})
+}
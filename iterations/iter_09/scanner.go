@@ -0,0 +1,193 @@
+package iter09
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// SWAR (SIMD within a register) constants, every byte of a word is handled at once
+const (
+	ones       = 0x0101010101010101
+	highBits   = 0x8080808080808080
+	semicolons = ';' * ones
+	newlines   = '\n' * ones
+
+	lowNibbles  = 0x0F0F0F0F0F0F0F0F
+	highNibbles = 0xF0F0F0F0F0F0F0F0
+	zeroDigits  = '0' * ones
+	sixes       = 0x0606060606060606
+)
+
+// word hash, FNV-1a constants applied to 8 bytes at a time
+const (
+	hashOffset = 14695981039346656037
+	hashPrime  = 1099511628211
+)
+
+// load returns the 8 bytes at i as a little endian word, zero padded past the end of data
+func load(data []byte, i int) uint64 {
+	if i+8 <= len(data) {
+		return binary.LittleEndian.Uint64(data[i:])
+	}
+
+	var buf [8]byte
+	copy(buf[:], data[i:])
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// zeroBytes has the high bit set for the zero bytes of x, only the lowest one
+// is exact because of the borrow, which is all the scanner needs
+func zeroBytes(x uint64) uint64 {
+	return (x - ones) &^ x & highBits
+}
+
+func mixWord(h uint64, word uint64) uint64 {
+	return (h ^ word) * hashPrime
+}
+
+// finishHash folds the high bits in, the table only uses the low bits
+func finishHash(h uint64) uint64 {
+	return h ^ (h >> 32)
+}
+
+// hashStation returns the hash RecordScanner computes for a station
+func hashStation(station []byte) uint64 {
+	h := uint64(hashOffset)
+	i := 0
+	for ; i+8 <= len(station); i += 8 {
+		h = mixWord(h, binary.LittleEndian.Uint64(station[i:]))
+	}
+	if i < len(station) {
+		h = mixWord(h, load(station, i))
+	}
+	return finishHash(h)
+}
+
+// RecordScanner is a drop-in replacement for ReadRecord followed by
+// ParseRecord on a block of complete records. It reads 8 bytes at a time to
+// find the ';', hashes the station in the same pass and decodes the
+// temperature without branching on its length. Anything that does not look
+// like a well-formed record is handed to ParseRecord, so malformed records
+// fail with the same errors.
+type RecordScanner struct {
+	data        []byte
+	pos         int
+	recordStart int
+}
+
+// data must only contain complete, '\n' terminated records
+func NewRecordScanner(data []byte) *RecordScanner {
+	return &RecordScanner{data: data}
+}
+
+// Offset returns the offset in the block of the last record scanned
+func (s *RecordScanner) Offset() int {
+	return s.recordStart
+}
+
+// Line returns the raw bytes of the last record scanned, without the '\n'
+func (s *RecordScanner) Line() []byte {
+	line := s.data[s.recordStart:]
+	if idx := bytes.IndexByte(line, '\n'); idx != -1 {
+		line = line[:idx]
+	}
+	return line
+}
+
+// Next returns the next record, io.EOF at the end of the block
+func (s *RecordScanner) Next() (Record, error) {
+	start := s.pos
+	s.recordStart = start
+	if start >= len(s.data) {
+		return Record{}, io.EOF
+	}
+
+	// find the ';' and hash the station word by word
+	h := uint64(hashOffset)
+	sep := start
+	for {
+		if sep >= len(s.data) {
+			return s.slowPath(start)
+		}
+
+		word := load(s.data, sep)
+		semicolon := zeroBytes(word ^ semicolons)
+		newline := zeroBytes(word ^ newlines)
+
+		if semicolon != 0 {
+			// a '\n' before the ';' means the record has no separator
+			if newline != 0 && bits.TrailingZeros64(newline) < bits.TrailingZeros64(semicolon) {
+				return s.slowPath(start)
+			}
+
+			n := bits.TrailingZeros64(semicolon) >> 3
+			if n > 0 {
+				h = mixWord(h, word&(1<<(8*n)-1))
+			}
+			sep += n
+			break
+		}
+		if newline != 0 {
+			return s.slowPath(start)
+		}
+
+		h = mixWord(h, word)
+		sep += 8
+	}
+
+	if sep == start {
+		return s.slowPath(start)
+	}
+
+	// decode the temperature, e.g. "-12.3\n" or "1.2\n" in the low bytes of the word
+	word := load(s.data, sep+1)
+
+	// '.' is the only byte of a valid temperature with bit 4 unset, apart
+	// from the sign, which is always the first byte
+	dot := bits.TrailingZeros64(^word & 0x10101000)
+	negative := int64(^word<<59) >> 63 // -1 for '-', 0 for a digit
+	signBit := int(negative & 1)
+
+	// the dot is at byte 1 or 2 without a sign and at byte 2 or 3 with one
+	if d := dot - 8*signBit; d != 12 && d != 20 {
+		return s.slowPath(start)
+	}
+
+	length := dot>>3 + 2
+	if byte(word>>(dot&^7)) != '.' || byte(word>>(8*length)) != '\n' || (negative != 0 && byte(word) != '-') {
+		return s.slowPath(start)
+	}
+
+	// every byte of the temperature apart from the sign and the '.' must be a digit
+	digitMask := uint64(1)<<(8*length) - 1
+	digitMask &^= 0xFF << (dot &^ 7)
+	digitMask &^= uint64(negative) & 0xFF
+	if ((word^zeroDigits)&highNibbles|((word&lowNibbles)+sixes)&highNibbles)&digitMask != 0 {
+		return s.slowPath(start)
+	}
+
+	// align the digits so the integer part lands in bytes 1 and 2 and the
+	// decimal in byte 4, then combine them with a single multiplication
+	digits := ((word &^ (uint64(negative) & 0xFF)) << (28 - dot)) & 0x0F000F0F00
+	abs := int64(((digits * 0x640a0001) >> 32) & 0x3FF)
+	temp := (abs ^ negative) - negative
+
+	s.pos = sep + 1 + length + 1
+
+	return Record{station: s.data[start:sep], hash: finishHash(h), temp: int(temp)}, nil
+}
+
+// slowPath parses the record at start with ParseRecord
+func (s *RecordScanner) slowPath(start int) (Record, error) {
+	end := bytes.IndexByte(s.data[start:], '\n')
+	if end == -1 {
+		s.pos = len(s.data)
+		return Record{}, fmt.Errorf("no record separator found in block")
+	}
+	s.pos = start + end + 1
+
+	return ParseRecord(s.data[start : start+end])
+}
@@ -0,0 +1,179 @@
+package iter09
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// temperatureString formats tenths the way they appear in the input
+func temperatureString(tenths int) string {
+	sign := ""
+	if tenths < 0 {
+		sign = "-"
+		tenths = -tenths
+	}
+	return fmt.Sprintf("%s%d.%d", sign, tenths/10, tenths%10)
+}
+
+// TestRecordScanner_AllTemperatures decodes every temperature in [-99.9, 99.9]
+// at every alignment relative to the 8 byte words and compares it with
+// parseTemperature
+func TestRecordScanner_AllTemperatures(t *testing.T) {
+	for tenths := -999; tenths <= 999; tenths++ {
+		raw := temperatureString(tenths)
+		want, err := parseTemperature([]byte(raw))
+		if err != nil {
+			t.Fatalf("parseTemperature(%q) failed: %v", raw, err)
+		}
+
+		for stationLength := 1; stationLength <= 9; stationLength++ {
+			station := strings.Repeat("x", stationLength)
+			// the second record ends the block, so the zero padded tail is covered too
+			data := []byte(station + ";" + raw + "\n" + station + ";" + raw + "\n")
+
+			scanner := NewRecordScanner(data)
+			for i := range 2 {
+				record, err := scanner.Next()
+				if err != nil {
+					t.Fatalf("%q record %d: unexpected error: %v", data, i, err)
+				}
+				if record.temp != want {
+					t.Fatalf("%q record %d: got %d, want %d", data, i, record.temp, want)
+				}
+				if string(record.station) != station {
+					t.Fatalf("%q record %d: got station %q, want %q", data, i, record.station, station)
+				}
+			}
+			if _, err := scanner.Next(); err != io.EOF {
+				t.Fatalf("%q: expected io.EOF, got %v", data, err)
+			}
+		}
+	}
+
+	// negative zero is accepted by parseTemperature as well
+	record, err := NewRecordScanner([]byte("x;-0.0\n")).Next()
+	if err != nil || record.temp != 0 {
+		t.Errorf("got %d, %v for -0.0, want 0", record.temp, err)
+	}
+}
+
+func TestRecordScanner_HashMatchesHashStation(t *testing.T) {
+	name := "Some very long station name, with unicode: Petén, Ürümqi, Zürich"
+	for length := 1; length <= len(name); length++ {
+		station := name[:length]
+		data := []byte("Oslo;1.0\n" + station + ";12.3\n")
+
+		scanner := NewRecordScanner(data)
+		scanner.Next()
+		record, err := scanner.Next()
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", station, err)
+		}
+		if string(record.station) != station {
+			t.Fatalf("got station %q, want %q", record.station, station)
+		}
+		if record.hash != hashStation([]byte(station)) {
+			t.Errorf("%q: scanner hash differs from hashStation", station)
+		}
+	}
+}
+
+func TestRecordScanner_MalformedRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing separator", "Hamburg12.3\nOslo;1.0\n"},
+		{"missing separator in a long record", "Some long station name 12.3\nOslo;1.0\n"},
+		{"temperature too long", "Hamburg;123.4\n"},
+		{"temperature too short", "Hamburg;1.\n"},
+		{"missing final separator", "Hamburg;12.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewRecordScanner([]byte(tt.data))
+
+			_, err := scanner.Next()
+			if err == nil {
+				t.Fatalf("expected error for %q", tt.data)
+			}
+			if scanner.Offset() != 0 {
+				t.Errorf("got offset %d, want 0", scanner.Offset())
+			}
+			if want, _, _ := strings.Cut(tt.data, "\n"); string(scanner.Line()) != want {
+				t.Errorf("got line %q, want %q", scanner.Line(), want)
+			}
+		})
+	}
+}
+
+// malformed temperatures the word decoder cannot handle are handed to
+// ParseRecord and must give the same result
+func TestRecordScanner_SlowPathMatchesParseRecord(t *testing.T) {
+	for _, raw := range []string{"Oslo;-.5", "Oslo;1a.3", "Oslo;+1.3", "Oslo;1234", ";1.0"} {
+		want, wantErr := ParseRecord([]byte(raw))
+		got, gotErr := NewRecordScanner([]byte(raw + "\n")).Next()
+
+		if (gotErr != nil) != (wantErr != nil) {
+			t.Errorf("%q: got error %v, want %v", raw, gotErr, wantErr)
+			continue
+		}
+		if gotErr == nil && (got.temp != want.temp || string(got.station) != string(want.station)) {
+			t.Errorf("%q: got %+v, want %+v", raw, got, want)
+		}
+	}
+}
+
+func TestProcessBlock_RecordErrorOffset(t *testing.T) {
+	block := []byte("Hamburg;12.3\nRome9.9\n")
+	aggregator := NewMeasurementAggregator()
+
+	// the block starts at offset 100 in the input
+	err := processBlock(t.Context(), block, 100, Section{start: 50, length: 200}, &aggregator)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.SectionStart != 50 || recordErr.Offset != 113 || recordErr.Line != "Rome9.9" {
+		t.Errorf("got %+v, want section 50, offset 113, line Rome9.9", recordErr)
+	}
+}
+
+func BenchmarkRecordScanner(b *testing.B) {
+	data := []byte(strings.Repeat("Hamburg;12.3\nBulawayo;8.9\nPalembang;-38.8\nSt. John's;15.2\nCracow;-0.4\n", 1000))
+
+	b.Run("ReadRecord+ParseRecord", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			rest := data
+			for len(rest) > 0 {
+				idx := bytes.IndexByte(rest, '\n')
+				if _, err := ParseRecord(rest[:idx]); err != nil {
+					b.Fatal(err)
+				}
+				rest = rest[idx+1:]
+			}
+		}
+	})
+
+	b.Run("RecordScanner", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			scanner := NewRecordScanner(data)
+			for {
+				if _, err := scanner.Next(); err != nil {
+					if err == io.EOF {
+						break
+					}
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
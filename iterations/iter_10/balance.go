@@ -0,0 +1,56 @@
+package iter10
+
+import (
+	"fmt"
+	"time"
+)
+
+// WorkerStats is the work one pool worker took from the queue
+type WorkerStats struct {
+	Sections int
+	Bytes    int64
+	Busy     time.Duration
+}
+
+// Balance tells how evenly the sections were spread over the pool
+type Balance struct {
+	Sections int
+	Workers  []WorkerStats
+}
+
+// Imbalance is the busiest worker's time relative to the average, 1.0 means
+// every worker was busy for the same time
+func (b Balance) Imbalance() float64 {
+	if len(b.Workers) == 0 {
+		return 0
+	}
+
+	var total, busiest time.Duration
+	for _, w := range b.Workers {
+		total += w.Busy
+		busiest = max(busiest, w.Busy)
+	}
+	if total == 0 {
+		return 1
+	}
+
+	return float64(busiest) / (float64(total) / float64(len(b.Workers)))
+}
+
+func (b Balance) String() string {
+	if len(b.Workers) == 0 {
+		return "no workers"
+	}
+
+	minSections, maxSections := b.Workers[0].Sections, b.Workers[0].Sections
+	minBusy, maxBusy := b.Workers[0].Busy, b.Workers[0].Busy
+	for _, w := range b.Workers[1:] {
+		minSections = min(minSections, w.Sections)
+		maxSections = max(maxSections, w.Sections)
+		minBusy = min(minBusy, w.Busy)
+		maxBusy = max(maxBusy, w.Busy)
+	}
+
+	return fmt.Sprintf("%d sections on %d workers | Sections/worker: %d-%d | Busy: %s-%s | Imbalance: %.2f",
+		b.Sections, len(b.Workers), minSections, maxSections, minBusy.Round(time.Millisecond), maxBusy.Round(time.Millisecond), b.Imbalance())
+}
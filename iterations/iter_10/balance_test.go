@@ -0,0 +1,107 @@
+package iter10
+
+import (
+	"1brc-go/solver"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBalance_Imbalance(t *testing.T) {
+	even := Balance{Workers: []WorkerStats{{Busy: time.Second}, {Busy: time.Second}}}
+	if got := even.Imbalance(); got != 1 {
+		t.Errorf("got imbalance %v for an even split, want 1", got)
+	}
+
+	// one worker did all the work: max / mean = 3s / 1.5s
+	skewed := Balance{Workers: []WorkerStats{{Busy: 3 * time.Second}, {}}}
+	if got := skewed.Imbalance(); got != 2 {
+		t.Errorf("got imbalance %v, want 2", got)
+	}
+
+	if got := (Balance{}).Imbalance(); got != 0 {
+		t.Errorf("got imbalance %v without workers, want 0", got)
+	}
+}
+
+func TestExecute_EverySectionProcessedOnce(t *testing.T) {
+	inputPath := writeTestInput(t, 20_000)
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: 1024, Workers: 3, SectionSize: 8 * 1024})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(balance.Workers) != 3 {
+		t.Fatalf("got %d workers, want 3", len(balance.Workers))
+	}
+	if balance.Sections <= len(balance.Workers) {
+		t.Errorf("expected more sections than workers, got %d", balance.Sections)
+	}
+
+	sections, bytes := 0, int64(0)
+	for _, w := range balance.Workers {
+		sections += w.Sections
+		bytes += w.Bytes
+	}
+	if sections != balance.Sections {
+		t.Errorf("workers processed %d sections, want %d", sections, balance.Sections)
+	}
+	if bytes != info.Size() {
+		t.Errorf("workers processed %d bytes, want %d", bytes, info.Size())
+	}
+}
+
+func TestExecute_DefaultsToGOMAXPROCS(t *testing.T) {
+	inputPath := writeTestInput(t, 1_000)
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+	balance, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: 1024})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := runtime.GOMAXPROCS(0); len(balance.Workers) != want {
+		t.Errorf("got %d workers, want GOMAXPROCS %d", len(balance.Workers), want)
+	}
+}
+
+func TestPrintBalance_OnlyWithKnob(t *testing.T) {
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+
+	balance := Balance{Sections: 2, Workers: []WorkerStats{{Sections: 2, Bytes: 10, Busy: time.Millisecond}}}
+	for _, tt := range []struct {
+		knobs string
+		want  string
+	}{
+		{"", ""},
+		{"balance=0", ""},
+		{"balance=1", "2 sections on 1 workers"},
+	} {
+		file, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stderr = file
+		printBalance(solver.Options{Knobs: tt.knobs}, balance)
+		file.Close()
+
+		got, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == "" && len(got) != 0 || !strings.Contains(string(got), tt.want) {
+			t.Errorf("knobs %q: got %q, want %q", tt.knobs, got, tt.want)
+		}
+	}
+}
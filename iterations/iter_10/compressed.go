@@ -0,0 +1,329 @@
+package iter10
+
+import (
+	"1brc-go/decompress"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// aggregateCompressed aggregates a gzip or bzip2 input. Multi-member gzip
+// inputs are split at member starts and every range is decompressed by its
+// own worker, everything else is decompressed by the single reader of
+// AggregateStream.
+func aggregateCompressed(ctx context.Context, input io.ReaderAt, size int64, compression decompress.Compression, opts Options) (*Result, error) {
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	var starts []int64
+	if compression == decompress.Gzip && numWorkers > 1 {
+		var err error
+		if starts, err = decompress.MemberStarts(input, size, numWorkers); err != nil {
+			return nil, err
+		}
+	}
+	return aggregateStarts(ctx, input, size, starts, opts)
+}
+
+// aggregateStarts aggregates the member ranges between starts, or the whole
+// input in the sequential reader when there is only one range or one of them
+// fails to decode
+func aggregateStarts(ctx context.Context, input io.ReaderAt, size int64, starts []int64, opts Options) (*Result, error) {
+	// the progress line of the member ranges goes on in the sequential reader
+	if opts.Progress != nil {
+		opts.Progress.Start(-1)
+		defer opts.Progress.Finish()
+		opts.Progress = startedProgress{opts.Progress}
+	}
+
+	if len(starts) > 1 {
+		result, err := aggregateMembers(ctx, input, size, starts, opts)
+		var decodeErr *decodeError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &decodeErr) {
+			return result, err
+		}
+		// a member start that decoded its first bytes can still be a
+		// wrong guess, which fails to decode later. The sequential reader
+		// decides whether the input itself is broken and reports the error.
+	}
+
+	return AggregateStream(ctx, io.NewSectionReader(input, 0, size), opts)
+}
+
+// startedProgress is a Progress started and finished by the caller
+type startedProgress struct {
+	Progress
+}
+
+func (startedProgress) Start(int64) {}
+
+func (startedProgress) Finish() {}
+
+// pendingProgress holds back the progress of the member ranges until they are
+// known to be decoded for good, a wrong member start decodes the input again
+// and its bytes and rows would be counted twice
+type pendingProgress struct {
+	bytes atomic.Int64
+	rows  atomic.Int64
+}
+
+func (*pendingProgress) Start(int64) {}
+
+func (p *pendingProgress) Add(bytes int64, rows int64) {
+	p.bytes.Add(bytes)
+	p.rows.Add(rows)
+}
+
+func (*pendingProgress) Finish() {}
+
+// flush reports the bytes and rows held back to progress, when not nil
+func (p *pendingProgress) flush(progress Progress) {
+	if progress != nil {
+		progress.Add(p.bytes.Load(), p.rows.Load())
+	}
+}
+
+// decodeError is a failure to decompress the data of a range. A wrongly
+// guessed member start shows up as one, either at the start of the range or
+// at its end, unlike a record error of the decoded data.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// memberRange is the decoded data of the gzip members between two member
+// starts. Records can cross from one range into the next, so the bytes up to
+// the first and after the last newline are kept to be joined with the
+// neighbouring ranges.
+type memberRange struct {
+	start int64
+	end   int64
+	// up to and including the first newline, the whole range when it has none
+	head       []byte
+	tail       []byte
+	hasNewline bool
+	// the records of the range
+	aggregator MeasurementAggregator
+	// the record error that stopped the range, see settle
+	err error
+}
+
+// memberRanges cuts the input of size bytes at the member starts
+func memberRanges(starts []int64, size int64) []memberRange {
+	ranges := make([]memberRange, len(starts))
+	for i, start := range starts {
+		ranges[i] = memberRange{start: start, end: size, aggregator: NewMeasurementAggregator()}
+		if i+1 < len(starts) {
+			ranges[i].end = starts[i+1]
+		}
+	}
+	return ranges
+}
+
+// settle keeps a record error on the range and returns any other error. Data
+// decoded from a wrongly guessed member start can look like a broken record,
+// so the error only counts once the ranges before it are known to end at
+// member boundaries, see joinMemberRanges.
+func (rng *memberRange) settle(err error) error {
+	var recordErr *RecordError
+	if errors.As(err, &recordErr) {
+		rng.err = err
+		return nil
+	}
+	return err
+}
+
+// aggregateMembers decompresses and aggregates every member range in its own
+// worker, then joins the records crossing the ranges
+func aggregateMembers(ctx context.Context, input io.ReaderAt, size int64, starts []int64, opts Options) (*Result, error) {
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultSectionSize
+	}
+	format, err := opts.RecordFormat.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := memberRanges(starts, size)
+	balance := Balance{Sections: len(ranges), Workers: make([]WorkerStats, len(ranges))}
+
+	var progress Progress
+	pending := &pendingProgress{}
+	if opts.Progress != nil {
+		progress = pending
+	}
+
+	// the first decode error cancels the other ranges, the input is read
+	// sequentially then
+	group, groupCtx := errgroup.WithContext(ctx)
+	partialResults := make([]*MeasurementAggregator, len(ranges))
+
+	for i := range ranges {
+		group.Go(func() error {
+			started := time.Now()
+			rng := &ranges[i]
+			err := doSection(groupCtx, opts.StageLabels, strconv.Itoa(i), rng.start, func(ctx context.Context) error {
+				return aggregateRange(ctx, input, rng, i == 0, make([]byte, bufferSize), format, &rng.aggregator, progress)
+			})
+
+			balance.Workers[i] = WorkerStats{Sections: 1, Bytes: rng.end - rng.start, Busy: time.Since(started)}
+			partialResults[i] = &rng.aggregator
+			return rng.settle(err)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, poolError(ctx, err)
+	}
+
+	rows := partialResults[0].rows
+	if err := joinMemberRanges(ctx, ranges, format, partialResults[0]); err != nil {
+		return nil, fmt.Errorf("failed to process input: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// the joined records count as well
+	pending.Add(0, partialResults[0].rows-rows)
+	pending.flush(opts.Progress)
+
+	var result *Result
+	doMerge(ctx, opts.StageLabels, func() {
+		result = mergeResults(partialResults, balance, format)
+	})
+	return result, nil
+}
+
+// joinMemberRanges returns the record error of the first range that has one,
+// the ranges before it decoded up to their member boundaries so its start
+// was not a wrong guess. Otherwise the records crossing the ranges are added
+// to aggregator, they are reported at the start of the later range.
+func joinMemberRanges(ctx context.Context, ranges []memberRange, format RecordFormat, aggregator *MeasurementAggregator) error {
+	for _, rng := range ranges {
+		if rng.err != nil {
+			return rng.err
+		}
+	}
+
+	var joined []byte
+	for _, rng := range ranges {
+		joined = append(joined, rng.head...)
+		if !rng.hasNewline {
+			continue
+		}
+
+		chunk := Section{start: rng.start, length: rng.end - rng.start}
+		if err := processBlock(ctx, joined, 0, chunk, format, aggregator); err != nil {
+			return err
+		}
+		joined = append(joined[:0], rng.tail...)
+	}
+	if len(joined) > 0 {
+		last := ranges[len(ranges)-1]
+		return &RecordError{
+			SectionStart: last.start,
+			Line:         string(joined),
+			Err:          errors.New("last record is not terminated by a newline"),
+		}
+	}
+	return nil
+}
+
+// aggregateRange decompresses the members of rng through buffer and adds the
+// complete records to aggregator, the first range has no head
+func aggregateRange(ctx context.Context, input io.ReaderAt, rng *memberRange, first bool, buffer []byte, format RecordFormat, aggregator *MeasurementAggregator, progress Progress) error {
+	reader, err := decompress.NewMemberReader(input, rng.start, rng.end)
+	if err != nil {
+		return &decodeError{err}
+	}
+
+	return aggregateDecoded(ctx, reader, rng, first, buffer, format, aggregator, progress)
+}
+
+// aggregateDecoded reads the decoded data of rng from reader and adds the
+// complete records to aggregator, setting the head and tail of rng. Record
+// errors have the compressed offset of the range as SectionStart and the
+// decoded offset within the range as Offset. progress, when not nil, is told
+// the decoded bytes of every buffer.
+func aggregateDecoded(ctx context.Context, reader io.Reader, rng *memberRange, first bool, buffer []byte, format RecordFormat, aggregator *MeasurementAggregator, progress Progress) error {
+	chunk := Section{start: rng.start, length: rng.end - rng.start}
+	separator := format.RecordSeparator
+	// a header is read like the head of a later range and dropped
+	skipHeader := first && format.Header
+	rng.hasNewline = first && !skipHeader
+	var carry []byte
+	var offset int64
+
+	for {
+		n := copy(buffer, carry)
+		read, err := io.ReadFull(reader, buffer[n:])
+		data := buffer[:n+read]
+		atEOF := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !atEOF {
+			return &decodeError{fmt.Errorf("failed to decompress input at offset %d: %w", rng.start, err)}
+		}
+
+		if !rng.hasNewline {
+			idx := bytes.IndexByte(data, separator)
+			if idx == -1 {
+				rng.head = append(rng.head, data...)
+				offset += int64(len(data))
+				if atEOF {
+					return nil
+				}
+				continue
+			}
+
+			rng.head = append(rng.head, data[:idx+1]...)
+			rng.hasNewline = true
+			if skipHeader {
+				rng.head = nil
+			}
+			data = data[idx+1:]
+			offset += int64(idx + 1)
+		}
+
+		end := bytes.LastIndexByte(data, separator) + 1
+		if end == 0 && len(data) == len(buffer) {
+			return &RecordError{
+				SectionStart: rng.start,
+				Offset:       offset,
+				Err:          fmt.Errorf("no record separator within %d bytes", len(buffer)),
+			}
+		}
+
+		rows := aggregator.rows
+		if err := processBlock(ctx, data[:end], offset, chunk, format, aggregator); err != nil {
+			return err
+		}
+		offset += int64(end)
+		if progress != nil {
+			progress.Add(int64(read), aggregator.rows-rows)
+		}
+
+		carry = append(carry[:0], data[end:]...)
+		if atEOF {
+			rng.tail = carry
+			return nil
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package iter10
+
+import (
+	"1brc-go/decompress"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGzipMembers compresses every part of data as its own gzip member, the
+// parts are cut at size bytes regardless of the records
+func writeGzipMembers(t *testing.T, data []byte, size int) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for start := 0; start < len(data); start += size {
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data[start:min(start+size, len(data))])
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "measurements.txt.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecute_CompressedMatchesPlain(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	dir := t.TempDir()
+
+	plainPath := filepath.Join(dir, "plain.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, plainPath, Options{Workers: 4}); err != nil {
+		t.Fatalf("plain run failed: %v", err)
+	}
+	want, _ := os.ReadFile(plainPath)
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		memberSize int
+		workers    int
+	}{
+		{"single member", len(data), 4},
+		// members are cut in the middle of records
+		{"many members", 7001, 4},
+		{"more members than workers", 1001, 3},
+		{"one worker", 7001, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gzPath := writeGzipMembers(t, data, tt.memberSize)
+			outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+			if _, err := ExecuteWithOptions(context.Background(), gzPath, outputPath, Options{BufferSize: 4096, Workers: tt.workers}); err != nil {
+				t.Fatalf("compressed run failed: %v", err)
+			}
+			if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+				t.Errorf("compressed output differs from the plain run:\n%s\n%s", got, want)
+			}
+
+			// the streaming reader detects the compression as well
+			file, err := os.Open(gzPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			if _, err := ExecuteStream(context.Background(), file, outputPath, Options{Workers: tt.workers, SectionSize: 4096}); err != nil {
+				t.Fatalf("compressed stream failed: %v", err)
+			}
+			if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+				t.Errorf("compressed stream output differs from the plain run:\n%s\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestExecuteMembers_NotMemberBoundary(t *testing.T) {
+	gzPath := writeGzipMembers(t, bytes.Repeat([]byte("Hamburg;12.3\n"), 1000), 13000)
+	file, err := os.Open(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	// 10 is inside the only member, aggregateCompressed falls back to the
+	// stream when this fails
+	result, err := aggregateMembers(context.Background(), file, info.Size(), []int64{0, 10}, Options{})
+	var decodeErr *decodeError
+	if !errors.As(err, &decodeErr) || result != nil {
+		t.Errorf("expected only a decode error for a false member start, got %v", err)
+	}
+}
+
+func TestExecute_CompressedRecordError(t *testing.T) {
+	data := append(bytes.Repeat([]byte("Hamburg;12.3\n"), 1000), "Rome9.9\n"...)
+	gzPath := writeGzipMembers(t, data, 5000)
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+	progress := &countingProgress{}
+	_, err := ExecuteWithOptions(context.Background(), gzPath, outputPath, Options{Workers: 4, Progress: progress})
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Line != "Rome9.9" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "Rome9.9")
+	}
+	// a record error is not a wrong member start, the input is not decoded
+	// again by the sequential reader
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		t.Errorf("expected a record error only, got %v", err)
+	}
+	if progress.bytes.Load() > int64(len(data)) || progress.finished.Load() != 1 {
+		t.Errorf("got %d decoded bytes of %d and %d finished progress, want one pass", progress.bytes.Load(), len(data), progress.finished.Load())
+	}
+}
+
+func TestAggregateStarts_WrongMemberStartProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("Hamburg;12.3\n"), 10_000)
+	gzPath := writeGzipMembers(t, data, 5000)
+	file, err := os.Open(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	starts, err := decompress.MemberStarts(file, info.Size(), 100)
+	if err != nil || len(starts) < 3 {
+		t.Fatalf("got member starts %v, %v", starts, err)
+	}
+
+	// without a wrong start the ranges report every byte and row once
+	progress := &countingProgress{}
+	if _, err := aggregateStarts(context.Background(), file, info.Size(), starts, Options{BufferSize: 4096, Progress: progress}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if progress.bytes.Load() != int64(len(data)) || progress.rows.Load() != 10_000 {
+		t.Errorf("got %d bytes and %d rows, want %d bytes and 10000 rows", progress.bytes.Load(), progress.rows.Load(), len(data))
+	}
+
+	// the range from the third member start to the second one decodes a whole
+	// member and reports it before failing, like the range of a false start
+	// that decodes for a while, and the input is decoded again sequentially
+	starts = []int64{0, starts[2], starts[1]}
+	progress = &countingProgress{}
+	result, err := aggregateStarts(context.Background(), file, info.Size(), starts, Options{BufferSize: 4096, Progress: progress})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats, _ := result.Get("Hamburg"); stats.Count != 10_000 {
+		t.Errorf("got %d measurements, want 10000", stats.Count)
+	}
+	if progress.bytes.Load() != int64(len(data)) || progress.rows.Load() != 10_000 || progress.finished.Load() != 1 {
+		t.Errorf("got %d bytes and %d rows in %d progress, want %d bytes and 10000 rows once", progress.bytes.Load(), progress.rows.Load(), progress.finished.Load(), len(data))
+	}
+}
@@ -0,0 +1,408 @@
+package iter10
+
+import (
+	"1brc-go/decompress"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+// fileInput is one input of a multi-file run
+type fileInput struct {
+	path        string
+	file        *os.File
+	size        int64
+	data        []byte
+	compression decompress.Compression
+	// the member ranges of a gzip input, see aggregateMembers
+	ranges []memberRange
+	// the progress of the member ranges, reported once they are joined
+	progress pendingProgress
+}
+
+// fileSection is a section of one of the inputs. A gzip input is split into
+// member ranges, a bzip2 input is a single section decoded from its start.
+type fileSection struct {
+	input   int
+	section Section
+	// the index of the member range of a gzip input
+	member int
+}
+
+// fileResults collects the results of one input when they are written per file
+type fileResults struct {
+	mu      sync.Mutex
+	results ResultAggregator
+}
+
+// ExecuteFiles aggregates all inputPaths into a single result. The sections of
+// every file go into one queue for one pool of workers, so many small shards
+// are spread as evenly as the sections of a single large file. With
+// PerFileResults the results of every input are also written next to
+// outputPath, see PerFileOutputPath. Cancelling ctx leaves no output behind,
+// not even the per file results written before.
+func ExecuteFiles(ctx context.Context, inputPaths []string, outputPath string, opts Options) (Balance, error) {
+	var balance Balance
+
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	sectionSize := opts.SectionSize
+	if sectionSize <= 0 {
+		sectionSize = DefaultSectionSize
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultSectionSize
+	}
+	format, err := opts.RecordFormat.withDefaults()
+	if err != nil {
+		return balance, err
+	}
+
+	var perFilePaths []string
+	if opts.PerFileResults {
+		seen := make(map[string]string, len(inputPaths))
+		for _, inputPath := range inputPaths {
+			path := PerFileOutputPath(outputPath, inputPath)
+			if other, dup := seen[path]; dup {
+				return balance, fmt.Errorf("inputs %s and %s would both write their results to %s", other, inputPath, path)
+			}
+			seen[path] = inputPath
+			perFilePaths = append(perFilePaths, path)
+		}
+	}
+
+	inputs := make([]*fileInput, 0, len(inputPaths))
+	defer func() {
+		for _, input := range inputs {
+			if input.data != nil {
+				unix.Munmap(input.data)
+			}
+			input.file.Close()
+		}
+	}()
+
+	var sections []fileSection
+	for i, inputPath := range inputPaths {
+		input, err := openInput(inputPath)
+		if err != nil {
+			return balance, err
+		}
+		inputs = append(inputs, input)
+
+		switch input.compression {
+		case decompress.Gzip:
+			// a large shard is decoded by up to every worker, like a single file
+			numRanges := int(min(int64(numWorkers), max((input.size+sectionSize-1)/sectionSize, 1)))
+			starts, err := decompress.MemberStarts(input.file, input.size, numRanges)
+			if err != nil {
+				return balance, fmt.Errorf("%s: %w", inputPath, err)
+			}
+			input.ranges = memberRanges(starts, input.size)
+			for member, rng := range input.ranges {
+				sections = append(sections, fileSection{input: i, section: Section{start: rng.start, length: rng.end - rng.start}, member: member})
+			}
+			continue
+		case decompress.Bzip2:
+			sections = append(sections, fileSection{input: i, section: Section{start: 0, length: input.size}})
+			continue
+		}
+
+		var reader io.ReaderAt = input.file
+		if input.data != nil {
+			reader = bytes.NewReader(input.data)
+		}
+
+		numSections := int(max((input.size+sectionSize-1)/sectionSize, 1))
+		chunks, err := CalculateSections(reader, input.size, 128, format, numSections)
+		if err != nil {
+			return balance, fmt.Errorf("failed to creat chunks from file %s: %w", inputPath, err)
+		}
+		for _, chunk := range chunks {
+			sections = append(sections, fileSection{input: i, section: chunk})
+		}
+	}
+
+	queue := make(chan fileSection, len(sections))
+	for _, section := range sections {
+		queue <- section
+	}
+	close(queue)
+
+	balance.Sections = len(sections)
+	balance.Workers = make([]WorkerStats, numWorkers)
+
+	if opts.Progress != nil {
+		// the decoded size of compressed inputs is not known up front
+		var total int64
+		for _, input := range inputs {
+			if input.compression != decompress.None {
+				total = -1
+				break
+			}
+			total += input.size
+		}
+		opts.Progress.Start(total)
+		defer opts.Progress.Finish()
+	}
+
+	var perFile []*fileResults
+	if opts.PerFileResults {
+		perFile = make([]*fileResults, len(inputs))
+		for i := range perFile {
+			perFile[i] = &fileResults{results: NewResultAggregator()}
+		}
+	}
+
+	// the first failing worker cancels the others and no output is written
+	group, groupCtx := errgroup.WithContext(ctx)
+	partialResults := make([]*MeasurementAggregator, numWorkers)
+
+	for i := range numWorkers {
+		group.Go(func() error {
+			aggregator := NewMeasurementAggregator()
+			stats := &balance.Workers[i]
+			current := -1
+
+			var recordGenerator *RecordGenerator
+			var buffer []byte
+
+			for next := range queue {
+				if err := groupCtx.Err(); err != nil {
+					return err
+				}
+
+				// per file results need the aggregator to hold one file only, the
+				// sections of a file are next to each other in the queue so this
+				// happens about once per file
+				if perFile != nil && next.input != current {
+					if current >= 0 {
+						perFile[current].add(&aggregator)
+						aggregator = NewMeasurementAggregator()
+					}
+					current = next.input
+				}
+
+				started := time.Now()
+				rows := aggregator.rows
+				input := inputs[next.input]
+				chunk := next.section
+
+				err := doSection(groupCtx, opts.StageLabels, strconv.Itoa(i), chunk.start, func(ctx context.Context) error {
+					switch {
+					case input.compression == decompress.Gzip:
+						if buffer == nil {
+							buffer = make([]byte, bufferSize)
+						}
+						var progress Progress
+						if opts.Progress != nil {
+							progress = &input.progress
+						}
+						rng := &input.ranges[next.member]
+						err := aggregateRange(ctx, input.file, rng, next.member == 0, buffer, format, &rng.aggregator, progress)
+						// a wrong member start does not stop the pool, the
+						// input is decoded again after it
+						var decodeErr *decodeError
+						if errors.As(err, &decodeErr) {
+							rng.err = err
+							return nil
+						}
+						return rng.settle(err)
+					case input.compression != decompress.None:
+						if buffer == nil {
+							buffer = make([]byte, bufferSize)
+						}
+						return aggregateCompressedFile(ctx, input, buffer, format, &aggregator, opts.Progress)
+					case input.data != nil:
+						return ProcessMappedSection(ctx, input.data, chunk, format, &aggregator)
+					default:
+						if recordGenerator == nil {
+							recordGenerator = NewRecordGenerator(groupCtx, input.file, Section{}, bufferSize, format)
+						}
+						return ProcessSection(ctx, input.file, chunk, recordGenerator, &aggregator)
+					}
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", input.path, err)
+				}
+
+				stats.Busy += time.Since(started)
+				stats.Sections++
+				stats.Bytes += chunk.length
+				// compressed inputs report their decoded bytes as they go
+				if opts.Progress != nil && input.compression == decompress.None {
+					opts.Progress.Add(chunk.length, aggregator.rows-rows)
+				}
+			}
+
+			if perFile != nil && current >= 0 {
+				perFile[current].add(&aggregator)
+				return nil
+			}
+			partialResults[i] = &aggregator
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return balance, poolError(ctx, err)
+	}
+
+	for i, input := range inputs {
+		if input.ranges == nil {
+			continue
+		}
+		aggregators, err := joinFileRanges(ctx, input, bufferSize, format, opts.Progress)
+		if err != nil {
+			return balance, poolError(ctx, fmt.Errorf("%s: %w", input.path, err))
+		}
+		for _, aggregator := range aggregators {
+			if perFile != nil {
+				perFile[i].add(aggregator)
+			} else {
+				partialResults = append(partialResults, aggregator)
+			}
+		}
+	}
+
+	if perFile == nil {
+		var result *Result
+		doMerge(ctx, opts.StageLabels, func() {
+			result = mergeResults(partialResults, balance, format)
+		})
+		return balance, writeResult(ctx, outputPath, result)
+	}
+
+	// the per file results are removed again when a later write fails
+	combined := NewResultAggregator()
+	for i, results := range perFile {
+		if err := writeResult(ctx, perFilePaths[i], newResult(&results.results, Balance{}, format)); err != nil {
+			removeAll(perFilePaths[:i])
+			return balance, err
+		}
+		combined.Merge(&results.results)
+	}
+	if err := writeResult(ctx, outputPath, newResult(&combined, balance, format)); err != nil {
+		removeAll(perFilePaths)
+		return balance, err
+	}
+	return balance, nil
+}
+
+func removeAll(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+func (f *fileResults) add(aggregator *MeasurementAggregator) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.results.AddPartialResults(aggregator.cityMeasurements)
+}
+
+// openInput opens an input and maps it when it is plain text
+func openInput(path string) (*fileInput, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file at %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	input := &fileInput{path: path, file: file, size: info.Size()}
+
+	header := make([]byte, decompress.HeaderSize)
+	n, _ := file.ReadAt(header, 0)
+	input.compression = decompress.Detect(header[:n])
+	if input.compression != decompress.None {
+		return input, nil
+	}
+
+	// unmappable inputs, e.g. empty ones, take the ReadAt fallback
+	if data, err := mapFile(file, input.size); err == nil {
+		input.data = data
+	}
+	return input, nil
+}
+
+// joinFileRanges joins the records crossing the member ranges of a gzip input
+// and returns the aggregators of the ranges. The input is decoded again from
+// its start when one of the member starts turned out to be a wrong guess.
+// progress, when not nil, is told the bytes and rows of the input once.
+func joinFileRanges(ctx context.Context, input *fileInput, bufferSize int, format RecordFormat, progress Progress) ([]*MeasurementAggregator, error) {
+	var decodeErr *decodeError
+	if slices.ContainsFunc(input.ranges, func(rng memberRange) bool { return errors.As(rng.err, &decodeErr) }) {
+		aggregator := NewMeasurementAggregator()
+		if err := aggregateCompressedFile(ctx, input, make([]byte, bufferSize), format, &aggregator, progress); err != nil {
+			return nil, err
+		}
+		return []*MeasurementAggregator{&aggregator}, nil
+	}
+
+	rows := input.ranges[0].aggregator.rows
+	if err := joinMemberRanges(ctx, input.ranges, format, &input.ranges[0].aggregator); err != nil {
+		return nil, err
+	}
+	input.progress.Add(0, input.ranges[0].aggregator.rows-rows)
+	input.progress.flush(progress)
+	aggregators := make([]*MeasurementAggregator, len(input.ranges))
+	for i := range input.ranges {
+		aggregators[i] = &input.ranges[i].aggregator
+	}
+	return aggregators, nil
+}
+
+// aggregateCompressedFile decodes a whole compressed input through buffer
+func aggregateCompressedFile(ctx context.Context, input *fileInput, buffer []byte, format RecordFormat, aggregator *MeasurementAggregator, progress Progress) error {
+	reader, _, err := decompress.NewReader(io.NewSectionReader(input.file, 0, input.size))
+	if err != nil {
+		return err
+	}
+
+	rng := memberRange{start: 0, end: input.size}
+	if err := aggregateDecoded(ctx, reader, &rng, true, buffer, format, aggregator, progress); err != nil {
+		return err
+	}
+	if len(rng.tail) > 0 {
+		return &RecordError{
+			Line: string(rng.tail),
+			Err:  errors.New("last record is not terminated by a newline"),
+		}
+	}
+	return nil
+}
+
+// PerFileOutputPath is where the results of inputPath are written next to
+// outputPath, e.g. results/results.txt and data/2024-01-01.txt.gz give
+// results/results_2024-01-01.txt
+func PerFileOutputPath(outputPath string, inputPath string) string {
+	ext := filepath.Ext(outputPath)
+	stem := strings.TrimSuffix(outputPath, ext)
+
+	name := filepath.Base(inputPath)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".bz2")
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	return stem + "_" + name + ext
+}
@@ -0,0 +1,258 @@
+package iter10
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeShards splits data into count files cut on record boundaries, the
+// shards listed in compressed are gzipped
+func writeShards(t *testing.T, data []byte, count int, compressed ...int) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	records := bytes.SplitAfter(data, []byte("\n"))
+	perShard := (len(records) + count - 1) / count
+
+	var paths []string
+	for i := range count {
+		shard := bytes.Join(records[min(i*perShard, len(records)):min((i+1)*perShard, len(records))], nil)
+		path := filepath.Join(dir, "day-"+string(rune('a'+i))+".txt")
+
+		for _, c := range compressed {
+			if c == i {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				gz.Write(shard)
+				gz.Close()
+				shard, path = buf.Bytes(), path+".gz"
+			}
+		}
+
+		if err := os.WriteFile(path, shard, 0666); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestExecuteFiles_MatchesSingleFile(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	dir := t.TempDir()
+
+	singlePath := filepath.Join(dir, "single.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, singlePath, Options{Workers: 4}); err != nil {
+		t.Fatalf("single file run failed: %v", err)
+	}
+	want, _ := os.ReadFile(singlePath)
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := writeShards(t, data, 5, 2)
+
+	outputPath := filepath.Join(dir, "results.txt")
+	balance, err := ExecuteFiles(context.Background(), shards, outputPath, Options{Workers: 3, SectionSize: 4096})
+	if err != nil {
+		t.Fatalf("multi file run failed: %v", err)
+	}
+
+	if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+		t.Errorf("multi file output differs from the single file run:\n%s\n%s", got, want)
+	}
+	// the plain shards are cut into sections, the compressed one into member ranges
+	if balance.Sections <= len(shards) {
+		t.Errorf("got %d sections for %d shards, want the shards to be split", balance.Sections, len(shards))
+	}
+	for _, shard := range shards {
+		if _, err := os.Stat(PerFileOutputPath(outputPath, shard)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("per file results written without PerFileResults: %v", err)
+		}
+	}
+}
+
+func TestExecuteFiles_GzipMembersInParallel(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	dir := t.TempDir()
+
+	singlePath := filepath.Join(dir, "single.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, singlePath, Options{Workers: 4}); err != nil {
+		t.Fatalf("single file run failed: %v", err)
+	}
+	want, _ := os.ReadFile(singlePath)
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// members are cut in the middle of records
+	gzPath := writeGzipMembers(t, data, 7001)
+
+	for _, perFile := range []bool{false, true} {
+		outputPath := filepath.Join(t.TempDir(), "results.txt")
+		progress := &countingProgress{}
+		balance, err := ExecuteFiles(context.Background(), []string{gzPath}, outputPath, Options{Workers: 4, SectionSize: 4096, PerFileResults: perFile, Progress: progress})
+		if err != nil {
+			t.Fatalf("multi file run failed: %v", err)
+		}
+		if progress.bytes.Load() != int64(len(data)) || progress.rows.Load() != 10_000 {
+			t.Errorf("per file %v: got %d bytes and %d rows, want %d bytes and 10000 rows", perFile, progress.bytes.Load(), progress.rows.Load(), len(data))
+		}
+
+		if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+			t.Errorf("per file %v: output differs from the single file run:\n%s\n%s", perFile, got, want)
+		}
+		// the shard is decoded by every worker, one member range each
+		if balance.Sections != 4 {
+			t.Errorf("per file %v: got %d sections, want 4 member ranges", perFile, balance.Sections)
+		}
+	}
+}
+
+func TestJoinFileRanges_WrongMemberStart(t *testing.T) {
+	gzPath := writeGzipMembers(t, bytes.Repeat([]byte("Hamburg;12.3\n"), 1000), 13000)
+	input, err := openInput(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.file.Close()
+
+	// 10 is inside the only member, the range starting there fails to decode
+	input.ranges = memberRanges([]int64{0, 10}, input.size)
+	input.ranges[1].err = &decodeError{errors.New("flate: corrupt input")}
+
+	// the range decoded before the failure is not reported
+	input.progress.Add(4096, 300)
+	progress := &countingProgress{}
+	aggregators, err := joinFileRanges(context.Background(), input, 4096, DefaultRecordFormat, progress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(aggregators) != 1 || aggregators[0].rows != 1000 {
+		t.Errorf("expected the input decoded again from its start, got %d aggregators", len(aggregators))
+	}
+	if progress.bytes.Load() != 13000 || progress.rows.Load() != 1000 {
+		t.Errorf("got %d bytes and %d rows, want the 13000 bytes and 1000 rows of one pass", progress.bytes.Load(), progress.rows.Load())
+	}
+}
+
+func TestExecuteFiles_PerFileResults(t *testing.T) {
+	data, err := os.ReadFile(writeTestInput(t, 5_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := writeShards(t, data, 3, 1)
+	dir := t.TempDir()
+
+	outputPath := filepath.Join(dir, "results.txt")
+	if _, err := ExecuteFiles(context.Background(), shards, outputPath, Options{Workers: 2, SectionSize: 2048, PerFileResults: true}); err != nil {
+		t.Fatalf("multi file run failed: %v", err)
+	}
+
+	for _, shard := range shards {
+		wantPath := filepath.Join(dir, "want.txt")
+		if _, err := ExecuteWithOptions(context.Background(), shard, wantPath, Options{Workers: 1}); err != nil {
+			t.Fatalf("single file run of %s failed: %v", shard, err)
+		}
+
+		want, _ := os.ReadFile(wantPath)
+		got, err := os.ReadFile(PerFileOutputPath(outputPath, shard))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("results of %s differ from its own run (%v):\n%s\n%s", shard, err, got, want)
+		}
+	}
+
+	// the combined results are still written
+	wantPath := filepath.Join(dir, "combined.txt")
+	if _, err := ExecuteFiles(context.Background(), shards, wantPath, Options{Workers: 2}); err != nil {
+		t.Fatalf("multi file run failed: %v", err)
+	}
+	got, _ := os.ReadFile(outputPath)
+	want, _ := os.ReadFile(wantPath)
+	if !bytes.Equal(got, want) {
+		t.Errorf("combined results differ with PerFileResults:\n%s\n%s", got, want)
+	}
+}
+
+func TestExecuteFiles_RecordErrorNamesFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(good, []byte(strings.Repeat("Hamburg;12.3\n", 100)), 0666)
+	os.WriteFile(bad, []byte("Oslo;-5.5\nRome9.9\n"), 0666)
+
+	outputPath := filepath.Join(dir, "results.txt")
+	_, err := ExecuteFiles(context.Background(), []string{good, bad}, outputPath, Options{Workers: 2})
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Offset != 10 || !strings.Contains(err.Error(), bad) {
+		t.Errorf("got %v, want the record at offset 10 of %s", err, bad)
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file on failure, got %v", err)
+	}
+}
+
+func TestExecuteFiles_Cancelled(t *testing.T) {
+	data, err := os.ReadFile(writeTestInput(t, 5_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := writeShards(t, data, 3, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+	_, err = ExecuteFiles(ctx, shards, outputPath, Options{Workers: 2, SectionSize: 2048, PerFileResults: true})
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled itself, got %v", err)
+	}
+
+	for _, path := range append([]string{outputPath}, PerFileOutputPath(outputPath, shards[0])) {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected no %s after cancelling, got %v", path, err)
+		}
+	}
+}
+
+func TestExecuteFiles_PerFileOutputCollision(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a", "day.txt")
+	second := filepath.Join(dir, "b", "day.txt.gz")
+
+	_, err := ExecuteFiles(context.Background(), []string{first, second}, filepath.Join(dir, "results.txt"), Options{PerFileResults: true})
+	if err == nil || !strings.Contains(err.Error(), "both write") {
+		t.Errorf("expected an error for inputs sharing their results path, got %v", err)
+	}
+}
+
+func TestPerFileOutputPath(t *testing.T) {
+	tests := []struct {
+		outputPath string
+		inputPath  string
+		want       string
+	}{
+		{"results/results.txt", "data/2024-01-01.txt", "results/results_2024-01-01.txt"},
+		{"results/results.txt", "data/2024-01-01.txt.gz", "results/results_2024-01-01.txt"},
+		{"results/results.txt", "data/2024-01-01.bz2", "results/results_2024-01-01.txt"},
+		{"out", "shard", "out_shard"},
+	}
+
+	for _, tt := range tests {
+		if got := PerFileOutputPath(tt.outputPath, tt.inputPath); got != tt.want {
+			t.Errorf("PerFileOutputPath(%q, %q) = %q, want %q", tt.outputPath, tt.inputPath, got, tt.want)
+		}
+	}
+}
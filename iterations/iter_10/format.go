@@ -0,0 +1,140 @@
+package iter10
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RecordFormat describes how the records of an input are laid out. Zero
+// fields take the value of DefaultRecordFormat, so the zero RecordFormat is
+// the 1BRC format.
+type RecordFormat struct {
+	// between the station and the temperature
+	FieldSeparator byte
+	// ends every record, including the last one
+	RecordSeparator byte
+	// decimal places of the temperatures, the measurements are aggregated in
+	// units of the last one
+	Decimals int
+	// also accept temperatures with fewer decimal places, "12" and "12.3" with
+	// 2 decimals are read as 12.00 and 12.30
+	FewerDecimals bool
+	// records may end in "\r" followed by the record separator
+	CRLF bool
+	// the first record of the input is a header and is skipped
+	Header bool
+}
+
+// DefaultRecordFormat is the 1BRC format, "Hamburg;12.3\n", the only one the
+// word at a time scanner handles
+var DefaultRecordFormat = RecordFormat{FieldSeparator: ';', RecordSeparator: '\n', Decimals: 1}
+
+// maxDecimals keeps the sum of a billion measurements within an int
+const maxDecimals = 6
+
+// withDefaults fills the zero fields from DefaultRecordFormat and rejects
+// formats the parser cannot tell apart
+func (f RecordFormat) withDefaults() (RecordFormat, error) {
+	if f.FieldSeparator == 0 {
+		f.FieldSeparator = DefaultRecordFormat.FieldSeparator
+	}
+	if f.RecordSeparator == 0 {
+		f.RecordSeparator = DefaultRecordFormat.RecordSeparator
+	}
+	if f.Decimals == 0 {
+		f.Decimals = DefaultRecordFormat.Decimals
+	}
+
+	for _, separator := range []byte{f.FieldSeparator, f.RecordSeparator} {
+		if separator == '-' || separator == '.' || separator >= '0' && separator <= '9' || f.CRLF && separator == '\r' {
+			return f, fmt.Errorf("invalid record format: %q cannot be a separator", separator)
+		}
+	}
+	if f.FieldSeparator == f.RecordSeparator {
+		return f, fmt.Errorf("invalid record format: field and record separator are both %q", f.FieldSeparator)
+	}
+	if f.Decimals < 0 || f.Decimals > maxDecimals {
+		return f, fmt.Errorf("invalid record format: %d decimals, at most %d are supported", f.Decimals, maxDecimals)
+	}
+	return f, nil
+}
+
+// fast reports whether the records can go through the word at a time scanner,
+// a header is skipped before the records are scanned so it does not matter
+func (f RecordFormat) fast() bool {
+	f.Header = false
+	return f == DefaultRecordFormat
+}
+
+// scale is the number of units in a degree
+func (f RecordFormat) scale() int {
+	scale := 1
+	for range f.Decimals {
+		scale *= 10
+	}
+	return scale
+}
+
+// ParseRecord parses a record without its record separator. The record is
+// split at the last field separator, station names may contain it, e.g.
+// "Flores,  Petén" with a ',' but temperatures never do.
+func (f RecordFormat) ParseRecord(rawRecord []byte) (Record, error) {
+	var record Record
+
+	if f.CRLF {
+		rawRecord = bytes.TrimSuffix(rawRecord, []byte{'\r'})
+	}
+
+	separatorIdx := bytes.LastIndexByte(rawRecord, f.FieldSeparator)
+	if separatorIdx == -1 {
+		return record, fmt.Errorf("separator %q not found in record: %s", f.FieldSeparator, rawRecord)
+	}
+
+	record.station = rawRecord[:separatorIdx]
+	record.hash = hashStation(record.station)
+
+	temp, err := f.parseTemperature(rawRecord[separatorIdx+1:])
+	if err != nil {
+		return record, fmt.Errorf("failed to convert temperature to float: %s in record: %s", rawRecord[separatorIdx+1:], rawRecord)
+	}
+	record.temp = temp
+
+	return record, nil
+}
+
+// parseTemperature returns the temperature in units of the last decimal, the
+// integer part has one or two digits like in the 1BRC format
+func (f RecordFormat) parseTemperature(temp []byte) (int, error) {
+	if f.Decimals == 1 && !f.FewerDecimals {
+		return parseTemperature(temp)
+	}
+
+	raw := temp
+	sign := 1
+	if len(temp) > 0 && temp[0] == '-' {
+		sign = -1
+		temp = temp[1:]
+	}
+
+	integer, fraction, hasDot := bytes.Cut(temp, []byte{'.'})
+	if len(integer) < 1 || len(integer) > 2 || hasDot && len(fraction) == 0 || len(fraction) > f.Decimals ||
+		!f.FewerDecimals && len(fraction) != f.Decimals {
+		return 0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(raw), raw)
+	}
+
+	result := 0
+	for _, digits := range [][]byte{integer, fraction} {
+		for _, digit := range digits {
+			if digit < '0' || digit > '9' {
+				return 0, fmt.Errorf("unexpected character %q in temperature data: %s", digit, raw)
+			}
+			result = 10*result + int(digit-'0')
+		}
+	}
+	// pad the missing decimal places
+	for range f.Decimals - len(fraction) {
+		result *= 10
+	}
+
+	return sign * result, nil
+}
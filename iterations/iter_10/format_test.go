@@ -0,0 +1,217 @@
+package iter10
+
+import (
+	"1brc-go/solver"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordFormat_ParseRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  RecordFormat
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"default", DefaultRecordFormat, "Hamburg;12.3", 123, false},
+		{"field separator", RecordFormat{FieldSeparator: ','}, "Hamburg,-12.3", -123, false},
+		{"two decimals", RecordFormat{Decimals: 2}, "Hamburg;-12.34", -1234, false},
+		{"two decimals rejects one", RecordFormat{Decimals: 2}, "Hamburg;12.3", 0, true},
+		{"fewer decimals", RecordFormat{Decimals: 2, FewerDecimals: true}, "Hamburg;-2.5", -250, false},
+		{"no decimals", RecordFormat{Decimals: 2, FewerDecimals: true}, "Hamburg;7", 700, false},
+		{"dot without decimals", RecordFormat{Decimals: 2, FewerDecimals: true}, "Hamburg;7.", 0, true},
+		{"too many decimals", RecordFormat{Decimals: 2, FewerDecimals: true}, "Hamburg;7.123", 0, true},
+		{"not a digit", RecordFormat{Decimals: 2}, "Hamburg;1x.00", 0, true},
+		{"crlf", RecordFormat{CRLF: true}, "Hamburg;12.3\r", 123, false},
+		{"carriage return without crlf", DefaultRecordFormat, "Hamburg;12.3\r", 0, true},
+		{"missing separator", RecordFormat{FieldSeparator: ','}, "Hamburg;12.3", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := tt.format.withDefaults()
+			if err != nil {
+				t.Fatalf("invalid format: %v", err)
+			}
+
+			got, err := format.ParseRecord([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecord(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && (string(got.station) != "Hamburg" || got.temp != tt.want) {
+				t.Errorf("got %q %d, want %q %d", got.station, got.temp, "Hamburg", tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordFormat_Invalid(t *testing.T) {
+	for _, format := range []RecordFormat{
+		{FieldSeparator: '\n'},
+		{FieldSeparator: '.'},
+		{RecordSeparator: '-'},
+		{FieldSeparator: '\r', CRLF: true},
+		{Decimals: maxDecimals + 1},
+	} {
+		if _, err := format.withDefaults(); err == nil {
+			t.Errorf("expected an error for %+v", format)
+		}
+	}
+}
+
+// reformat writes the records of the 1BRC input data in format, two
+// decimals get a trailing zero and with FewerDecimals ".0" is left out
+func reformat(data []byte, format RecordFormat) []byte {
+	format, _ = format.withDefaults()
+
+	var buf bytes.Buffer
+	if format.Header {
+		buf.WriteString("station" + string(format.FieldSeparator) + "temperature")
+		if format.CRLF {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(format.RecordSeparator)
+	}
+
+	for line := range strings.Lines(string(data)) {
+		station, temp, _ := strings.Cut(strings.TrimSuffix(line, "\n"), ";")
+		if format.Decimals == 2 {
+			temp += "0"
+		}
+		if format.FewerDecimals {
+			temp = strings.TrimSuffix(strings.TrimSuffix(temp, "0"), ".0")
+		}
+
+		buf.WriteString(station + string(format.FieldSeparator) + temp)
+		if format.CRLF {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(format.RecordSeparator)
+	}
+	return buf.Bytes()
+}
+
+func TestAggregate_RecordFormats(t *testing.T) {
+	data, err := os.ReadFile(writeTestInput(t, 10_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := Aggregate(context.Background(), bytes.NewReader(data), int64(len(data)), Options{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantOutput bytes.Buffer
+	want.WriteTo(&wantOutput)
+
+	formats := map[string]RecordFormat{
+		"csv with header": {FieldSeparator: ',', CRLF: true, Header: true},
+		"header only":     {Header: true},
+		"two decimals":    {FieldSeparator: '|', RecordSeparator: 0x1e, Decimals: 2},
+		"fewer decimals":  {Decimals: 2, FewerDecimals: true, CRLF: true},
+	}
+
+	for name, format := range formats {
+		t.Run(name, func(t *testing.T) {
+			input := reformat(data, format)
+			inputPath := filepath.Join(t.TempDir(), "measurements.txt")
+			if err := os.WriteFile(inputPath, input, 0666); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(inputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			// small sections and blocks so the header is only in the first one
+			opts := Options{BufferSize: 512, Workers: 3, SectionSize: 4096, RecordFormat: format}
+			runs := map[string]func() (*Result, error){
+				"mapped": func() (*Result, error) { return Aggregate(context.Background(), file, int64(len(input)), opts) },
+				"read at": func() (*Result, error) {
+					return Aggregate(context.Background(), bytes.NewReader(input), int64(len(input)), opts)
+				},
+				"stream": func() (*Result, error) { return AggregateStream(context.Background(), bytes.NewReader(input), opts) },
+				"gzip members": func() (*Result, error) {
+					gzFile, err := os.Open(writeGzipMembers(t, input, 7001))
+					if err != nil {
+						return nil, err
+					}
+					defer gzFile.Close()
+					info, _ := gzFile.Stat()
+					return Aggregate(context.Background(), gzFile, info.Size(), opts)
+				},
+			}
+
+			for run, aggregate := range runs {
+				result, err := aggregate()
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", run, err)
+				}
+
+				var got bytes.Buffer
+				result.WriteTo(&got)
+				if !bytes.Equal(got.Bytes(), wantOutput.Bytes()) {
+					t.Errorf("%s: results differ from the 1BRC format:\n%s\n%s", run, got.Bytes(), wantOutput.Bytes())
+				}
+			}
+		})
+	}
+}
+
+func TestSolver_RecordFormats(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, plainPath, Options{Workers: 2}); err != nil {
+		t.Fatalf("plain run failed: %v", err)
+	}
+	want, _ := os.ReadFile(plainPath)
+
+	csvPath := filepath.Join(dir, "measurements.csv")
+	if err := os.WriteFile(csvPath, reformat(data, RecordFormat{FieldSeparator: ',', Decimals: 2, FewerDecimals: true, CRLF: true, Header: true}), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// the format as the CLI flags give it
+	s, err := solver.New("iter_10", solver.Options{
+		Workers: 3,
+		Knobs:   "section=4096",
+		Records: solver.RecordFormat{FieldSeparator: ',', RecordSeparator: '\n', Decimals: 2, FewerDecimals: true, CRLF: true, Header: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runs := map[string]func(outputPath string) error{
+		"run":   func(outputPath string) error { return s.Run(context.Background(), csvPath, outputPath) },
+		"files": func(outputPath string) error { return s.RunFiles(context.Background(), []string{csvPath}, outputPath) },
+		"stream": func(outputPath string) error {
+			file, err := os.Open(csvPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return s.Stream(context.Background(), file, outputPath)
+		},
+	}
+	for name, run := range runs {
+		outputPath := filepath.Join(t.TempDir(), "results.txt")
+		if err := run(outputPath); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, want) {
+			t.Errorf("%s: results differ from the 1BRC format:\n%s\n%s", name, got, want)
+		}
+	}
+}
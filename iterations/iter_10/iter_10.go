@@ -0,0 +1,722 @@
+package iter10
+
+import (
+	"1brc-go/decompress"
+	"1brc-go/solver"
+	"1brc-go/stationtable"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+type Section struct {
+	start  int64
+	length int64
+}
+
+// CalculateSections returns at most numSections sections cut after the
+// record separator of format, fewer when the records run out before every
+// section got one. A header is left out of the first section.
+func CalculateSections(reader io.ReaderAt, dataSize int64, bufferSize int, format RecordFormat, numSections int) ([]Section, error) {
+	chunks := make([]Section, 0, numSections)
+	chunkSize := dataSize / int64(numSections)
+	separator := format.RecordSeparator
+
+	start := int64(0)
+	if format.Header && dataSize > 0 {
+		var err error
+		start, err = nextRecordBoundary(reader, 0, bufferSize, separator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to skip the header: %w", err)
+		}
+	}
+	for i := 0; i < numSections && start < dataSize; i++ {
+		end := dataSize
+		if i < numSections-1 && start+chunkSize < dataSize {
+			var err error
+			end, err = nextRecordBoundary(reader, start+chunkSize, bufferSize, separator)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		chunks = append(chunks, Section{start: start, length: end - start})
+		start = end
+	}
+
+	return chunks, nil
+}
+
+// nextRecordBoundary returns the offset just past the first separator at or after targetOffset.
+func nextRecordBoundary(reader io.ReaderAt, targetOffset int64, bufferSize int, separator byte) (int64, error) {
+	peekBuf := make([]byte, bufferSize)
+	n, err := reader.ReadAt(peekBuf, targetOffset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	idx := bytes.IndexByte(peekBuf[:n], separator)
+	if idx == -1 {
+		return 0, fmt.Errorf("separator not found within %d bytes of offset %d", bufferSize, targetOffset)
+	}
+
+	return targetOffset + int64(idx) + 1, nil
+}
+
+type RecordGenerator struct {
+	ctx           context.Context
+	reader        *io.SectionReader
+	sectionStart  int64
+	sectionOffset int64
+	recordOffset  int64
+	buffer        []byte
+	safeBuffer    []byte
+	format        RecordFormat
+}
+
+// bufferSize must be greater than record size
+// ctx is checked before every buffer refill so a cancelled section stops early
+func NewRecordGenerator(ctx context.Context, reader io.ReaderAt, section Section, bufferSize int, format RecordFormat) *RecordGenerator {
+	sectionReader := io.NewSectionReader(reader, section.start, section.length)
+	buffer := make([]byte, bufferSize)
+	return &RecordGenerator{
+		ctx:           ctx,
+		reader:        sectionReader,
+		sectionStart:  section.start,
+		sectionOffset: 0,
+		buffer:        buffer,
+		format:        format,
+	}
+}
+
+// Reset moves the generator to another section of the same input, the buffer is reused
+func (rg *RecordGenerator) Reset(reader io.ReaderAt, section Section) {
+	rg.reader = io.NewSectionReader(reader, section.start, section.length)
+	rg.sectionStart = section.start
+	rg.sectionOffset = 0
+	rg.recordOffset = 0
+	rg.safeBuffer = nil
+}
+
+func (rg *RecordGenerator) readNextChunk() error {
+	if err := rg.ctx.Err(); err != nil {
+		return err
+	}
+
+	n, err := rg.reader.ReadAt(rg.buffer, rg.sectionOffset)
+
+	// handle read errors
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read data chunk: %w", err)
+	}
+
+	if n == 0 {
+		return io.EOF
+	}
+
+	dataRead := rg.buffer[:n]
+
+	// adjust end to last record end
+	lastSeparator := bytes.LastIndexByte(dataRead, rg.format.RecordSeparator)
+
+	// no record separator found -> should never happen
+	if lastSeparator == -1 {
+		return fmt.Errorf("no separator found in the data chunk.")
+	}
+
+	rg.safeBuffer = dataRead[:lastSeparator+1]
+	rg.sectionOffset += int64(lastSeparator + 1)
+
+	return nil
+}
+
+// ReadBlock returns the next buffer of complete records and its absolute
+// offset in the input, the block is only valid until the next call
+func (rg *RecordGenerator) ReadBlock() ([]byte, int64, error) {
+	if err := rg.readNextChunk(); err != nil {
+		rg.recordOffset = rg.sectionStart + rg.sectionOffset
+		return nil, rg.recordOffset, err
+	}
+	rg.recordOffset = rg.sectionStart + rg.sectionOffset - int64(len(rg.safeBuffer))
+
+	return rg.safeBuffer, rg.recordOffset, nil
+}
+
+// Offset returns the absolute input offset of the last block read, or of the
+// position where reading failed
+func (rg *RecordGenerator) Offset() int64 {
+	return rg.recordOffset
+}
+
+// RecordError reports the record a worker failed on, offsets are absolute
+// positions in the input
+type RecordError struct {
+	SectionStart int64
+	Offset       int64
+	Line         string
+	Err          error
+}
+
+func (e *RecordError) Error() string {
+	if e.Line == "" {
+		return fmt.Sprintf("section at offset %d: failed at offset %d: %v", e.SectionStart, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("section at offset %d: record at offset %d %q: %v", e.SectionStart, e.Offset, e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+type Record struct {
+	station []byte
+	hash    uint64
+	temp    int
+}
+
+// ParseRecord parses a record of the 1BRC format, see RecordFormat.ParseRecord
+func ParseRecord(rawRecord []byte) (Record, error) {
+	return DefaultRecordFormat.ParseRecord(rawRecord)
+}
+
+// temperature can be positive (no sign) or negative (-)
+// temperature -100 < t < 100
+// 1 decimal precision, there is always one and only one decimal place number
+// decimal are separated by . from the integer part
+// it will return the 10x the measurement as an int
+func parseTemperature(temp []byte) (int, error) {
+	// shortest eg 1.1 longest eg -23.5
+	if len(temp) < 3 || len(temp) > 5 {
+		return 0.0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	sign := 1
+	result := 0
+
+	// handle negaitive sign
+	if temp[0] == '-' {
+		sign = -1
+		temp = temp[1:]
+	}
+
+	if len(temp) == 4 {
+		result = 100*(int(temp[0]-'0')) + 10*(int(temp[1]-'0')) + int(temp[3]-'0')
+	} else if len(temp) == 3 {
+		result = 10*(int(temp[0]-'0')) + int(temp[2]-'0')
+	} else {
+		return 0, fmt.Errorf("unexpected length (%d) for temperature data: %s", len(temp), temp)
+	}
+
+	return sign * result, nil
+}
+
+type Metrics struct {
+	min float64
+	avg float64
+	max float64
+}
+
+type AggregatedMeasurements struct {
+	min   int
+	max   int
+	sum   int
+	count int
+}
+
+type MeasurementAggregator struct {
+	cityMeasurements *stationtable.Table[AggregatedMeasurements]
+	// records added by processBlock, only read for progress reports
+	rows int64
+}
+
+func NewMeasurementAggregator() MeasurementAggregator {
+	cityMeasurements := stationtable.New[AggregatedMeasurements](stationtable.DefaultCapacity)
+
+	return MeasurementAggregator{cityMeasurements: cityMeasurements}
+}
+
+func (a *MeasurementAggregator) AddRecord(record Record) error {
+
+	aggMeasurement, inserted := a.cityMeasurements.GetOrInsert(record.station, record.hash)
+
+	if aggMeasurement == nil {
+		return fmt.Errorf("more than %d stations", stationtable.DefaultCapacity)
+	}
+
+	if inserted { // no previous measurement for the city
+		*aggMeasurement = AggregatedMeasurements{
+			min:   record.temp,
+			max:   record.temp,
+			sum:   record.temp,
+			count: 1,
+		}
+
+	} else { // there's already previous measurements, modify in place
+		aggMeasurement.min = min(aggMeasurement.min, record.temp)
+		aggMeasurement.max = max(aggMeasurement.max, record.temp)
+		aggMeasurement.sum += record.temp
+		aggMeasurement.count++
+	}
+
+	return nil
+}
+
+type ResultAggregator struct {
+	allResults map[string]*AggregatedMeasurements
+}
+
+func NewResultAggregator() ResultAggregator {
+	allResults := make(map[string]*AggregatedMeasurements)
+
+	return ResultAggregator{allResults: allResults}
+}
+
+func (ra *ResultAggregator) AddPartialResults(partialResults *stationtable.Table[AggregatedMeasurements]) {
+	for k, v := range partialResults.All() {
+		currentMeasurements, ok := ra.allResults[string(k)]
+		if !ok { // no previous measurement for the city, copy it out of the table
+			measurements := *v
+			ra.allResults[string(k)] = &measurements
+		} else { // there's already previous measuremnts, modify in place
+			currentMeasurements.min = min(currentMeasurements.min, v.min)
+			currentMeasurements.max = max(currentMeasurements.max, v.max)
+			currentMeasurements.sum += v.sum
+			currentMeasurements.count += v.count
+		}
+	}
+}
+
+// Merge adds the results of another aggregator, e.g. the one of another input file
+func (ra *ResultAggregator) Merge(other *ResultAggregator) {
+	for k, v := range other.allResults {
+		currentMeasurements, ok := ra.allResults[k]
+		if !ok {
+			measurements := *v
+			ra.allResults[k] = &measurements
+		} else {
+			currentMeasurements.min = min(currentMeasurements.min, v.min)
+			currentMeasurements.max = max(currentMeasurements.max, v.max)
+			currentMeasurements.sum += v.sum
+			currentMeasurements.count += v.count
+		}
+	}
+}
+
+func (ra *ResultAggregator) ListCities() []string {
+	cities := make([]string, 0, len(ra.allResults))
+
+	for k := range ra.allResults {
+		cities = append(cities, k)
+	}
+
+	return cities
+}
+
+func (ra *ResultAggregator) CalculateMetricsForCity(city string) (Metrics, error) {
+	var metrics Metrics
+
+	aggregatedData, ok := ra.allResults[city]
+	if !ok {
+		return metrics, fmt.Errorf("city not found: %s", city)
+	}
+
+	metrics.max = float64(aggregatedData.max) / 10.0
+	metrics.min = float64(aggregatedData.min) / 10.0
+	metrics.avg = float64(aggregatedData.sum) / float64(aggregatedData.count*10)
+
+	return metrics, nil
+}
+
+func RoundToOneDecimal(x float64) float64 {
+	return math.Floor(x*10.0+0.5) / 10.0
+}
+
+func FormatMetrics(city string, metrics Metrics) string {
+	min := RoundToOneDecimal(metrics.min)
+	max := RoundToOneDecimal(metrics.max)
+	avg := RoundToOneDecimal(metrics.avg)
+
+	return fmt.Sprintf("%s=%.1f/%.1f/%.1f", city, min, avg, max)
+}
+
+// ProcessSection reads the section through a copying RecordGenerator, it is
+// the fallback when the input cannot be mapped. The generator is reset to
+// the section, so one generator and its buffer serve every section of a worker.
+func ProcessSection(ctx context.Context, reader io.ReaderAt, chunk Section, recordGenerator *RecordGenerator, aggregator *MeasurementAggregator) error {
+	recordGenerator.Reset(reader, chunk)
+
+	for {
+		block, blockStart, err := recordGenerator.ReadBlock()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return err
+			}
+
+			return &RecordError{
+				SectionStart: chunk.start,
+				Offset:       recordGenerator.Offset(),
+				Err:          fmt.Errorf("failed reading record: %w", err),
+			}
+		}
+
+		if err := processBlock(ctx, block, blockStart, chunk, recordGenerator.format, aggregator); err != nil {
+			return err
+		}
+	}
+}
+
+// ProcessMappedSection scans the records of the section in place in the
+// mapped input and adds them to the worker's aggregator
+func ProcessMappedSection(ctx context.Context, data []byte, chunk Section, format RecordFormat, aggregator *MeasurementAggregator) error {
+	block := data[chunk.start : chunk.start+chunk.length]
+	return processBlock(ctx, block, chunk.start, chunk, format, aggregator)
+}
+
+// the mapped sections have no buffer refills, so the context is also checked
+// whenever the scanner moved this many bytes past the last check
+const ctxCheckInterval = 4 * 1024 * 1024
+
+// processBlock aggregates a block of complete records of format starting at
+// blockStart in the input
+func processBlock(ctx context.Context, block []byte, blockStart int64, chunk Section, format RecordFormat, aggregator *MeasurementAggregator) error {
+	switch stages := newStageSwitch(ctx); stages.level {
+	case RecordStageLabels:
+		return processBlockStaged(ctx, block, blockStart, chunk, format, aggregator, stages)
+	case SectionStageLabels:
+		pprof.SetGoroutineLabels(stages.records)
+		defer pprof.SetGoroutineLabels(stages.section)
+	}
+
+	scanner := NewFormatScanner(block, format)
+	nextCheck := 0
+
+	// counted locally, the aggregator is only updated once per block
+	var rows int64
+
+	for {
+		if scanner.pos >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				aggregator.rows += rows
+				return err
+			}
+			nextCheck = scanner.pos + ctxCheckInterval
+		}
+
+		record, err := scanner.Next()
+		if err == nil {
+			err = aggregator.AddRecord(record)
+			rows++
+		}
+		if err != nil {
+			aggregator.rows += rows
+			if err == io.EOF {
+				return nil
+			}
+
+			return &RecordError{
+				SectionStart: chunk.start,
+				Offset:       blockStart + int64(scanner.Offset()),
+				Line:         string(scanner.Line()),
+				Err:          err,
+			}
+		}
+	}
+}
+
+// mapFile maps the whole input read only, it is a variable so the tests can
+// force the ReadAt fallback
+var mapFile = func(file *os.File, size int64) ([]byte, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("cannot map input of %d bytes", size)
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map input: %w", err)
+	}
+
+	// the advice only helps the kernel's read ahead, failing it is harmless
+	unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return data, nil
+}
+
+// sections are this large by default, so a slow worker holds up the end of
+// the run by at most one small section
+const DefaultSectionSize = 8 * 1024 * 1024
+
+type Options struct {
+	// only used by the ReadAt fallback, one buffer per worker, DefaultSectionSize
+	// when zero
+	BufferSize int
+	// pool size, GOMAXPROCS when zero
+	Workers     int
+	SectionSize int64
+	// ExecuteFiles also writes the results of every input on its own
+	PerFileResults bool
+	// told the bytes and rows of every section a worker finished, nil disables it
+	Progress Progress
+	// layout of the records, the 1BRC format when zero
+	RecordFormat RecordFormat
+	// label the CPU profile samples with the worker, the section and the stage
+	// (read, parse+aggregate or merge), RecordStageLabels splits parse and
+	// aggregate at a cost, NoStageLabels when zero
+	StageLabels int
+}
+
+// Progress receives the work done during a run, the total is -1 when it is
+// not known up front. Add is called concurrently by the workers, Finish once
+// the run is over.
+type Progress interface {
+	Start(totalBytes int64)
+	Add(bytes int64, rows int64)
+	Finish()
+}
+
+func Execute(inputPath string, outputPath string, bufferSize int, numWorkers int) error {
+	_, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: bufferSize, Workers: numWorkers})
+	return err
+}
+
+// ExecuteWithOptions aggregates the file at inputPath and writes the sorted
+// results to outputPath, see Aggregate. Cancelling ctx leaves no output
+// behind and returns ctx.Err().
+func ExecuteWithOptions(ctx context.Context, inputPath string, outputPath string, opts Options) (Balance, error) {
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return Balance{}, fmt.Errorf("failed to open file at %s: %w", inputPath, err)
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		return Balance{}, fmt.Errorf("failed to stat %s: %w", inputPath, err)
+	}
+
+	result, err := Aggregate(ctx, inputFile, info.Size(), opts)
+	if err != nil {
+		return Balance{}, err
+	}
+	return result.Balance, writeResult(ctx, outputPath, result)
+}
+
+// Aggregate splits the size bytes of input into many sections that a fixed
+// pool of workers takes from a queue, every worker aggregates all of its
+// sections into one accumulator. An *os.File is mapped, any other input is
+// read through ReadAt. Gzip and bzip2 input is recognised by its magic bytes.
+// Cancelling ctx stops the workers at their next buffer refill or
+// ctxCheckInterval and ctx.Err() is returned.
+func Aggregate(ctx context.Context, input io.ReaderAt, size int64, opts Options) (*Result, error) {
+	var balance Balance
+
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	sectionSize := opts.SectionSize
+	if sectionSize <= 0 {
+		sectionSize = DefaultSectionSize
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultSectionSize
+	}
+	format, err := opts.RecordFormat.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, decompress.HeaderSize)
+	n, _ := input.ReadAt(header, 0)
+	if compression := decompress.Detect(header[:n]); compression != decompress.None {
+		return aggregateCompressed(ctx, input, size, compression, opts)
+	}
+
+	// fall back to reading through the input when it cannot be mapped, e.g.
+	// it is empty or not a file
+	var data []byte
+	if inputFile, ok := input.(*os.File); ok {
+		if mapped, err := mapFile(inputFile, size); err == nil {
+			data = mapped
+		}
+	}
+	if data != nil {
+		// the station names are copied into the map keys, nothing refers to
+		// the mapping once the workers are done
+		defer unix.Munmap(data)
+	}
+
+	var reader io.ReaderAt = input
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+
+	numSections := int(max((size+sectionSize-1)/sectionSize, 1))
+	chunks, err := CalculateSections(reader, size, 128, format, numSections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to creat chunks from file: %w", err)
+	}
+
+	queue := make(chan Section, len(chunks))
+	for _, chunk := range chunks {
+		queue <- chunk
+	}
+	close(queue)
+
+	balance.Sections = len(chunks)
+	balance.Workers = make([]WorkerStats, numWorkers)
+
+	if opts.Progress != nil {
+		opts.Progress.Start(size)
+		defer opts.Progress.Finish()
+	}
+
+	// the first failing worker cancels the others and nothing is returned
+	group, groupCtx := errgroup.WithContext(ctx)
+	partialResults := make([]*MeasurementAggregator, numWorkers)
+
+	for i := range numWorkers {
+		group.Go(func() error {
+			aggregator := NewMeasurementAggregator()
+			stats := &balance.Workers[i]
+
+			var recordGenerator *RecordGenerator
+			if data == nil {
+				recordGenerator = NewRecordGenerator(groupCtx, input, Section{}, bufferSize, format)
+			}
+
+			for chunk := range queue {
+				if err := groupCtx.Err(); err != nil {
+					return err
+				}
+
+				started := time.Now()
+				rows := aggregator.rows
+				err := doSection(groupCtx, opts.StageLabels, strconv.Itoa(i), chunk.start, func(ctx context.Context) error {
+					if data != nil {
+						return ProcessMappedSection(ctx, data, chunk, format, &aggregator)
+					}
+					return ProcessSection(ctx, input, chunk, recordGenerator, &aggregator)
+				})
+				if err != nil {
+					return err
+				}
+
+				stats.Busy += time.Since(started)
+				stats.Sections++
+				stats.Bytes += chunk.length
+				if opts.Progress != nil {
+					opts.Progress.Add(chunk.length, aggregator.rows-rows)
+				}
+			}
+
+			partialResults[i] = &aggregator
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, poolError(ctx, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result *Result
+	doMerge(ctx, opts.StageLabels, func() {
+		result = mergeResults(partialResults, balance, format)
+	})
+	return result, nil
+}
+
+// poolError is the error of a failed worker pool, a cancelled run returns
+// ctx.Err() rather than the error of the worker that noticed it first
+func poolError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("failed to process input: %w", err)
+}
+
+// printBalance prints the balance of a run to stderr when the balance knob is
+// set, it would otherwise end up between the timings of every measured run
+func printBalance(opts solver.Options, balance Balance) {
+	if opts.Knob("balance") != 0 {
+		fmt.Fprintf(os.Stderr, "➜ [%-15s] %s\n", "iter_10", balance)
+	}
+}
+
+// newOptions maps the options of the registry onto those of this iteration
+func newOptions(opts solver.Options) (Options, error) {
+	labels := opts.Knob("labels")
+	switch labels {
+	case NoStageLabels, SectionStageLabels, RecordStageLabels:
+	default:
+		return Options{}, fmt.Errorf("invalid labels knob %d, expected 0, 1 or 2", labels)
+	}
+
+	return Options{
+		BufferSize:     opts.BufferSize,
+		Workers:        opts.Workers,
+		SectionSize:    int64(opts.Knob("section")),
+		StageLabels:    labels,
+		PerFileResults: opts.PerFile,
+		Progress:       opts.Progress,
+		RecordFormat:   RecordFormat(opts.Records),
+	}, nil
+}
+
+func init() {
+	// Workers is left zero so the pool defaults to GOMAXPROCS, BufferSize is
+	// only used by the ReadAt fallback
+	solver.Register("iter_10", solver.Options{BufferSize: 10 * 1024 * 1024}, func(ctx context.Context, inputPath string, outputPath string, opts solver.Options) error {
+		options, err := newOptions(opts)
+		if err != nil {
+			return err
+		}
+		balance, err := ExecuteWithOptions(ctx, inputPath, outputPath, options)
+		if err == nil {
+			printBalance(opts, balance)
+		}
+		return err
+	}, solver.CompressedInput, solver.ProgressReporting, solver.Cancellation, solver.RecordFormats)
+	// the section size of the queue, the block size when streaming, the
+	// StageLabels level of profiled runs, and balance=1 prints the Balance
+	solver.RegisterKnobs("iter_10", "section", "labels", "balance")
+	solver.RegisterFiles("iter_10", func(ctx context.Context, inputPaths []string, outputPath string, opts solver.Options) error {
+		options, err := newOptions(opts)
+		if err != nil {
+			return err
+		}
+		balance, err := ExecuteFiles(ctx, inputPaths, outputPath, options)
+		if err == nil {
+			printBalance(opts, balance)
+		}
+		return err
+	})
+	solver.RegisterStream("iter_10", func(ctx context.Context, input io.Reader, outputPath string, opts solver.Options) error {
+		options, err := newOptions(opts)
+		if err != nil {
+			return err
+		}
+		balance, err := ExecuteStream(ctx, input, outputPath, options)
+		if err == nil {
+			printBalance(opts, balance)
+		}
+		return err
+	})
+}
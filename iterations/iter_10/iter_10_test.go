@@ -0,0 +1,838 @@
+package iter10
+
+import (
+	"1brc-go/datagen"
+	iter09 "1brc-go/iterations/iter_09"
+	"1brc-go/stationtable"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNextRecordBoundary(t *testing.T) {
+	// indices:        0123 456789 01234
+	//                 0  \n     \n      \n
+	data := "012\n45678\n0123\n"
+	reader := strings.NewReader(data)
+
+	tests := []struct {
+		name         string
+		targetOffset int64
+		want         int64
+	}{
+		{"separator sits at the target offset", 3, 4},
+		{"separator later in the window", 0, 4},
+		{"skips ahead to the next separator", 4, 10},
+		{"last separator reached via EOF read", 14, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextRecordBoundary(reader, tt.targetOffset, len(data), '\n')
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+			// the byte right before the returned boundary must be the separator
+			if got >= 1 && data[got-1] != '\n' {
+				t.Errorf("boundary %d is not immediately after a separator", got)
+			}
+		})
+	}
+}
+
+func TestNextRecordBoundary_SeparatorBeyondBuffer(t *testing.T) {
+	// the only separator is at index 6, but the buffer only covers 3 bytes
+	reader := strings.NewReader("abcdef\n")
+
+	_, err := nextRecordBoundary(reader, 0, 3, '\n')
+	if err == nil {
+		t.Errorf("expected error when separator lies beyond the buffer window, got nil")
+	}
+}
+
+func TestNextRecordBoundary_NoSeparator(t *testing.T) {
+	reader := strings.NewReader("no-separators-here")
+
+	_, err := nextRecordBoundary(reader, 0, 100, '\n')
+	if err == nil {
+		t.Errorf("expected error when no separator is present, got nil")
+	}
+}
+
+func TestNextRecordBoundary_OffsetAtEOF(t *testing.T) {
+	data := "abc\n"
+	reader := strings.NewReader(data)
+
+	// reading at the end of the file yields no data and therefore no separator
+	_, err := nextRecordBoundary(reader, int64(len(data)), 10, '\n')
+	if err == nil {
+		t.Errorf("expected error when reading at EOF, got nil")
+	}
+}
+
+func TestCalculateChunkBoundaries(t *testing.T) {
+	// 30 bytes, a separator at every third byte (indices 2, 5, ... 29)
+	data := strings.Repeat("ab\n", 10)
+	reader := strings.NewReader(data)
+	dataSize := int64(len(data))
+
+	tests := []struct {
+		name      string
+		numChunks int
+		want      []Section
+	}{
+		// Section values are {start, length}
+		{"single chunk covers the whole file", 1, []Section{{0, 30}}},
+		{"two chunks", 2, []Section{{0, 18}, {18, 12}}},
+		{"three chunks", 3, []Section{{0, 12}, {12, 12}, {24, 6}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CalculateSections(reader, dataSize, len(data), DefaultRecordFormat, tt.numChunks)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d chunks, want %d", len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("chunk %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+
+			validateSections(t, got, data, dataSize, '\n')
+		})
+	}
+}
+
+func TestCalculateSections_MoreSectionsThanRecords(t *testing.T) {
+	data := "ab\ncd\n"
+	reader := strings.NewReader(data)
+
+	got, err := CalculateSections(reader, int64(len(data)), len(data), DefaultRecordFormat, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) > 2 {
+		t.Errorf("got %d sections for 2 records: %+v", len(got), got)
+	}
+	validateSections(t, got, data, int64(len(data)), '\n')
+}
+
+func TestCalculateChunkBoundaries_SeparatorNotFound(t *testing.T) {
+	// no separators at all, so the boundary lookup for the first chunk must fail
+	data := strings.Repeat("x", 100)
+	reader := strings.NewReader(data)
+
+	_, err := CalculateSections(reader, int64(len(data)), 10, DefaultRecordFormat, 2)
+	if err == nil {
+		t.Errorf("expected error when a chunk boundary cannot be found, got nil")
+	}
+}
+
+// validateChunks asserts the structural invariants every chunk set must satisfy:
+// full coverage of the file, no gaps or overlaps, and every internal boundary
+// landing immediately after a separator.
+func validateSections(t *testing.T, sections []Section, data string, dataSize int64, separator byte) {
+	t.Helper()
+
+	if len(sections) == 0 {
+		t.Fatalf("expected at least one section")
+	}
+	if sections[0].start != 0 {
+		t.Errorf("first chunk must start at 0, got %d", sections[0].start)
+	}
+	lastSectionEnd := sections[len(sections)-1].start + sections[len(sections)-1].length
+	if lastSectionEnd != dataSize {
+		t.Errorf("last chunk must end at dataSize %d, got %d", dataSize, lastSectionEnd)
+	}
+
+	for i, s := range sections {
+		if i > 0 && s.start != sections[i-1].start+sections[i-1].length {
+			t.Errorf("chunk %d starts at %d but previous chunk ends at %d (gap or overlap)", i, s.start, sections[i-1].start+sections[i-1].length)
+		}
+		// every boundary except the final one must sit right after a separator
+		if i < len(sections) {
+			if s.start+s.length < 1 || data[s.start+s.length-1] != separator {
+				t.Errorf("chunk %d end %d is not immediately after a separator", i, s.start+s.length)
+			}
+		}
+	}
+}
+
+// TestRecordGenerator_ReadBlock_AcrossBufferRefills reads only the middle
+// section of the file with a buffer smaller than the section, forcing the
+// generator to refill its buffer (readNextChunk) several times.
+func TestRecordGenerator_ReadBlock_AcrossBufferRefills(t *testing.T) {
+	// indices: 012\n=0-3, 45678\n=4-9, 0123\n=10-14, 5\n=15-16, 78\n=17-19, 9\n=20-21
+	reader := strings.NewReader("012\n45678\n0123\n5\n78\n9\n")
+
+	// the section covers "45678\n0123\n5\n" -> start 4, length 13
+	section := Section{start: 4, length: 13}
+	// a 6-byte buffer cannot hold the whole section, so it must refill
+	rg := NewRecordGenerator(context.Background(), reader, section, 6, DefaultRecordFormat)
+
+	want := []string{"45678\n", "0123\n", "5\n"}
+	wantOffsets := []int64{4, 10, 15}
+	for i, w := range want {
+		got, offset, err := rg.ReadBlock()
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", i, err)
+		}
+		if string(got) != w || offset != wantOffsets[i] {
+			t.Errorf("block %d: got %q at %d, want %q at %d", i, string(got), offset, w, wantOffsets[i])
+		}
+	}
+
+	// the section is exhausted, so the next read must report EOF
+	if _, _, err := rg.ReadBlock(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF after the last block, got %v", err)
+	}
+}
+
+func TestRecordGenerator_ReadBlock_NoSeparator(t *testing.T) {
+	data := "noseparator"
+	reader := strings.NewReader(data)
+	rg := NewRecordGenerator(context.Background(), reader, Section{start: 0, length: int64(len(data))}, 64, DefaultRecordFormat)
+
+	if _, _, err := rg.ReadBlock(); err == nil {
+		t.Errorf("expected error when no separator is present, got nil")
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	// records arrive from RecordGenerator without the trailing separator, so
+	// ParseRecord must not assume one is present.
+	tests := []struct {
+		name    string
+		input   []byte
+		want    Record
+		wantErr bool
+	}{
+		{
+			name:    "valid record",
+			input:   []byte("Hamburg;12.3"),
+			want:    newRecord("Hamburg", 123),
+			wantErr: false,
+		},
+		{
+			name:    "negative temperature",
+			input:   []byte("Oslo;-5.5"),
+			want:    newRecord("Oslo", -55),
+			wantErr: false,
+		},
+		{
+			name:    "single fractional digit is preserved",
+			input:   []byte("Rome;9.9"),
+			want:    newRecord("Rome", 99),
+			wantErr: false,
+		},
+		{
+			name:    "missing separator",
+			input:   []byte("Hamburg12.3"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid float",
+			input:   []byte("Hamburg;notafloat"),
+			wantErr: true,
+		},
+		{
+			name:    "empty temperature",
+			input:   []byte("Hamburg;"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRecord(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				if !bytes.Equal(got.station, tt.want.station) {
+					t.Errorf("got station %q, want %q", got.station, tt.want.station)
+				}
+				if got.temp != tt.want.temp {
+					t.Errorf("got temp %v, want %v", got.temp, tt.want.temp)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "4 digit positive",
+			input:   []byte("12.3"),
+			want:    123,
+			wantErr: false,
+		},
+		{
+			name:    "4 digit negative",
+			input:   []byte("-54.5"),
+			want:    -545,
+			wantErr: false,
+		},
+		{
+			name:    "3 digit positive",
+			input:   []byte("7.9"),
+			want:    79,
+			wantErr: false,
+		},
+		{
+			name:    "3 digit negative",
+			input:   []byte("-3.4"),
+			want:    -34,
+			wantErr: false,
+		},
+		{
+			name:    "invalid length",
+			input:   []byte("-100.5"),
+			wantErr: true,
+		},
+		{
+			name:    "empty temperature",
+			input:   []byte(""),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTemperature(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTemperature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				if got != tt.want {
+					t.Errorf("got %d, want %d", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAggregator(t *testing.T) {
+	a := NewMeasurementAggregator()
+
+	if a.cityMeasurements.Len() != 0 {
+		t.Errorf("expected empty aggregator, got %d cities", a.cityMeasurements.Len())
+	}
+}
+
+func TestAggregator_AddRecord(t *testing.T) {
+	a := NewMeasurementAggregator()
+	a.AddRecord(newRecord("Hamburg", 123))
+	a.AddRecord(newRecord("Hamburg", 50))
+	a.AddRecord(newRecord("Oslo", -30))
+
+	if a.cityMeasurements.Len() != 2 {
+		t.Errorf("expected 2 keys in table, got %d", a.cityMeasurements.Len())
+	}
+
+	if measurements, ok := a.cityMeasurements.Get([]byte("Hamburg"), hashStation([]byte("Hamburg"))); !ok {
+		t.Error("city not added to table")
+	} else if measurements.count != 2 {
+		t.Errorf("expected 2 measurements for Hamburg, got %d", measurements.count)
+	}
+	if measurements, ok := a.cityMeasurements.Get([]byte("Oslo"), hashStation([]byte("Oslo"))); !ok {
+		t.Error("city not added to table")
+	} else if measurements.count != 1 {
+		t.Errorf("expected 1 measurements for Oslo, got %d", measurements.count)
+	}
+}
+
+func TestAggregator_ListCities(t *testing.T) {
+	a := NewMeasurementAggregator()
+
+	a.AddRecord(newRecord("Hamburg", 10))
+	a.AddRecord(newRecord("Oslo", -1))
+	a.AddRecord(newRecord("Hamburg", 5))
+
+	if a.cityMeasurements.Len() != 2 {
+		t.Errorf("expected 2 cities, got %d", a.cityMeasurements.Len())
+	}
+
+	citySet := make(map[string]bool)
+	for c := range a.cityMeasurements.All() {
+		citySet[string(c)] = true
+	}
+	if !citySet["Hamburg"] {
+		t.Errorf("expected Hamburg in cities")
+	}
+	if !citySet["Oslo"] {
+		t.Errorf("expected Oslo in cities")
+	}
+}
+
+func TestReasultAggregator_CalculateMetricsForCity(t *testing.T) {
+	a1 := NewMeasurementAggregator()
+	a1.AddRecord(newRecord("Hamburg", 101))
+	a1.AddRecord(newRecord("Hamburg", -24))
+	a1.AddRecord(newRecord("Hamburg", 66))
+	// count=3, sum=14.3, min=-2.4, max=10.1
+
+	a2 := NewMeasurementAggregator()
+	a2.AddRecord(newRecord("Hamburg", -30))
+	a2.AddRecord(newRecord("Hamburg", 72))
+	// count=2, sum=4.2, min=-3.0, max=7.2
+	a2.AddRecord(newRecord("Oslo", 72))
+
+	resAgg := NewResultAggregator()
+
+	resAgg.AddPartialResults(a1.cityMeasurements)
+	resAgg.AddPartialResults(a2.cityMeasurements)
+
+	metrics, err := resAgg.CalculateMetricsForCity("Hamburg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metrics.min != -3.0 {
+		t.Errorf("got min %v, want -2.0", metrics.min)
+	}
+	if metrics.max != 10.1 {
+		t.Errorf("got max %v, want 10.0", metrics.max)
+	}
+	expectedAvg := 18.5 / 5.0
+	if metrics.avg != expectedAvg {
+		t.Errorf("got avg %v, want %v", metrics.avg, expectedAvg)
+	}
+}
+
+func TestNewResultAggregator(t *testing.T) {
+	ra := NewResultAggregator()
+	if ra.allResults == nil {
+		t.Fatal("expected initialized results map, got nil")
+	}
+	if len(ra.allResults) != 0 {
+		t.Errorf("expected empty aggregator, got %d cities", len(ra.allResults))
+	}
+}
+
+func TestResultAggregator_AddPartialResults_NewCities(t *testing.T) {
+	ra := NewResultAggregator()
+
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: 1.0, max: 5.0, sum: 12.0, count: 3},
+		"Oslo":    {min: -4.0, max: 2.0, sum: -2.0, count: 2},
+	}))
+
+	assertMeasurements(t, ra.allResults, "Hamburg", AggregatedMeasurements{min: 1.0, max: 5.0, sum: 12.0, count: 3})
+	assertMeasurements(t, ra.allResults, "Oslo", AggregatedMeasurements{min: -4.0, max: 2.0, sum: -2.0, count: 2})
+
+	if len(ra.allResults) != 2 {
+		t.Errorf("expected 2 cities, got %d", len(ra.allResults))
+	}
+}
+
+func TestResultAggregator_AddPartialResults_MergeOverlappingCity(t *testing.T) {
+	ra := NewResultAggregator()
+
+	// two partial results for the same city produced by different workers
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: 3.0, max: 10.0, sum: 20.0, count: 4},
+	}))
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: -1.0, max: 8.0, sum: 15.0, count: 3},
+	}))
+
+	// min/max take the extremes, sum and count accumulate
+	assertMeasurements(t, ra.allResults, "Hamburg", AggregatedMeasurements{min: -1.0, max: 10.0, sum: 35.0, count: 7})
+
+	if len(ra.allResults) != 1 {
+		t.Errorf("expected 1 city after merging, got %d", len(ra.allResults))
+	}
+}
+
+func TestResultAggregator_AddPartialResults_MixedMerge(t *testing.T) {
+	ra := NewResultAggregator()
+
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: 3.0, max: 10.0, sum: 20.0, count: 4},
+		"Oslo":    {min: -4.0, max: 2.0, sum: -2.0, count: 2},
+	}))
+	// second batch overlaps on Hamburg and introduces a brand new city
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: 5.0, max: 12.0, sum: 30.0, count: 3},
+		"Rome":    {min: 15.0, max: 25.0, sum: 60.0, count: 3},
+	}))
+
+	assertMeasurements(t, ra.allResults, "Hamburg", AggregatedMeasurements{min: 3.0, max: 12.0, sum: 50.0, count: 7})
+	assertMeasurements(t, ra.allResults, "Oslo", AggregatedMeasurements{min: -4.0, max: 2.0, sum: -2.0, count: 2})
+	assertMeasurements(t, ra.allResults, "Rome", AggregatedMeasurements{min: 15.0, max: 25.0, sum: 60.0, count: 3})
+
+	if len(ra.allResults) != 3 {
+		t.Errorf("expected 3 cities, got %d", len(ra.allResults))
+	}
+}
+
+func TestResultAggregator_AddPartialResults_Empty(t *testing.T) {
+	ra := NewResultAggregator()
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{
+		"Hamburg": {min: 1.0, max: 5.0, sum: 6.0, count: 2},
+	}))
+
+	// merging an empty partial result must leave existing data untouched
+	ra.AddPartialResults(newTable(map[string]*AggregatedMeasurements{}))
+
+	assertMeasurements(t, ra.allResults, "Hamburg", AggregatedMeasurements{min: 1.0, max: 5.0, sum: 6.0, count: 2})
+	if len(ra.allResults) != 1 {
+		t.Errorf("expected 1 city, got %d", len(ra.allResults))
+	}
+}
+
+func newRecord(station string, temp int) Record {
+	return Record{station: []byte(station), hash: hashStation([]byte(station)), temp: temp}
+}
+
+// newTable returns the stations as a partial result of a worker
+func newTable(measurements map[string]*AggregatedMeasurements) *stationtable.Table[AggregatedMeasurements] {
+	table := stationtable.New[AggregatedMeasurements](stationtable.DefaultCapacity)
+	for station, m := range measurements {
+		v, _ := table.GetOrInsert([]byte(station), hashStation([]byte(station)))
+		*v = *m
+	}
+	return table
+}
+
+// assertMeasurements checks that a city exists in the results map and its
+// aggregated measurements match the expected values exactly.
+func assertMeasurements(t *testing.T, results map[string]*AggregatedMeasurements, city string, want AggregatedMeasurements) {
+	t.Helper()
+
+	got, ok := results[city]
+	if !ok {
+		t.Fatalf("expected city %q in results, but it is missing", city)
+	}
+	if *got != want {
+		t.Errorf("city %q: got %+v, want %+v", city, *got, want)
+	}
+}
+
+func TestFormatMetrics(t *testing.T) {
+	expected := "Budapest=-13.2/21.4/41.0"
+	got := FormatMetrics("Budapest", Metrics{min: -13.245, avg: 21.35, max: 41.0})
+	if got != expected {
+		t.Errorf("failed to format metrics properly, expected: %s, got: %s", expected, got)
+	}
+}
+
+func TestRoundToOneDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		input float64
+		want  float64
+	}{
+		{
+			name:  "positive non-tie up",
+			input: 2.98,
+			want:  3.0,
+		},
+		{
+			name:  "positive non-tie down",
+			input: 2.33,
+			want:  2.3,
+		},
+		{
+			name:  "negative non-tie up",
+			input: -1.33,
+			want:  -1.3,
+		},
+		{
+			name:  "negative non-tie down",
+			input: -4.77,
+			want:  -4.8,
+		},
+		{
+			name:  "positive tie",
+			input: 1.65,
+			want:  1.7,
+		},
+		{
+			name:  "negative tie",
+			input: -3.35,
+			want:  -3.3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RoundToOneDecimal(tt.input)
+
+			if got != tt.want {
+				t.Errorf("got %f, want %f", got, tt.want)
+			}
+
+		})
+	}
+}
+
+func TestProcessSection_RecordError(t *testing.T) {
+	// the malformed record starts at offset 23
+	data := "Hamburg;12.3\nOslo;-5.5\nRome9.9\nBerlin;1.0\n"
+	reader := strings.NewReader(data)
+
+	section := Section{start: 0, length: int64(len(data))}
+	aggregator := NewMeasurementAggregator()
+	rg := NewRecordGenerator(context.Background(), reader, section, 16, DefaultRecordFormat)
+
+	err := ProcessSection(context.Background(), reader, section, rg, &aggregator)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.SectionStart != 0 {
+		t.Errorf("got section start %d, want 0", recordErr.SectionStart)
+	}
+	if recordErr.Offset != 23 {
+		t.Errorf("got offset %d, want 23", recordErr.Offset)
+	}
+	if recordErr.Line != "Rome9.9" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "Rome9.9")
+	}
+}
+
+func TestProcessSection_CancelledContext(t *testing.T) {
+	data := "Hamburg;12.3\nOslo;-5.5\n"
+	reader := strings.NewReader(data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	section := Section{start: 0, length: int64(len(data))}
+	aggregator := NewMeasurementAggregator()
+	rg := NewRecordGenerator(ctx, reader, section, 64, DefaultRecordFormat)
+
+	if err := ProcessSection(ctx, reader, section, rg, &aggregator); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExecute_NoOutputOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "measurements.txt")
+	outputPath := filepath.Join(dir, "results.txt")
+
+	data := strings.Repeat("Hamburg;12.3\n", 100) + "broken\n" + strings.Repeat("Oslo;-5.5\n", 100)
+	if err := os.WriteFile(inputPath, []byte(data), 0666); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	err := Execute(inputPath, outputPath, 64, 4)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Line != "broken" {
+		t.Errorf("got line %q, want %q", recordErr.Line, "broken")
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file on failure, got %v", err)
+	}
+}
+
+func TestExecuteWithOptions_Cancelled(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+
+	for _, mapped := range []bool{true, false} {
+		t.Run(fmt.Sprintf("mapped=%v", mapped), func(t *testing.T) {
+			if !mapped {
+				original := mapFile
+				mapFile = func(file *os.File, size int64) ([]byte, error) {
+					return nil, errors.New("mapping disabled")
+				}
+				defer func() { mapFile = original }()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			outputPath := filepath.Join(t.TempDir(), "results.txt")
+			_, err := ExecuteWithOptions(ctx, inputPath, outputPath, Options{BufferSize: 1024, Workers: 4, SectionSize: 4096})
+			if err != context.Canceled {
+				t.Errorf("expected context.Canceled itself, got %v", err)
+			}
+			if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected no output file after cancelling, got %v", err)
+			}
+		})
+	}
+}
+
+// countingProgress sums what the workers report
+type countingProgress struct {
+	total    atomic.Int64
+	bytes    atomic.Int64
+	rows     atomic.Int64
+	finished atomic.Int32
+}
+
+func (p *countingProgress) Start(totalBytes int64) { p.total.Store(totalBytes) }
+func (p *countingProgress) Add(bytes int64, rows int64) {
+	p.bytes.Add(bytes)
+	p.rows.Add(rows)
+}
+func (p *countingProgress) Finish() { p.finished.Add(1) }
+
+func TestExecuteWithOptions_ReportsProgress(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := &countingProgress{}
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{Workers: 4, SectionSize: 4096, Progress: progress}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if progress.total.Load() != info.Size() || progress.bytes.Load() != info.Size() {
+		t.Errorf("got %d of %d bytes, want %d of %d", progress.bytes.Load(), progress.total.Load(), info.Size(), info.Size())
+	}
+	if progress.rows.Load() != 10_000 {
+		t.Errorf("got %d rows, want 10000", progress.rows.Load())
+	}
+	if progress.finished.Load() != 1 {
+		t.Errorf("Finish called %d times, want once", progress.finished.Load())
+	}
+}
+
+func TestProcessMappedSection_RecordError(t *testing.T) {
+	data := []byte("Hamburg;12.3\nOslo;-5.5\nRome9.9\nBerlin;1.0\n")
+
+	aggregator := NewMeasurementAggregator()
+	err := ProcessMappedSection(context.Background(), data, Section{start: 0, length: int64(len(data))}, DefaultRecordFormat, &aggregator)
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *RecordError, got %v", err)
+	}
+	if recordErr.Offset != 23 || recordErr.Line != "Rome9.9" {
+		t.Errorf("got record %q at %d, want %q at 23", recordErr.Line, recordErr.Offset, "Rome9.9")
+	}
+}
+
+func TestProcessMappedSection_CancelledContext(t *testing.T) {
+	data := []byte("Hamburg;12.3\nOslo;-5.5\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	aggregator := NewMeasurementAggregator()
+	if err := ProcessMappedSection(ctx, data, Section{start: 0, length: int64(len(data))}, DefaultRecordFormat, &aggregator); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func writeTestInput(t testing.TB, rows int64) string {
+	t.Helper()
+
+	inputPath := filepath.Join(t.TempDir(), "measurements.txt")
+	f, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatalf("failed to create input: %v", err)
+	}
+	defer f.Close()
+
+	if err := datagen.Generate(f, datagen.Config{Rows: rows, Seed: 1, Stations: datagen.DefaultStations}); err != nil {
+		t.Fatalf("failed to generate input: %v", err)
+	}
+	return inputPath
+}
+
+func TestExecute_MappedMatchesFallback(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	dir := t.TempDir()
+
+	// many more sections than workers
+	opts := Options{BufferSize: 1024, Workers: 4, SectionSize: 4096}
+
+	mappedPath := filepath.Join(dir, "mapped.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, mappedPath, opts); err != nil {
+		t.Fatalf("mapped run failed: %v", err)
+	}
+
+	mapped := mapFile
+	mapFile = func(file *os.File, size int64) ([]byte, error) {
+		return nil, errors.New("mapping disabled")
+	}
+	defer func() { mapFile = mapped }()
+
+	fallbackPath := filepath.Join(dir, "fallback.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, fallbackPath, opts); err != nil {
+		t.Fatalf("fallback run failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(mappedPath)
+	want, _ := os.ReadFile(fallbackPath)
+	if len(got) == 0 || !bytes.Equal(got, want) {
+		t.Errorf("mapped output differs from the ReadAt fallback:\n%s\n%s", got, want)
+	}
+}
+
+func TestExecute_EmptyInput(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "empty.txt")
+	outputPath := filepath.Join(dir, "results.txt")
+	if err := os.WriteFile(inputPath, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty file cannot be mapped and takes the fallback path
+	if err := Execute(inputPath, outputPath, 64, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(outputPath); string(got) != "{}\n" {
+		t.Errorf("got %q, want %q", got, "{}\n")
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	inputPath := writeTestInput(b, 1_000_000)
+	outputPath := filepath.Join(b.TempDir(), "results.txt")
+
+	b.Run("iter_09", func(b *testing.B) {
+		for b.Loop() {
+			if err := iter09.Execute(inputPath, outputPath, 10*1024*1024, 8); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("iter_10", func(b *testing.B) {
+		for b.Loop() {
+			// GOMAXPROCS workers and 64 KiB sections for the 1M rows
+			if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{BufferSize: 10 * 1024 * 1024, SectionSize: 64 * 1024}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
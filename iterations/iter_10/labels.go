@@ -0,0 +1,150 @@
+package iter10
+
+import (
+	"context"
+	"io"
+	"runtime/pprof"
+	"strconv"
+)
+
+// the levels of Options.StageLabels
+const (
+	NoStageLabels = iota
+	// worker, section and stage, the records of a block are parsed and
+	// aggregated in one stage as always
+	SectionStageLabels
+	// the records are parsed and aggregated in batches with a stage each,
+	// which makes the runs about a third slower
+	RecordStageLabels
+)
+
+// the stages of the pipeline the CPU profile samples are labelled with
+const (
+	stageRead           = "read"
+	stageParseAggregate = "parse+aggregate"
+	stageParse          = "parse"
+	stageAggregate      = "aggregate"
+	stageMerge          = "merge"
+)
+
+// stageLabelsKey holds the level of a labelled section in its context
+type stageLabelsKey struct{}
+
+// doSection runs fn for a section of a worker, with stage labels its samples
+// carry the worker, the start of the section and the read stage. processBlock
+// moves to the stages of the records of every block.
+func doSection(ctx context.Context, level int, worker string, start int64, fn func(ctx context.Context) error) error {
+	if level == NoStageLabels {
+		return fn(ctx)
+	}
+
+	var err error
+	labels := pprof.Labels("worker", worker, "section", strconv.FormatInt(start, 10), "stage", stageRead)
+	pprof.Do(context.WithValue(ctx, stageLabelsKey{}, level), labels, func(ctx context.Context) {
+		err = fn(ctx)
+	})
+	return err
+}
+
+// doMerge runs fn in the merge stage
+func doMerge(ctx context.Context, level int, fn func()) {
+	if level == NoStageLabels {
+		fn()
+		return
+	}
+	pprof.Do(ctx, pprof.Labels("stage", stageMerge), func(context.Context) {
+		fn()
+	})
+}
+
+// stageBatch records are parsed before they are aggregated with
+// RecordStageLabels. Switching the labels of the goroutine costs about as much
+// as parsing a record, so it is not done per record. The copies of the
+// records in a batch are what slows the runs down.
+const stageBatch = 1024
+
+// stageSwitch holds the labels of the stages of a block's records
+type stageSwitch struct {
+	level                              int
+	section, records, parse, aggregate context.Context
+}
+
+// newStageSwitch has the level of the section labelled by doSection, none
+// outside of one
+func newStageSwitch(ctx context.Context) stageSwitch {
+	level, _ := ctx.Value(stageLabelsKey{}).(int)
+	switch level {
+	case SectionStageLabels:
+		return stageSwitch{
+			level:   level,
+			section: ctx,
+			records: pprof.WithLabels(ctx, pprof.Labels("stage", stageParseAggregate)),
+		}
+	case RecordStageLabels:
+		return stageSwitch{
+			level:     level,
+			section:   ctx,
+			parse:     pprof.WithLabels(ctx, pprof.Labels("stage", stageParse)),
+			aggregate: pprof.WithLabels(ctx, pprof.Labels("stage", stageAggregate)),
+		}
+	default:
+		return stageSwitch{}
+	}
+}
+
+// processBlockStaged is processBlock in batches of stageBatch records, each
+// scanned in the parse stage and then added in the aggregate stage. The
+// goroutine is back in the labels of the section when it returns.
+func processBlockStaged(ctx context.Context, block []byte, blockStart int64, chunk Section, format RecordFormat, aggregator *MeasurementAggregator, stages stageSwitch) error {
+	defer pprof.SetGoroutineLabels(stages.section)
+
+	scanner := NewFormatScanner(block, format)
+	records := make([]Record, 0, stageBatch)
+	offsets := make([]int, 0, stageBatch)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pprof.SetGoroutineLabels(stages.parse)
+		var scanErr error
+		for len(records) < stageBatch {
+			record, err := scanner.Next()
+			if err != nil {
+				scanErr = err
+				break
+			}
+			records = append(records, record)
+			offsets = append(offsets, scanner.Offset())
+		}
+
+		pprof.SetGoroutineLabels(stages.aggregate)
+		for i, record := range records {
+			if err := aggregator.AddRecord(record); err != nil {
+				aggregator.rows += int64(i)
+				failed := RecordScanner{data: block, recordStart: offsets[i], format: format}
+				return &RecordError{
+					SectionStart: chunk.start,
+					Offset:       blockStart + int64(offsets[i]),
+					Line:         string(failed.Line()),
+					Err:          err,
+				}
+			}
+		}
+		aggregator.rows += int64(len(records))
+		records, offsets = records[:0], offsets[:0]
+
+		if scanErr == io.EOF {
+			return nil
+		}
+		if scanErr != nil {
+			return &RecordError{
+				SectionStart: chunk.start,
+				Offset:       blockStart + int64(scanner.Offset()),
+				Line:         string(scanner.Line()),
+				Err:          scanErr,
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package iter10
+
+import (
+	"1brc-go/solver"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestNewStageSwitch(t *testing.T) {
+	if newStageSwitch(context.Background()).level != NoStageLabels {
+		t.Errorf("expected no stage switch outside of a labelled section")
+	}
+
+	doSection(context.Background(), SectionStageLabels, "3", 128, func(ctx context.Context) error {
+		if stage, _ := pprof.Label(newStageSwitch(ctx).records, "stage"); stage != stageParseAggregate {
+			t.Errorf("got stage label %q, want %q", stage, stageParseAggregate)
+		}
+		return nil
+	})
+
+	err := doSection(context.Background(), RecordStageLabels, "3", 128, func(ctx context.Context) error {
+		stages := newStageSwitch(ctx)
+		if stages.level != RecordStageLabels {
+			t.Errorf("expected the record stages in a labelled section")
+		}
+		if worker, _ := pprof.Label(ctx, "worker"); worker != "3" {
+			t.Errorf("got worker label %q, want %q", worker, "3")
+		}
+		if stage, _ := pprof.Label(stages.aggregate, "stage"); stage != stageAggregate {
+			t.Errorf("got stage label %q, want %q", stage, stageAggregate)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doSection(context.Background(), NoStageLabels, "3", 128, func(ctx context.Context) error {
+		if _, ok := pprof.Label(ctx, "stage"); ok {
+			t.Errorf("expected no labels when disabled")
+		}
+		return nil
+	})
+}
+
+func TestAggregate_StageLabels(t *testing.T) {
+	input := strings.Repeat("Oslo;-5.5\nHamburg;12.3\nAbha;30.0\n", 200)
+	path := filepath.Join(t.TempDir(), "measurements.txt")
+	os.WriteFile(path, []byte(input), 0666)
+
+	// the labels only show up in a profile, so one is running
+	var profile bytes.Buffer
+	if err := pprof.StartCPUProfile(&profile); err == nil {
+		defer pprof.StopCPUProfile()
+	}
+
+	aggregate := func(opts Options) map[string]string {
+		file, _ := os.Open(path)
+		defer file.Close()
+
+		results := make(map[string]string)
+		for name, run := range map[string]func() (*Result, error){
+			"mapped": func() (*Result, error) { return Aggregate(context.Background(), file, int64(len(input)), opts) },
+			"read at": func() (*Result, error) {
+				return Aggregate(context.Background(), strings.NewReader(input), int64(len(input)), opts)
+			},
+			"stream": func() (*Result, error) { return AggregateStream(context.Background(), strings.NewReader(input), opts) },
+		} {
+			result, err := run()
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			var buf bytes.Buffer
+			result.WriteTo(&buf)
+			results[name] = buf.String()
+		}
+		return results
+	}
+
+	want := aggregate(Options{Workers: 3, SectionSize: 100, BufferSize: 64})
+	for _, level := range []int{SectionStageLabels, RecordStageLabels} {
+		got := aggregate(Options{Workers: 3, SectionSize: 100, BufferSize: 64, StageLabels: level})
+		for name := range want {
+			if got[name] != want[name] {
+				t.Errorf("%s with level %d: got\n%s\nwant\n%s", name, level, got[name], want[name])
+			}
+		}
+	}
+}
+
+func TestProcessBlockStaged_RecordError(t *testing.T) {
+	block := []byte(strings.Repeat("Oslo;-5.5\n", stageBatch+3) + "Hamburg12.3\nAbha;30.0\n")
+	chunk := Section{start: 4096, length: int64(len(block))}
+
+	process := func(ctx context.Context) (*RecordError, int64) {
+		aggregator := NewMeasurementAggregator()
+		var recordErr *RecordError
+		if !errors.As(processBlock(ctx, block, 4096, chunk, DefaultRecordFormat, &aggregator), &recordErr) {
+			t.Fatalf("expected a RecordError")
+		}
+		return recordErr, aggregator.rows
+	}
+
+	want, wantRows := process(context.Background())
+	doSection(context.Background(), RecordStageLabels, "0", chunk.start, func(ctx context.Context) error {
+		got, rows := process(ctx)
+		if got.Error() != want.Error() || got.Offset != want.Offset || rows != wantRows {
+			t.Errorf("got %+v after %d rows, want %+v after %d rows", got, rows, want, wantRows)
+		}
+		return nil
+	})
+}
+
+func TestSolver_InvalidLabels(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "measurements.txt")
+	os.WriteFile(inputPath, []byte("Oslo;-5.5\n"), 0666)
+
+	for _, knobs := range []string{"labels=3", "labels=-1"} {
+		s, err := solver.New("iter_10", solver.Options{Knobs: knobs})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		outputPath := filepath.Join(t.TempDir(), "results.txt")
+		runs := map[string]func() error{
+			"run":    func() error { return s.Run(context.Background(), inputPath, outputPath) },
+			"files":  func() error { return s.RunFiles(context.Background(), []string{inputPath}, outputPath) },
+			"stream": func() error { return s.Stream(context.Background(), strings.NewReader("Oslo;-5.5\n"), outputPath) },
+		}
+		for name, run := range runs {
+			if err := run(); err == nil || !strings.Contains(err.Error(), "invalid labels knob") {
+				t.Errorf("%s with %s: expected an invalid labels knob error, got %v", name, knobs, err)
+			}
+			if _, err := os.Stat(outputPath); err == nil {
+				t.Errorf("%s with %s: expected no output", name, knobs)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package iter10
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"slices"
+	"strings"
+)
+
+// StationStats are the aggregated measurements of one station in degrees,
+// Min, Mean and Max are not rounded
+type StationStats struct {
+	Station string
+	Min     float64
+	Mean    float64
+	Max     float64
+	Sum     float64
+	Count   int64
+}
+
+// Result holds the stations of a run sorted by name, together with how the
+// work was spread over the workers
+type Result struct {
+	stations []StationStats
+	Balance  Balance
+}
+
+// newResult converts the merged measurements, the temperatures are kept in
+// units of the last decimal of format until here
+func newResult(resultAgg *ResultAggregator, balance Balance, format RecordFormat) *Result {
+	scale := format.scale()
+
+	cities := resultAgg.ListCities()
+	slices.Sort(cities)
+
+	stations := make([]StationStats, len(cities))
+	for i, city := range cities {
+		measurements := resultAgg.allResults[city]
+		stations[i] = StationStats{
+			Station: city,
+			Min:     float64(measurements.min) / float64(scale),
+			Mean:    float64(measurements.sum) / float64(measurements.count*scale),
+			Max:     float64(measurements.max) / float64(scale),
+			Sum:     float64(measurements.sum) / float64(scale),
+			Count:   int64(measurements.count),
+		}
+	}
+
+	return &Result{stations: stations, Balance: balance}
+}
+
+// mergeResults merges the workers' aggregators into a Result
+func mergeResults(partialResults []*MeasurementAggregator, balance Balance, format RecordFormat) *Result {
+	resultAgg := NewResultAggregator()
+	for _, res := range partialResults {
+		resultAgg.AddPartialResults(res.cityMeasurements)
+	}
+
+	return newResult(&resultAgg, balance, format)
+}
+
+// Len is the number of stations
+func (r *Result) Len() int {
+	return len(r.stations)
+}
+
+// All yields the stations sorted by name
+func (r *Result) All() iter.Seq[StationStats] {
+	return func(yield func(StationStats) bool) {
+		for _, stats := range r.stations {
+			if !yield(stats) {
+				return
+			}
+		}
+	}
+}
+
+// Get returns the stats of station, false when it had no measurements
+func (r *Result) Get(station string) (StationStats, bool) {
+	i, found := slices.BinarySearchFunc(r.stations, station, func(stats StationStats, station string) int {
+		return strings.Compare(stats.Station, station)
+	})
+	if !found {
+		return StationStats{}, false
+	}
+	return r.stations[i], true
+}
+
+// WriteTo writes the stations in the challenge's output format,
+// {Abha=-23.0/18.0/59.2, Abidjan=-16.2/26.0/67.3, ...} and a newline
+func (r *Result) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	sb.WriteString("{")
+
+	for i, stats := range r.stations {
+		sb.WriteString(FormatMetrics(stats.Station, Metrics{min: stats.Min, avg: stats.Mean, max: stats.Max}))
+
+		// don't add separator after last element
+		if i+1 < len(r.stations) {
+			sb.WriteString(", ")
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// writeResult writes the result to outputPath unless ctx is done, a failed
+// write removes the output rather than leaving it half written
+func writeResult(ctx context.Context, outputPath string, result *Result) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	result.WriteTo(&buf)
+
+	// the output is only created once the results are complete
+	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+
+	_, err = outputFile.Write(buf.Bytes())
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
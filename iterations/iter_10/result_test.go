@@ -0,0 +1,112 @@
+package iter10
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAggregate_Stations(t *testing.T) {
+	input := "Oslo;-5.5\nHamburg;12.3\nOslo;1.5\nAbha;30.0\nHamburg;-0.3\n"
+
+	result, err := Aggregate(context.Background(), strings.NewReader(input), int64(len(input)), Options{Workers: 2, SectionSize: 16})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stations []StationStats
+	for stats := range result.All() {
+		stations = append(stations, stats)
+	}
+	want := []StationStats{
+		{Station: "Abha", Min: 30, Mean: 30, Max: 30, Sum: 30, Count: 1},
+		{Station: "Hamburg", Min: -0.3, Mean: 6, Max: 12.3, Sum: 12, Count: 2},
+		{Station: "Oslo", Min: -5.5, Mean: -2, Max: 1.5, Sum: -4, Count: 2},
+	}
+	if !slices.Equal(stations, want) || result.Len() != len(want) {
+		t.Errorf("got %d stations %v, want %v", result.Len(), stations, want)
+	}
+
+	if stats, ok := result.Get("Hamburg"); !ok || stats != want[1] {
+		t.Errorf("Get(Hamburg) = %v, %v, want %v", stats, ok, want[1])
+	}
+	if _, ok := result.Get("Rome"); ok {
+		t.Errorf("Get(Rome) found a station without measurements")
+	}
+
+	var buf bytes.Buffer
+	n, err := result.WriteTo(&buf)
+	if wantOutput := "{Abha=30.0/30.0/30.0, Hamburg=-0.3/6.0/12.3, Oslo=-5.5/-2.0/1.5}\n"; err != nil || n != int64(buf.Len()) || buf.String() != wantOutput {
+		t.Errorf("WriteTo wrote %d bytes %q (%v), want %q", n, buf.String(), err, wantOutput)
+	}
+}
+
+func TestAggregate_MatchesExecute(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, outputPath, Options{Workers: 4}); err != nil {
+		t.Fatalf("file run failed: %v", err)
+	}
+	want, _ := os.ReadFile(outputPath)
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// any io.ReaderAt goes through the ReadAt path, the file is mapped
+	file, err := os.Open(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	inputs := map[string]func() (*Result, error){
+		"bytes": func() (*Result, error) {
+			return Aggregate(context.Background(), bytes.NewReader(data), int64(len(data)), Options{BufferSize: 4096, Workers: 3, SectionSize: 4096})
+		},
+		"file": func() (*Result, error) {
+			return Aggregate(context.Background(), file, int64(len(data)), Options{Workers: 3, SectionSize: 4096})
+		},
+		"stream": func() (*Result, error) {
+			return AggregateStream(context.Background(), bytes.NewReader(data), Options{Workers: 3, SectionSize: 4096})
+		},
+	}
+
+	for name, aggregate := range inputs {
+		t.Run(name, func(t *testing.T) {
+			result, err := aggregate()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got bytes.Buffer
+			result.WriteTo(&got)
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("result differs from the written output:\n%s\n%s", got.Bytes(), want)
+			}
+			if result.Balance.Sections == 0 || len(result.Balance.Workers) != 3 {
+				t.Errorf("got %d sections on %d workers, want the balance of the run", result.Balance.Sections, len(result.Balance.Workers))
+			}
+		})
+	}
+}
+
+func TestAggregate_RecordError(t *testing.T) {
+	input := "Hamburg;12.3\nRome9.9\n"
+
+	result, err := Aggregate(context.Background(), strings.NewReader(input), int64(len(input)), Options{Workers: 2})
+
+	var recordErr *RecordError
+	if !errors.As(err, &recordErr) || result != nil {
+		t.Fatalf("expected only a *RecordError, got %v and %v", result, err)
+	}
+	if recordErr.Offset != 13 || recordErr.Line != "Rome9.9" {
+		t.Errorf("got record %q at %d, want %q at 13", recordErr.Line, recordErr.Offset, "Rome9.9")
+	}
+}
@@ -0,0 +1,225 @@
+package iter10
+
+import (
+	"1brc-go/decompress"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// streamBlock is a buffer of complete records read from a stream, buffer is
+// handed back to the reader once a worker is done with data
+type streamBlock struct {
+	buffer []byte
+	data   []byte
+	start  int64
+}
+
+// every worker can hold one block while the reader fills the next ones, more
+// buffers than that only add memory
+const buffersPerWorker = 2
+
+// ExecuteStream aggregates the records read from input and writes the sorted
+// results to outputPath, see AggregateStream. Cancelling ctx leaves no output
+// behind and returns ctx.Err().
+func ExecuteStream(ctx context.Context, input io.Reader, outputPath string, opts Options) (Balance, error) {
+	result, err := AggregateStream(ctx, input, opts)
+	if err != nil {
+		return Balance{}, err
+	}
+	return result.Balance, writeResult(ctx, outputPath, result)
+}
+
+// AggregateStream aggregates records read sequentially from input, e.g. stdin
+// or a pipe, with the same pool of workers as Aggregate. A single reader cuts
+// the stream into record-aligned blocks of SectionSize bytes, so the input
+// never has to exist as a file. Gzip and bzip2 streams are recognised by
+// their magic bytes and decompressed by the reader.
+//
+// Cancelling ctx stops the reader and the workers, but a Read that is
+// blocked waiting for data can only be interrupted when input has a read
+// deadline (pipes and sockets do), otherwise it returns with the next data.
+func AggregateStream(ctx context.Context, input io.Reader, opts Options) (*Result, error) {
+	var balance Balance
+
+	if deadline, ok := input.(interface{ SetReadDeadline(time.Time) error }); ok {
+		stop := context.AfterFunc(ctx, func() {
+			deadline.SetReadDeadline(time.Now())
+		})
+		defer stop()
+	}
+
+	input, _, err := decompress.NewReader(input)
+	if err != nil {
+		return nil, err
+	}
+
+	numWorkers := opts.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	blockSize := opts.SectionSize
+	if blockSize <= 0 {
+		blockSize = DefaultSectionSize
+	}
+	format, err := opts.RecordFormat.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	balance.Workers = make([]WorkerStats, numWorkers)
+	if opts.Progress != nil {
+		opts.Progress.Start(-1)
+		defer opts.Progress.Finish()
+	}
+
+	// the first failing goroutine cancels the others and nothing is returned
+	group, groupCtx := errgroup.WithContext(ctx)
+	blocks := make(chan streamBlock, numWorkers)
+	free := make(chan []byte, numWorkers*buffersPerWorker)
+
+	group.Go(func() error {
+		defer close(blocks)
+
+		return doSection(groupCtx, opts.StageLabels, "reader", 0, func(ctx context.Context) error {
+			sections, err := readBlocks(ctx, input, int(blockSize), format, numWorkers*buffersPerWorker, free, blocks)
+			balance.Sections = sections
+			return err
+		})
+	})
+
+	partialResults := make([]*MeasurementAggregator, numWorkers)
+	for i := range numWorkers {
+		group.Go(func() error {
+			aggregator := NewMeasurementAggregator()
+			stats := &balance.Workers[i]
+
+			for block := range blocks {
+				started := time.Now()
+				rows := aggregator.rows
+				chunk := Section{start: block.start, length: int64(len(block.data))}
+				err := doSection(groupCtx, opts.StageLabels, strconv.Itoa(i), block.start, func(ctx context.Context) error {
+					return processBlock(ctx, block.data, block.start, chunk, format, &aggregator)
+				})
+				if err != nil {
+					return err
+				}
+				free <- block.buffer
+
+				stats.Busy += time.Since(started)
+				stats.Sections++
+				stats.Bytes += chunk.length
+				if opts.Progress != nil {
+					opts.Progress.Add(chunk.length, aggregator.rows-rows)
+				}
+			}
+
+			partialResults[i] = &aggregator
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, poolError(ctx, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result *Result
+	doMerge(ctx, opts.StageLabels, func() {
+		result = mergeResults(partialResults, balance, format)
+	})
+	return result, nil
+}
+
+// readBlocks fills buffers of blockSize bytes from input and sends the
+// complete records of format in each one to blocks. The partial record at the
+// end of a buffer is carried over to the next one. At most maxBuffers buffers
+// are allocated, the workers return them through free. It returns the number
+// of blocks sent.
+func readBlocks(ctx context.Context, input io.Reader, blockSize int, format RecordFormat, maxBuffers int, free chan []byte, blocks chan<- streamBlock) (int, error) {
+	var carry []byte
+	var offset int64
+	sent, allocated := 0, 0
+	separator := format.RecordSeparator
+	skipHeader := format.Header
+
+	for {
+		var buffer []byte
+		select {
+		case buffer = <-free:
+		default:
+			if allocated < maxBuffers {
+				buffer = make([]byte, blockSize)
+				allocated++
+				break
+			}
+			select {
+			case buffer = <-free:
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			}
+		}
+
+		n := copy(buffer, carry)
+		read, err := io.ReadFull(input, buffer[n:])
+		data := buffer[:n+read]
+		atEOF := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !atEOF {
+			return sent, fmt.Errorf("failed to read input at offset %d: %w", offset+int64(n), err)
+		}
+
+		// a header that does not fit the first buffer fails like any other record
+		if skipHeader {
+			if idx := bytes.IndexByte(data, separator); idx != -1 {
+				data = data[idx+1:]
+				offset += int64(idx + 1)
+				skipHeader = false
+			}
+		}
+
+		end := bytes.LastIndexByte(data, separator) + 1
+		switch {
+		case atEOF && end < len(data):
+			return sent, &RecordError{
+				SectionStart: offset,
+				Offset:       offset + int64(end),
+				Line:         string(data[end:]),
+				Err:          errors.New("last record is not terminated by a newline"),
+			}
+		case end == 0 && len(data) == len(buffer):
+			return sent, &RecordError{
+				SectionStart: offset,
+				Offset:       offset,
+				Err:          fmt.Errorf("no record separator within %d bytes", blockSize),
+			}
+		}
+
+		// the partial record is copied out before the buffer goes to a worker
+		carry = append(carry[:0], data[end:]...)
+
+		if end > 0 {
+			select {
+			case blocks <- streamBlock{buffer: buffer, data: data[:end], start: offset}:
+				sent++
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			}
+			offset += int64(end)
+		} else {
+			free <- buffer
+		}
+
+		if atEOF {
+			return sent, nil
+		}
+	}
+}
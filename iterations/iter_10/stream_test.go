@@ -0,0 +1,152 @@
+package iter10
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestExecuteStream_MatchesFile(t *testing.T) {
+	inputPath := writeTestInput(t, 10_000)
+	dir := t.TempDir()
+
+	filePath := filepath.Join(dir, "file.txt")
+	if _, err := ExecuteWithOptions(context.Background(), inputPath, filePath, Options{Workers: 4, SectionSize: 4096}); err != nil {
+		t.Fatalf("file run failed: %v", err)
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// small blocks so most of them end in the middle of a record, and a reader
+	// returning short reads like a pipe does
+	streamPath := filepath.Join(dir, "stream.txt")
+	balance, err := ExecuteStream(context.Background(), iotest.HalfReader(bytes.NewReader(data)), streamPath, Options{Workers: 4, SectionSize: 1000})
+	if err != nil {
+		t.Fatalf("stream run failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(streamPath)
+	want, _ := os.ReadFile(filePath)
+	if len(got) == 0 || !bytes.Equal(got, want) {
+		t.Errorf("streamed output differs from the file run:\n%s\n%s", got, want)
+	}
+
+	var bytesProcessed int64
+	var sections int
+	for _, w := range balance.Workers {
+		bytesProcessed += w.Bytes
+		sections += w.Sections
+	}
+	if bytesProcessed != int64(len(data)) || sections != balance.Sections {
+		t.Errorf("workers processed %d bytes in %d blocks, want %d bytes in %d blocks", bytesProcessed, sections, len(data), balance.Sections)
+	}
+}
+
+func TestExecuteStream_ReportsProgress(t *testing.T) {
+	data, err := os.ReadFile(writeTestInput(t, 10_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := &countingProgress{}
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+	if _, err := ExecuteStream(context.Background(), bytes.NewReader(data), outputPath, Options{Workers: 2, SectionSize: 1000, Progress: progress}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the size of a stream is not known up front
+	if progress.total.Load() != -1 || progress.bytes.Load() != int64(len(data)) || progress.rows.Load() != 10_000 {
+		t.Errorf("got %d bytes and %d rows of %d, want %d bytes and 10000 rows of -1",
+			progress.bytes.Load(), progress.rows.Load(), progress.total.Load(), len(data))
+	}
+}
+
+func TestExecuteStream_EmptyInput(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+	if _, err := ExecuteStream(context.Background(), strings.NewReader(""), outputPath, Options{Workers: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(outputPath); string(got) != "{}\n" {
+		t.Errorf("got %q, want %q", got, "{}\n")
+	}
+}
+
+func TestExecuteStream_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		blockSize int64
+		offset    int64
+		line      string
+	}{
+		{"malformed record", "Hamburg;12.3\nRome9.9\nOslo;-5.5\n", 1024, 13, "Rome9.9"},
+		{"malformed record in a later block", strings.Repeat("Oslo;-5.5\n", 20) + "Rome9.9\n", 32, 200, "Rome9.9"},
+		{"unterminated last record", "Hamburg;12.3\nOslo;-5.5", 1024, 13, "Oslo;-5.5"},
+		{"record longer than a block", "Hamburg;12.3\nLlanfairpwllgwyngyll;1.0\n", 16, 13, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "results.txt")
+
+			_, err := ExecuteStream(context.Background(), strings.NewReader(tt.input), outputPath, Options{Workers: 2, SectionSize: tt.blockSize})
+
+			var recordErr *RecordError
+			if !errors.As(err, &recordErr) {
+				t.Fatalf("expected *RecordError, got %v", err)
+			}
+			if recordErr.Offset != tt.offset || recordErr.Line != tt.line {
+				t.Errorf("got record %q at %d, want %q at %d", recordErr.Line, recordErr.Offset, tt.line, tt.offset)
+			}
+			if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected no output file on failure, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteStream_CancelledWhileReading(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// some records arrive, then the writer stalls without closing the pipe
+	if _, err := writer.Write([]byte(strings.Repeat("Hamburg;12.3\n", 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	outputPath := filepath.Join(t.TempDir(), "results.txt")
+	done := make(chan error, 1)
+	go func() {
+		_, err := ExecuteStream(ctx, reader, outputPath, Options{Workers: 2, SectionSize: 1024})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled itself, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream did not return after cancelling")
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no output file after cancelling, got %v", err)
+	}
+}
@@ -1,22 +1,94 @@
 package main
 
 import (
-	"1brc-go/iterations/base"
+	"1brc-go/decompress"
+	_ "1brc-go/iterations/base"
+	_ "1brc-go/iterations/iter_01"
+	_ "1brc-go/iterations/iter_02"
+	_ "1brc-go/iterations/iter_03"
+	_ "1brc-go/iterations/iter_04"
+	_ "1brc-go/iterations/iter_05"
+	_ "1brc-go/iterations/iter_06"
+	_ "1brc-go/iterations/iter_07"
+	_ "1brc-go/iterations/iter_08"
+	_ "1brc-go/iterations/iter_09"
+	_ "1brc-go/iterations/iter_10"
+	"1brc-go/solver"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
-	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
-var input = flag.String("f", "small", "dataset: small, full")
+var input = flag.String("f", "small", "dataset: small, mid, full")
 var profile = flag.Bool("p", false, "save cpu and memory profiles")
+var profileList = flag.String("profiles", "", "profiles to save, comma separated: cpu, heap, allocs, block, mutex, trace or all, implies -p")
+var impl = flag.String("impl", "base", "registered solver to run")
+var workers = flag.Int("workers", 0, "number of workers, 0 uses the solver default")
+var inPath = flag.String("in", "", "input path or glob, '-' reads stdin (overrides -f), more inputs can follow the flags")
+var outPath = flag.String("out", "", "output path, '-' writes stdout (overrides -f)")
+var repeat = flag.Int("repeat", 1, "number of runs, more than one prints per-run and aggregate timings")
+var onError = flag.String("on-error", "fail", "malformed records: fail, skip or quarantine")
+var quarantinePath = flag.String("quarantine", "", "file receiving the rejected records with their offsets in quarantine mode")
+var format = flag.String("format", "canonical", "output format: canonical, json, csv or ndjson")
+var stats = flag.String("stats", "", "optional per-station statistics, comma separated: stddev, percentiles, needs -format json, csv or ndjson")
+var perFile = flag.Bool("per-file", false, "with several inputs, also write the results of every input next to the combined output")
+var showProgress = flag.Bool("progress", false, "show percent done, throughput and ETA on stderr while running")
+var knobs = flag.String("knobs", "", "solver specific knobs, comma separated, e.g. section=4194304 for iter_10")
+var fieldSeparator = flag.String("field-sep", ";", "separator between the station and the temperature, one byte or an escape like \\t")
+var recordSeparator = flag.String("record-sep", "\\n", "separator ending every record, one byte or an escape")
+var decimals = flag.Int("decimals", 1, "decimal places of the temperatures")
+var fewerDecimals = flag.Bool("fewer-decimals", false, "also accept temperatures with fewer decimal places")
+var crlf = flag.Bool("crlf", false, "records may end in \\r\\n")
+var header = flag.Bool("header", false, "skip the first line of every input as a header")
+var bufferSize byteSize
+
+func init() {
+	flag.Var(&bufferSize, "buffer", "read buffer size, e.g. 4MiB or 512KiB, 0 uses the solver default")
+}
+
+// report receives the timing lines, it is switched to stderr when the results go to stdout
+var report io.Writer = os.Stdout
+
+// subcommands, running without one executes the solver
+var commands = map[string]func(args []string) error{
+	"bench":     runBench,
+	"compare":   runCompare,
+	"generate":  runGenerate,
+	"profdiff":  runProfileDiff,
+	"verify":    runVerify,
+	"reference": runReference,
+	"sweep":     runSweep,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
-	inputPath, outputPath := resolveFileSize(*input)
-	Runner(inputPath, outputPath)
+
+	if err := Runner(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 func resolveFileSize(name string) (string, string) {
@@ -30,15 +102,22 @@ func resolveFileSize(name string) (string, string) {
 	}
 }
 
-// wrapper to run a function and add add time measurement and profiling
-func Measure(name string, enableProfile bool, fn func()) {
+// Measurement is the wall time and the memory allocated by a measured run
+type Measurement struct {
+	Elapsed time.Duration
+	AllocMB float64
+}
+
+// Measure runs fn and reports its wall time and allocations, capturing the
+// selected profiles into profileDir. Only the profiles can fail, fn has run
+// when the error is about writing them.
+func Measure(name string, profiles Profiles, fn func()) (Measurement, error) {
 	now := time.Now()
 	timestamp := now.Format("20060102_150405")
 
-	var cpuFile *os.File
-	if enableProfile {
-		cpuFile, _ = os.Create(fmt.Sprintf("profiles/cpu_%s_%s.prof", name, timestamp))
-		pprof.StartCPUProfile(cpuFile)
+	capture, err := startProfiles(profiles, name, timestamp)
+	if err != nil {
+		return Measurement{}, err
 	}
 
 	runtime.GC()
@@ -50,20 +129,357 @@ func Measure(name string, enableProfile bool, fn func()) {
 
 	elapsed := time.Since(start)
 
-	if enableProfile {
-		pprof.StopCPUProfile()
-		cpuFile.Close()
-		memFile, _ := os.Create(fmt.Sprintf("profiles/mem_%s_%s.prof", name, timestamp))
-		pprof.WriteHeapProfile(memFile)
-		memFile.Close()
-	}
+	err = capture.stop()
 
 	runtime.ReadMemStats(&mEnd)
 	allocMB := float64(mEnd.TotalAlloc-mStart.TotalAlloc) / 1024 / 1024
 
-	fmt.Printf("➜ [%-15s] Time: %-12s | Mem: %7.2f MB | Profiled: %v\n", name, elapsed, allocMB, enableProfile)
+	profiled := "false"
+	if profiles != 0 {
+		profiled = profiles.String()
+	}
+	fmt.Fprintf(report, "➜ [%-15s] Time: %-12s | Mem: %7.2f MB | Profiled: %s\n", name, elapsed, allocMB, profiled)
+
+	return Measurement{Elapsed: elapsed, AllocMB: allocMB}, err
+}
+
+// Runner executes the solver selected by the flags, measuring the runs when
+// repeated or profiled
+func Runner(ctx context.Context) error {
+	opts := solver.Options{
+		BufferSize:     int(bufferSize),
+		Workers:        *workers,
+		OnError:        *onError,
+		QuarantinePath: *quarantinePath,
+		Format:         *format,
+		Stats:          *stats,
+		PerFile:        *perFile,
+		Knobs:          *knobs,
+	}
+
+	records, err := recordFormat()
+	if err != nil {
+		return err
+	}
+	opts.Records = records
+
+	profiles, err := selectedProfiles()
+	if err != nil {
+		return err
+	}
+	opts.Knobs = withStageLabels(*impl, opts.Knobs, profiles)
+
+	// left nil unless asked for, the solvers skip reporting altogether then
+	var progress *progressRenderer
+	if *showProgress {
+		progress = newProgressRenderer(os.Stderr)
+		opts.Progress = progress
+	}
+
+	s, err := solver.New(*impl, opts)
+	if err != nil {
+		return err
+	}
+
+	// an interrupt cancels the run of a solver that stops on it and writes no
+	// output, the others keep the default of exiting right away
+	if s.Supports(solver.Cancellation) {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	inputPath, outputPath := resolveFileSize(*input)
+	if *inPath != "" {
+		inputPath = *inPath
+	}
+	if *outPath != "" {
+		outputPath = *outPath
+	}
+
+	// inputs after the flags replace the -f dataset, they are added to -in
+	inputs := flag.Args()
+	if *inPath != "" || len(inputs) == 0 {
+		inputs = append([]string{inputPath}, inputs...)
+	}
+	inputPaths, err := expandGlobs(inputs)
+	if err != nil {
+		return err
+	}
+
+	multiple := len(inputPaths) > 1 || *perFile
+	if multiple {
+		if !s.Supports(solver.MultipleInputs) {
+			return fmt.Errorf("solver %q does not support %s", s.Name(), solver.MultipleInputs)
+		}
+		if slices.Contains(inputPaths, "-") {
+			return errors.New("stdin cannot be combined with other inputs")
+		}
+		if outputPath == "-" && *perFile {
+			return errors.New("per-file results need an output path")
+		}
+	}
+	inputPath = inputPaths[0]
+
+	// streaming solvers read stdin directly when it is read once, the others
+	// need a file they can read at arbitrary offsets, so stdin is spooled first
+	streamStdin := inputPath == "-" && s.Supports(solver.Streaming) && *repeat <= 1
+	switch {
+	case multiple:
+		// every input is read by the solver itself
+	case inputPath == "-" && !streamStdin:
+		inputPath, err = spoolToTempFile(os.Stdin)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(inputPath)
+	case inputPath != "-" && !s.Supports(solver.CompressedInput):
+		// compressed files are decompressed once for solvers that only read plain text
+		decodedPath, err := decompressToTempFile(inputPath)
+		if err != nil {
+			return err
+		}
+		if decodedPath != "" {
+			inputPath = decodedPath
+			defer os.Remove(inputPath)
+		}
+	}
+
+	toStdout := outputPath == "-"
+	if toStdout {
+		report = os.Stderr
+		tempFile, err := os.CreateTemp("", "1brc-out-*.txt")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary output: %w", err)
+		}
+		tempFile.Close()
+		outputPath = tempFile.Name()
+		defer os.Remove(outputPath)
+	} else if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	run := func() error {
+		if multiple {
+			return s.RunFiles(ctx, inputPaths, outputPath)
+		}
+		if streamStdin {
+			return s.Stream(ctx, os.Stdin, outputPath)
+		}
+		return s.Run(ctx, inputPath, outputPath)
+	}
+
+	if *repeat <= 1 && profiles == 0 {
+		err = run()
+	} else {
+		err = measureRepeated(s, max(*repeat, 1), profiles, run)
+	}
+	if err != nil {
+		return err
+	}
+
+	if toStdout {
+		return copyFileTo(os.Stdout, outputPath)
+	}
+	return nil
+}
+
+// measureRepeated runs fn count times through Measure and prints the aggregate timings
+func measureRepeated(s solver.Solver, count int, profiles Profiles, fn func() error) error {
+	label := measureLabel(s)
+
+	times := make([]time.Duration, 0, count)
+	for range count {
+		var err error
+		measurement, profileErr := Measure(label, profiles, func() {
+			err = fn()
+		})
+		if err != nil {
+			return err
+		}
+		if profileErr != nil {
+			return profileErr
+		}
+		times = append(times, measurement.Elapsed)
+	}
+
+	if count > 1 {
+		var total time.Duration
+		for _, t := range times {
+			total += t
+		}
+		fmt.Fprintf(report, "➜ [%-15s] Runs: %d | Avg: %-12s | Min: %-12s | Max: %-12s\n",
+			label, count, total/time.Duration(count), slices.Min(times), slices.Max(times))
+	}
+
+	return nil
+}
+
+// measureLabel names the measurements of s, e.g. iter_07_p50 with 50 workers
+func measureLabel(s solver.Solver) string {
+	if s.Options().Workers > 1 {
+		return fmt.Sprintf("%s_p%d", s.Name(), s.Options().Workers)
+	}
+	return s.Name()
+}
+
+// recordFormat is the layout of the input given by the flags
+func recordFormat() (solver.RecordFormat, error) {
+	field, err := parseSeparator(*fieldSeparator)
+	if err != nil {
+		return solver.RecordFormat{}, fmt.Errorf("invalid -field-sep: %w", err)
+	}
+	record, err := parseSeparator(*recordSeparator)
+	if err != nil {
+		return solver.RecordFormat{}, fmt.Errorf("invalid -record-sep: %w", err)
+	}
+	if *decimals < 1 {
+		return solver.RecordFormat{}, fmt.Errorf("invalid -decimals: %d", *decimals)
+	}
+
+	return solver.RecordFormat{
+		FieldSeparator:  field,
+		RecordSeparator: record,
+		Decimals:        *decimals,
+		FewerDecimals:   *fewerDecimals,
+		CRLF:            *crlf,
+		Header:          *header,
+	}, nil
+}
+
+// parseSeparator accepts a single byte or a Go escape of one, e.g. \t or \x1f
+func parseSeparator(value string) (byte, error) {
+	unquoted, err := strconv.Unquote(`"` + value + `"`)
+	if err != nil || len(unquoted) != 1 {
+		return 0, fmt.Errorf("%q is not a single byte", value)
+	}
+	return unquoted[0], nil
+}
+
+// expandGlobs replaces the patterns among paths by the files they match in
+// lexical order, a pattern matching nothing is an error
+func expandGlobs(paths []string) ([]string, error) {
+	var expanded []string
+	for _, path := range paths {
+		if !strings.ContainsAny(path, "*?[") {
+			expanded = append(expanded, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input matches %q", path)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// spoolToTempFile copies reader to a temporary file, gzip and bzip2 input is
+// decompressed on the way
+func spoolToTempFile(reader io.Reader) (string, error) {
+	decoded, _, err := decompress.NewReader(reader)
+	if err != nil {
+		return "", err
+	}
+
+	tempFile, err := os.CreateTemp("", "1brc-in-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary input: %w", err)
+	}
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, decoded); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to spool input: %w", err)
+	}
+
+	return tempFile.Name(), nil
+}
+
+// decompressToTempFile spools the decompressed input to a temporary file, it
+// returns an empty path when the input is not compressed
+func decompressToTempFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open input: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, decompress.HeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	if decompress.Detect(header[:n]) == decompress.None {
+		return "", nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return spoolToTempFile(file)
+}
+
+func copyFileTo(writer io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open results: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(writer, file); err != nil {
+		return fmt.Errorf("failed to copy results: %w", err)
+	}
+	return nil
+}
+
+// byteSize is a flag value accepting plain byte counts or sizes like 512K, 4MiB or 1GB,
+// K, M, G and the IEC units are powers of 1024, KB, MB and GB powers of 1000
+type byteSize int
+
+func (b *byteSize) String() string {
+	return strconv.Itoa(int(*b))
+}
+
+func (b *byteSize) Set(value string) error {
+	size, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(size)
+	return nil
 }
 
-func Runner(inputPath string, outputPath string) {
-	base.Execute(inputPath, outputPath, 4*1024*1024)
+func parseByteSize(value string) (int, error) {
+	units := []struct {
+		suffix     string
+		multiplier int
+	}{
+		// KB, MB and GB are decimal, the short forms are binary like the IEC ones
+		{"GiB", 1024 * 1024 * 1024}, {"GB", 1000 * 1000 * 1000}, {"G", 1024 * 1024 * 1024},
+		{"MiB", 1024 * 1024}, {"MB", 1000 * 1000}, {"M", 1024 * 1024},
+		{"KiB", 1024}, {"KB", 1000}, {"K", 1024},
+		{"B", 1},
+	}
+
+	number, multiplier := strings.TrimSpace(value), 1
+	for _, unit := range units {
+		if trimmed, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = trimmed, unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", value)
+	}
+	if n > math.MaxInt/multiplier {
+		return 0, fmt.Errorf("invalid size: %q is too large", value)
+	}
+	return n * multiplier, nil
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"1brc-go/solver"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "4096", want: 4096},
+		{input: "512K", want: 512 * 1024},
+		{input: "512KiB", want: 512 * 1024},
+		{input: "4MB", want: 4_000_000},
+		{input: "2GB", want: 2_000_000_000},
+		{input: "10KB", want: 10_000},
+		{input: "4MiB", want: 4 * 1024 * 1024},
+		{input: "1G", want: 1024 * 1024 * 1024},
+		{input: "16 MiB", want: 16 * 1024 * 1024},
+		{input: "100B", want: 100},
+		{input: "", wantErr: true},
+		{input: "MiB", wantErr: true},
+		{input: "-1K", wantErr: true},
+		{input: "4TiB", wantErr: true},
+		{input: "99999999999G", wantErr: true},
+		{input: "9223372036854775807K", wantErr: true},
+		{input: "9223372036854775807", want: math.MaxInt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseByteSize(tt.input)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseByteSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandGlobs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"day-2.txt", "day-1.txt", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := expandGlobs([]string{filepath.Join(dir, "day-*.txt"), "plain.txt", "-"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "day-1.txt"), filepath.Join(dir, "day-2.txt"), "plain.txt", "-"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := expandGlobs([]string{filepath.Join(dir, "missing-*.txt")}); err == nil {
+		t.Errorf("expected error for a pattern matching nothing, got nil")
+	}
+}
+
+func TestCancellableSolvers(t *testing.T) {
+	// the CLI only catches SIGINT and SIGTERM for these, the others exit on them
+	for name, want := range map[string]bool{"base": false, "iter_06": false, "iter_07": true, "iter_10": true} {
+		s, err := solver.New(name, solver.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Supports(solver.Cancellation); got != want {
+			t.Errorf("%s supports cancellation: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestParseSeparator(t *testing.T) {
+	for value, want := range map[string]byte{";": ';', ",": ',', `\t`: '\t', `\n`: '\n', `\x1e`: 0x1e} {
+		if got, err := parseSeparator(value); err != nil || got != want {
+			t.Errorf("parseSeparator(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", ";;", `\`, "é"} {
+		if _, err := parseSeparator(value); err == nil {
+			t.Errorf("parseSeparator(%q): expected an error", value)
+		}
+	}
+}
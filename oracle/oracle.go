@@ -0,0 +1,242 @@
+// Package oracle computes the expected 1BRC output the slow way.
+//
+// Every temperature is parsed into an exact rational number, sums are never
+// rounded and the only rounding happens once per value when the result is
+// formatted, so the output can be trusted as the reference for the solvers.
+package oracle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Result holds the formatted min/avg/max of a station with one decimal each
+type Result struct {
+	Station string
+	Min     string
+	Avg     string
+	Max     string
+}
+
+func (r Result) Values() string {
+	return r.Min + "/" + r.Avg + "/" + r.Max
+}
+
+type stationStats struct {
+	min   *big.Rat
+	max   *big.Rat
+	sum   *big.Rat
+	count *big.Int
+}
+
+// Compute reads `station;temp` lines and returns the per-station results sorted by station name.
+func Compute(reader io.Reader) ([]Result, error) {
+	stats := make(map[string]*stationStats)
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		// station names may contain ';' in theory, the temperature never does
+		separatorIdx := strings.LastIndexByte(line, ';')
+		if separatorIdx == -1 {
+			return nil, fmt.Errorf("line %d: separator ';' not found: %s", lineNum, line)
+		}
+		station := line[:separatorIdx]
+
+		temp, ok := parseTemperature(line[separatorIdx+1:])
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid temperature: %s", lineNum, line)
+		}
+
+		s, ok := stats[station]
+		if !ok {
+			stats[station] = &stationStats{
+				min:   new(big.Rat).Set(temp),
+				max:   new(big.Rat).Set(temp),
+				sum:   new(big.Rat).Set(temp),
+				count: big.NewInt(1),
+			}
+			continue
+		}
+
+		if temp.Cmp(s.min) < 0 {
+			s.min.Set(temp)
+		}
+		if temp.Cmp(s.max) > 0 {
+			s.max.Set(temp)
+		}
+		s.sum.Add(s.sum, temp)
+		s.count.Add(s.count, big.NewInt(1))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	stations := make([]string, 0, len(stats))
+	for station := range stats {
+		stations = append(stations, station)
+	}
+	slices.Sort(stations)
+
+	results := make([]Result, 0, len(stations))
+	for _, station := range stations {
+		s := stats[station]
+		avg := new(big.Rat).Quo(s.sum, new(big.Rat).SetInt(s.count))
+
+		results = append(results, Result{
+			Station: station,
+			Min:     FormatTenths(s.min),
+			Avg:     FormatTenths(avg),
+			Max:     FormatTenths(s.max),
+		})
+	}
+
+	return results, nil
+}
+
+// parseTemperature parses the 1BRC temperature grammar, an optional '-', one
+// or two digits, '.' and one digit, into an exact rational. big.Rat.SetString
+// would also take 1/2, 1e5 or 0x1p-2, which every solver rejects.
+func parseTemperature(s string) (*big.Rat, bool) {
+	digits, negative := strings.CutPrefix(s, "-")
+	if len(digits) < 3 || len(digits) > 4 || digits[len(digits)-2] != '.' {
+		return nil, false
+	}
+
+	tenths := int64(0)
+	for i := range len(digits) {
+		if i == len(digits)-2 {
+			continue
+		}
+		if digits[i] < '0' || digits[i] > '9' {
+			return nil, false
+		}
+		tenths = tenths*10 + int64(digits[i]-'0')
+	}
+	if negative {
+		tenths = -tenths
+	}
+	return big.NewRat(tenths, 10), true
+}
+
+// FormatTenths rounds x to one decimal, ties are rounded towards positive
+// infinity (floor(10x + 0.5) / 10), the same rule as RoundToOneDecimal in the solvers.
+func FormatTenths(x *big.Rat) string {
+	scaled := new(big.Rat).Mul(x, big.NewRat(10, 1))
+	scaled.Add(scaled, big.NewRat(1, 2))
+
+	// big.Int.Div is Euclidean division, which floors for a positive divisor
+	tenths := new(big.Int).Div(scaled.Num(), scaled.Denom())
+
+	sign := ""
+	if tenths.Sign() < 0 {
+		sign = "-"
+		tenths.Neg(tenths)
+	}
+	whole, frac := new(big.Int).QuoRem(tenths, big.NewInt(10), new(big.Int))
+
+	return fmt.Sprintf("%s%s.%s", sign, whole, frac)
+}
+
+// FormatCanonical returns the `{A=1.0/2.0/3.0, B=...}` line of the 1BRC challenge.
+func FormatCanonical(results []Result) string {
+	var sb strings.Builder
+
+	sb.WriteString("{")
+	for i, r := range results {
+		sb.WriteString(r.Station)
+		sb.WriteString("=")
+		sb.WriteString(r.Values())
+
+		if i+1 < len(results) {
+			sb.WriteString(", ")
+		}
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// ParseCanonical parses the output of FormatCanonical. Station names may contain
+// ", " (e.g. "Washington, D.C."), so entries are split after the values instead.
+func ParseCanonical(output string) ([]Result, error) {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "{") || !strings.HasSuffix(output, "}") {
+		return nil, fmt.Errorf("output is not wrapped in braces")
+	}
+	rest := output[1 : len(output)-1]
+
+	var results []Result
+	for rest != "" {
+		eqIdx := strings.IndexByte(rest, '=')
+		if eqIdx == -1 {
+			return nil, fmt.Errorf("missing '=' in entry: %s", rest)
+		}
+		station := rest[:eqIdx]
+		rest = rest[eqIdx+1:]
+
+		values := rest
+		if endIdx := strings.Index(rest, ", "); endIdx != -1 {
+			values = rest[:endIdx]
+			rest = rest[endIdx+2:]
+		} else {
+			rest = ""
+		}
+
+		parts := strings.Split(values, "/")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("expected min/avg/max for station %q, got: %s", station, values)
+		}
+
+		results = append(results, Result{Station: station, Min: parts[0], Avg: parts[1], Max: parts[2]})
+	}
+
+	return results, nil
+}
+
+// Mismatch describes the first station where two result sets differ.
+// Expected or Actual is empty when the station is missing from that side.
+type Mismatch struct {
+	Station  string
+	Expected string
+	Actual   string
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("station %q: expected %s, got %s", m.Station, orMissing(m.Expected), orMissing(m.Actual))
+}
+
+func orMissing(values string) string {
+	if values == "" {
+		return "<missing>"
+	}
+	return values
+}
+
+// Compare walks both sorted result sets and returns the first mismatch, or nil if they are equal.
+func Compare(expected []Result, actual []Result) *Mismatch {
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case j == len(actual) || (i < len(expected) && expected[i].Station < actual[j].Station):
+			return &Mismatch{Station: expected[i].Station, Expected: expected[i].Values()}
+		case i == len(expected) || actual[j].Station < expected[i].Station:
+			return &Mismatch{Station: actual[j].Station, Actual: actual[j].Values()}
+		}
+
+		if expected[i] != actual[j] {
+			return &Mismatch{Station: expected[i].Station, Expected: expected[i].Values(), Actual: actual[j].Values()}
+		}
+		i++
+		j++
+	}
+
+	return nil
+}
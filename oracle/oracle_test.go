@@ -0,0 +1,189 @@
+package oracle
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	input := "Hamburg;12.0\nOslo;-5.5\nHamburg;-3.4\nWashington, D.C.;14.6\nHamburg;8.9\n"
+
+	got, err := Compute(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Result{
+		{Station: "Hamburg", Min: "-3.4", Avg: "5.8", Max: "12.0"},
+		{Station: "Oslo", Min: "-5.5", Avg: "-5.5", Max: "-5.5"},
+		{Station: "Washington, D.C.", Min: "14.6", Avg: "14.6", Max: "14.6"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompute_InvalidLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing separator", "Hamburg12.0\n"},
+		{"invalid temperature", "Hamburg;warm\n"},
+		// big.Rat.SetString accepts these, the 1BRC grammar does not
+		{"fraction", "Hamburg;1/2\n"},
+		{"exponent", "Hamburg;1e5\n"},
+		{"hexadecimal float", "Hamburg;0x1p-2\n"},
+		{"no decimal", "Hamburg;12\n"},
+		{"two decimals", "Hamburg;12.00\n"},
+		{"three digits", "Hamburg;100.0\n"},
+		{"plus sign", "Hamburg;+1.0\n"},
+		{"missing digit", "Hamburg;-.5\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compute(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	for input, want := range map[string]*big.Rat{
+		"0.0":   big.NewRat(0, 1),
+		"-0.1":  big.NewRat(-1, 10),
+		"9.9":   big.NewRat(99, 10),
+		"-99.9": big.NewRat(-999, 10),
+		"12.3":  big.NewRat(123, 10),
+	} {
+		got, ok := parseTemperature(input)
+		if !ok || got.Cmp(want) != 0 {
+			t.Errorf("parseTemperature(%q) = %v, %v, want %v", input, got, ok, want)
+		}
+	}
+}
+
+func TestFormatTenths(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *big.Rat
+		want  string
+	}{
+		{"exact value", big.NewRat(123, 10), "12.3"},
+		{"positive non-tie up", big.NewRat(298, 100), "3.0"},
+		{"positive non-tie down", big.NewRat(233, 100), "2.3"},
+		{"negative non-tie up", big.NewRat(-133, 100), "-1.3"},
+		{"negative non-tie down", big.NewRat(-477, 100), "-4.8"},
+		{"positive tie", big.NewRat(165, 100), "1.7"},
+		{"negative tie", big.NewRat(-335, 100), "-3.3"},
+		{"negative tie towards zero", big.NewRat(-5, 100), "0.0"},
+		{"small negative", big.NewRat(-6, 100), "-0.1"},
+		{"repeating fraction", big.NewRat(58, 30), "1.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatTenths(tt.input); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatAndParseCanonical(t *testing.T) {
+	results := []Result{
+		{Station: "Flores,  Petén", Min: "-1.0", Avg: "2.0", Max: "3.0"},
+		{Station: "Washington, D.C.", Min: "4.0", Avg: "5.0", Max: "6.0"},
+	}
+
+	formatted := FormatCanonical(results)
+	if formatted != "{Flores,  Petén=-1.0/2.0/3.0, Washington, D.C.=4.0/5.0/6.0}\n" {
+		t.Errorf("unexpected canonical output: %q", formatted)
+	}
+
+	parsed, err := ParseCanonical(formatted)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed) != len(results) {
+		t.Fatalf("got %d results, want %d", len(parsed), len(results))
+	}
+	for i := range results {
+		if parsed[i] != results[i] {
+			t.Errorf("result %d: got %+v, want %+v", i, parsed[i], results[i])
+		}
+	}
+}
+
+func TestParseCanonical_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing braces", "A=1.0/2.0/3.0"},
+		{"missing values", "{A=1.0/2.0}"},
+		{"missing equals sign", "{A}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCanonical(tt.input); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := []Result{
+		{Station: "A", Min: "1.0", Avg: "2.0", Max: "3.0"},
+		{Station: "B", Min: "1.0", Avg: "2.0", Max: "3.0"},
+	}
+
+	tests := []struct {
+		name   string
+		actual []Result
+		want   *Mismatch
+	}{
+		{
+			name:   "equal",
+			actual: expected,
+			want:   nil,
+		},
+		{
+			name:   "different values",
+			actual: []Result{expected[0], {Station: "B", Min: "1.0", Avg: "2.1", Max: "3.0"}},
+			want:   &Mismatch{Station: "B", Expected: "1.0/2.0/3.0", Actual: "1.0/2.1/3.0"},
+		},
+		{
+			name:   "missing station",
+			actual: []Result{expected[1]},
+			want:   &Mismatch{Station: "A", Expected: "1.0/2.0/3.0"},
+		},
+		{
+			name:   "unexpected station",
+			actual: []Result{expected[0], {Station: "AB", Min: "0.0", Avg: "0.0", Max: "0.0"}, expected[1]},
+			want:   &Mismatch{Station: "AB", Actual: "0.0/0.0/0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(expected, tt.actual)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if got != nil && *got != *tt.want {
+				t.Errorf("got %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
@@ -1,109 +1,109 @@
 package main
 
 import (
-	"1brc-go/iterations/base"
-	iter01 "1brc-go/iterations/iter_01"
-	iter02 "1brc-go/iterations/iter_02"
-	iter03 "1brc-go/iterations/iter_03"
-	iter04 "1brc-go/iterations/iter_04"
-	iter05 "1brc-go/iterations/iter_05"
-	iter06 "1brc-go/iterations/iter_06"
-	iter07 "1brc-go/iterations/iter_07"
+	"1brc-go/solver"
+	"context"
+	"os"
 	"testing"
 )
 
-func TestBaseVersion(t *testing.T) {
-	// Measure("sequential_idiomatic", *profile, func() {
-	// 	BaseExecute(resolveInput(*input), 4*1024*1024)
-	// })
-	Measure("sequential_idiomatic", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		base.Execute(inputPath, outputPath, 8*1024*1024)
+// measureSolver runs the registered solver on the selected dataset under
+// label, the name its runs were always measured as, zero options fall back to
+// the solver's registered defaults
+func measureSolver(t *testing.T, label string, name string, opts solver.Options) {
+	t.Helper()
+
+	profiles, err := selectedProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Knobs = withStageLabels(name, opts.Knobs, profiles)
+
+	s, err := solver.New(name, opts)
+	if err != nil {
+		t.Fatalf("failed to create solver: %v", err)
+	}
+
+	inputPath, outputPath := resolveFileSize(*input)
+	if _, err := os.Stat(inputPath); err != nil {
+		t.Skipf("input not available, run 'task generate INPUT=%s' first: %v", *input, err)
+	}
+
+	_, err = Measure(label, profiles, func() {
+		if err := s.Run(context.Background(), inputPath, outputPath); err != nil {
+			t.Errorf("%s failed: %v", name, err)
+		}
 	})
-	// Measure("sequential_idiomatic", *profile, func() {
-	// 	BaseExecute(resolveInput(*input), 12*1024*1024)
-	// })
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkSolvers(b *testing.B) {
+	inputPath, outputPath := resolveFileSize(*input)
+	if _, err := os.Stat(inputPath); err != nil {
+		b.Skipf("input not available: %v", err)
+	}
+
+	for _, name := range solver.Names() {
+		b.Run(name, func(b *testing.B) {
+			s, err := solver.New(name, solver.Options{})
+			if err != nil {
+				b.Fatalf("failed to create solver: %v", err)
+			}
+			for b.Loop() {
+				if err := s.Run(context.Background(), inputPath, outputPath); err != nil {
+					b.Fatalf("%s failed: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBaseVersion(t *testing.T) {
+	measureSolver(t, "sequential_idiomatic", "base", solver.Options{BufferSize: 8 * 1024 * 1024})
 }
 
 func TestIter01(t *testing.T) {
-	Measure("iter_01", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter01.Execute(inputPath, outputPath, 8*1024*1024)
-	})
+	measureSolver(t, "iter_01", "iter_01", solver.Options{BufferSize: 8 * 1024 * 1024})
 }
 
 func TestIter02(t *testing.T) {
-	Measure("iter_02_gen", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter02.Execute(inputPath, outputPath, 8*1024*1024)
-	})
+	measureSolver(t, "iter_02_gen", "iter_02", solver.Options{BufferSize: 8 * 1024 * 1024})
 }
 
+// the settings below are the best of earlier sweeps, other combinations are
+// compared with e.g. go run . sweep -impl iter_03 -workers 30:60:10 -buffer 10MiB
+
 func TestIter03(t *testing.T) {
-	// Measure("iter_03_p30", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter03.Execute(inputPath, outputPath, 10*1024*1024, 30)
-	// })
-	// Measure("iter_03_p40", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter03.Execute(inputPath, outputPath, 10*1024*1024, 40)
-	// })
-	Measure("iter_03_p50", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter03.Execute(inputPath, outputPath, 10*1024*1024, 50)
-	})
-	// Measure("iter_03_p60", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter03.Execute(inputPath, outputPath, 10*1024*1024, 60)
-	// })
+	measureSolver(t, "iter_03_p50", "iter_03", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
 }
 
 func TestIter04(t *testing.T) {
-	Measure("iter_04_p50_recgen", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter04.Execute(inputPath, outputPath, 16*1024*1024, 50)
-	})
-	// Measure("iter_04_p90", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter04.Execute(inputPath, outputPath, 10*1024*1024, 90)
-	// })
-	// Measure("iter_04_p65", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter04.Execute(inputPath, outputPath, 10*1024*1024, 65)
-	// })
+	measureSolver(t, "iter_04_p50_recgen", "iter_04", solver.Options{BufferSize: 16 * 1024 * 1024, Workers: 50})
 }
 
 func TestIter05(t *testing.T) {
-	Measure("iter_05_p50", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter05.Execute(inputPath, outputPath, 10*1024*1024, 50)
-	})
+	measureSolver(t, "iter_05_p50", "iter_05", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
 }
 func TestIter06(t *testing.T) {
-	Measure("iter_06_p50", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter06.Execute(inputPath, outputPath, 10*1024*1024, 50)
-	})
-	Measure("iter_06_p30", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter06.Execute(inputPath, outputPath, 10*1024*1024, 30)
-	})
-	Measure("iter_06_p15", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter06.Execute(inputPath, outputPath, 10*1024*1024, 15)
-	})
+	measureSolver(t, "iter_06_p50", "iter_06", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
+	measureSolver(t, "iter_06_p30", "iter_06", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 30})
+	measureSolver(t, "iter_06_p15", "iter_06", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 15})
 }
 func TestIter07(t *testing.T) {
-	Measure("iter_07_p50", *profile, func() {
-		inputPath, outputPath := resolveFileSize(*input)
-		iter07.Execute(inputPath, outputPath, 10*1024*1024, 50)
-	})
-	// Measure("iter_07_p20", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter07.Execute(inputPath, outputPath, 10*1024*1024, 20)
-	// })
-	// Measure("iter_07_p15", *profile, func() {
-	// 	inputPath, outputPath := resolveFileSize(*input)
-	// 	iter07.Execute(inputPath, outputPath, 10*1024*1024, 15)
-	// })
+	measureSolver(t, "iter_07_p50", "iter_07", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
+}
+
+func TestIter08(t *testing.T) {
+	measureSolver(t, "iter_08_p50", "iter_08", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
+}
+
+func TestIter09(t *testing.T) {
+	measureSolver(t, "iter_09_p50", "iter_09", solver.Options{BufferSize: 10 * 1024 * 1024, Workers: 50})
+}
+
+func TestIter10(t *testing.T) {
+	// the pool size defaults to GOMAXPROCS
+	measureSolver(t, "iter_10", "iter_10", solver.Options{BufferSize: 10 * 1024 * 1024})
 }
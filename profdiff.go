@@ -0,0 +1,293 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// stageOrder is the order of the pipeline stages in a diff, the ones of
+// neither profile are left out
+var stageOrder = []string{"read", "parse", "aggregate", "merge", "other"}
+
+// stageRules classify the samples without a stage label by the function
+// closest to the leaf that matches a rule, so the profiles of the iterations
+// before the labels split into the same stages. The merge stage also holds
+// writing the results.
+var stageRules = []struct {
+	stage string
+	// prefixes of the full function name
+	prefixes []string
+	// function or method names without their package and receiver
+	names []string
+}{
+	{stage: "merge", names: []string{"AddPartialResults", "Merge", "mergeResults", "mergeExtended", "newResult", "CalculateMetricsForCity", "FormatMetrics", "WriteCity", "WriteTo", "writeResult"}},
+	{stage: "aggregate", prefixes: []string{"runtime.mapaccess", "runtime.mapassign", "internal/runtime/maps."}, names: []string{"AddRecord", "GetOrInsert", "addExtended"}},
+	{stage: "parse", prefixes: []string{"strconv."}, names: []string{"ParseRecord", "parseTemperature", "Next", "slowPath", "hashStation"}},
+	{stage: "read", prefixes: []string{"bufio.", "os.(*File).", "syscall.", "internal/poll.", "compress/", "1brc-go/decompress."},
+		names: []string{"ReadRecord", "ReadNextRecord", "ReadNextChunk", "readNextChunk", "ReadBlock", "readBlocks", "ProduceRawRecords", "ReadAt"}},
+}
+
+// labelledStages are stage labels a diff keeps, parse+aggregate is one loop
+// in iter_10 and is split by function name like an unlabelled sample
+var labelledStages = []string{"read", "parse", "aggregate", "merge"}
+
+// profileSummary is the CPU time of a profile by function and by stage
+type profileSummary struct {
+	path     string
+	total    time.Duration
+	duration time.Duration
+	// the function at the leaf of the samples, by comparableFunctionName
+	flat map[string]time.Duration
+	// every function on the stack of the samples
+	cum   map[string]time.Duration
+	stage map[string]time.Duration
+	// the samples that had a stage label
+	labelled time.Duration
+}
+
+func runProfileDiff(args []string) error {
+	fs := flag.NewFlagSet("profdiff", flag.ExitOnError)
+	top := fs.Int("top", 20, "number of functions with the largest changes")
+	cumulative := fs.Bool("cum", false, "compare the cumulative time of the functions instead of their own")
+	out := fs.String("out", "", "markdown file of the report, defaults to stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: profdiff [flags] base.prof candidate.prof")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected two CPU profiles, got %d", fs.NArg())
+	}
+
+	base, err := readProfileSummary(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	candidate, err := readProfileSummary(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	writeProfileDiff(w, base, candidate, *top, *cumulative)
+
+	if file, ok := w.(*os.File); ok && file != os.Stdout {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", *out, err)
+		}
+	}
+	return nil
+}
+
+// readProfileSummary parses a CPU profile as written by Measure
+func readProfileSummary(path string) (profileSummary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return profileSummary{}, fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer file.Close()
+
+	prof, err := pprofile.Parse(file)
+	if err != nil {
+		return profileSummary{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	summary, err := summarizeProfile(prof)
+	if err != nil {
+		return profileSummary{}, fmt.Errorf("%s: %w", path, err)
+	}
+	summary.path = path
+	return summary, nil
+}
+
+// summarizeProfile adds up the CPU time of the samples by function and stage
+func summarizeProfile(prof *pprofile.Profile) (profileSummary, error) {
+	valueIdx := slices.IndexFunc(prof.SampleType, func(st *pprofile.ValueType) bool {
+		return st.Type == "cpu" && st.Unit == "nanoseconds"
+	})
+	if valueIdx == -1 {
+		return profileSummary{}, fmt.Errorf("not a CPU profile, sample types: %v", prof.SampleType)
+	}
+
+	summary := profileSummary{
+		duration: time.Duration(prof.DurationNanos),
+		flat:     make(map[string]time.Duration),
+		cum:      make(map[string]time.Duration),
+		stage:    make(map[string]time.Duration),
+	}
+
+	for _, sample := range prof.Sample {
+		value := time.Duration(sample.Value[valueIdx])
+		summary.total += value
+
+		// the inlined functions of a location come first, the leaf is the
+		// first line of the first location
+		var stack []string
+		for _, location := range sample.Location {
+			for _, line := range location.Line {
+				if line.Function != nil {
+					stack = append(stack, line.Function.Name)
+				}
+			}
+		}
+		if len(stack) == 0 {
+			stack = []string{"(unknown)"}
+		}
+
+		summary.flat[comparableFunctionName(stack[0])] += value
+		seen := make(map[string]bool, len(stack))
+		for _, name := range stack {
+			name = comparableFunctionName(name)
+			if !seen[name] {
+				seen[name] = true
+				summary.cum[name] += value
+			}
+		}
+
+		stage := ""
+		if labels := sample.Label["stage"]; len(labels) > 0 && slices.Contains(labelledStages, labels[0]) {
+			stage = labels[0]
+			summary.labelled += value
+		} else {
+			if len(labels) > 0 {
+				summary.labelled += value
+			}
+			stage = classifyStage(stack)
+		}
+		summary.stage[stage] += value
+	}
+	return summary, nil
+}
+
+// classifyStage returns the stage of the first function from the leaf that
+// matches one of stageRules
+func classifyStage(stack []string) string {
+	for _, name := range stack {
+		short := name[strings.LastIndexByte(name, '.')+1:]
+		for _, rule := range stageRules {
+			if slices.Contains(rule.names, short) || slices.ContainsFunc(rule.prefixes, func(prefix string) bool {
+				return strings.HasPrefix(name, prefix)
+			}) {
+				return rule.stage
+			}
+		}
+	}
+	return "other"
+}
+
+// writeProfileDiff writes the markdown tables of the stages and of the top
+// functions with the largest change in time
+func writeProfileDiff(w io.Writer, base, candidate profileSummary, top int, cumulative bool) {
+	fmt.Fprintf(w, "| profile | samples | duration | stage labels |\n")
+	fmt.Fprintf(w, "|---|---:|---:|---:|\n")
+	for _, summary := range []profileSummary{base, candidate} {
+		fmt.Fprintf(w, "| %s | %s | %s | %.0f%% |\n", summary.path, formatProfileTime(summary.total),
+			formatProfileTime(summary.duration), percentOf(summary.labelled, summary.total))
+	}
+
+	fmt.Fprintf(w, "\n### Stages\n\n")
+	writeDeltaHeader(w, "stage")
+	for _, stage := range stageOrder {
+		if base.stage[stage] == 0 && candidate.stage[stage] == 0 {
+			continue
+		}
+		writeDeltaRow(w, stage, base.stage[stage], base.total, candidate.stage[stage], candidate.total)
+	}
+	writeDeltaRow(w, "**total**", base.total, base.total, candidate.total, candidate.total)
+
+	values, kind := base.flat, "flat"
+	candidateValues := candidate.flat
+	if cumulative {
+		values, kind, candidateValues = base.cum, "cumulative", candidate.cum
+	}
+
+	names := make([]string, 0, len(values)+len(candidateValues))
+	for name := range values {
+		names = append(names, name)
+	}
+	for name := range candidateValues {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	// the largest change in time first, then by name for a stable report
+	slices.SortFunc(names, func(a, b string) int {
+		deltaA := (candidateValues[a] - values[a]).Abs()
+		deltaB := (candidateValues[b] - values[b]).Abs()
+		return cmp.Or(cmp.Compare(deltaB, deltaA), strings.Compare(a, b))
+	})
+	if top > 0 && len(names) > top {
+		names = names[:top]
+	}
+
+	fmt.Fprintf(w, "\n### Functions (%s, largest changes)\n\n", kind)
+	writeDeltaHeader(w, "function")
+	for _, name := range names {
+		writeDeltaRow(w, "`"+name+"`", values[name], base.total, candidateValues[name], candidate.total)
+	}
+}
+
+func writeDeltaHeader(w io.Writer, name string) {
+	fmt.Fprintf(w, "| %s | base | base %% | candidate | candidate %% | Δ time | Δ pp |\n", name)
+	fmt.Fprintf(w, "|---|---:|---:|---:|---:|---:|---:|\n")
+}
+
+// writeDeltaRow writes the time and share of a row in both profiles, the
+// change of the share is in percentage points
+func writeDeltaRow(w io.Writer, name string, base, baseTotal, candidate, candidateTotal time.Duration) {
+	basePercent, candidatePercent := percentOf(base, baseTotal), percentOf(candidate, candidateTotal)
+	fmt.Fprintf(w, "| %s | %s | %.1f%% | %s | %.1f%% | %s | %+.1f |\n", name,
+		formatProfileTime(base), basePercent, formatProfileTime(candidate), candidatePercent,
+		formatProfileDelta(candidate-base), candidatePercent-basePercent)
+}
+
+func percentOf(value, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
+
+// formatProfileTime rounds to the 10ms of the CPU profile sampling
+func formatProfileTime(d time.Duration) string {
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+func formatProfileDelta(d time.Duration) string {
+	return fmt.Sprintf("%+.2fs", d.Seconds())
+}
+
+// shapeArguments are the instantiated type arguments of generic functions
+var shapeArguments = regexp.MustCompile(`\[go\.shape\..*\]`)
+
+// iterationPackage is the package of an iteration in a function name
+var iterationPackage = regexp.MustCompile(`1brc-go/iterations/[a-z0-9_]+\.`)
+
+// comparableFunctionName drops the iteration package and the shapes of
+// generic functions, so the same function of two iterations is one row, e.g.
+// (*RecordScanner).Next of iter_09 and iter_10
+func comparableFunctionName(name string) string {
+	name = shapeArguments.ReplaceAllString(name, "[...]")
+	name = iterationPackage.ReplaceAllString(name, "")
+	return strings.TrimPrefix(name, "1brc-go/")
+}
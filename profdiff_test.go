@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// testProfile builds a CPU profile from samples of 10ms each, the stacks go
+// from the leaf to the root
+func testProfile(samples []testSample) *pprofile.Profile {
+	prof := &pprofile.Profile{
+		SampleType:    []*pprofile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:    &pprofile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        int64(10 * time.Millisecond),
+		DurationNanos: int64(time.Second),
+	}
+
+	functions := make(map[string]*pprofile.Function)
+	for _, sample := range samples {
+		var locations []*pprofile.Location
+		for _, name := range sample.stack {
+			function, ok := functions[name]
+			if !ok {
+				function = &pprofile.Function{ID: uint64(len(functions) + 1), Name: name}
+				functions[name] = function
+				prof.Function = append(prof.Function, function)
+			}
+			location := &pprofile.Location{ID: uint64(len(prof.Location) + 1), Line: []pprofile.Line{{Function: function}}}
+			prof.Location = append(prof.Location, location)
+			locations = append(locations, location)
+		}
+
+		var labels map[string][]string
+		if sample.stage != "" {
+			labels = map[string][]string{"stage": {sample.stage}}
+		}
+		prof.Sample = append(prof.Sample, &pprofile.Sample{
+			Location: locations,
+			Value:    []int64{int64(sample.count), int64(sample.count) * int64(10*time.Millisecond)},
+			Label:    labels,
+		})
+	}
+	return prof
+}
+
+type testSample struct {
+	stack []string
+	stage string
+	count int
+}
+
+func TestClassifyStage(t *testing.T) {
+	tests := []struct {
+		stack []string
+		want  string
+	}{
+		{[]string{"strconv.readFloat", "strconv.ParseFloat", "1brc-go/iterations/iter_05.ParseRecord"}, "parse"},
+		{[]string{"runtime.mapassign_faststr", "1brc-go/iterations/iter_03.(*Aggregator).AddRecord"}, "aggregate"},
+		{[]string{"bytes.IndexByte", "1brc-go/iterations/iter_04.(*RecordGenerator).ReadRecord"}, "read"},
+		{[]string{"syscall.Syscall6", "os.(*File).ReadAt", "1brc-go/iterations/iter_10.(*RecordGenerator).readNextChunk"}, "read"},
+		{[]string{"runtime.mallocgc", "1brc-go/iterations/iter_10.(*ResultAggregator).AddPartialResults", "1brc-go/iterations/iter_10.mergeResults"}, "merge"},
+		{[]string{"runtime.gcBgMarkWorker"}, "other"},
+	}
+
+	for _, tt := range tests {
+		if got := classifyStage(tt.stack); got != tt.want {
+			t.Errorf("classifyStage(%v) = %q, want %q", tt.stack, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeProfile(t *testing.T) {
+	prof := testProfile([]testSample{
+		{stack: []string{"1brc-go/iterations/iter_10.(*RecordScanner).Next", "1brc-go/iterations/iter_10.processBlock"}, stage: "parse+aggregate", count: 6},
+		{stack: []string{"1brc-go/stationtable.(*Table[go.shape.struct { 1brc-go/iterations/iter_10.min int }]).GetOrInsert", "1brc-go/iterations/iter_10.processBlock"}, stage: "parse+aggregate", count: 3},
+		{stack: []string{"1brc-go/iterations/iter_10.(*RecordScanner).Next", "1brc-go/iterations/iter_10.processBlockStaged"}, stage: "aggregate", count: 1},
+		{stack: []string{"runtime.gcBgMarkWorker"}, count: 2},
+	})
+
+	summary, err := summarizeProfile(prof)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if summary.total != 120*time.Millisecond || summary.labelled != 100*time.Millisecond {
+		t.Errorf("got total %v with %v labelled", summary.total, summary.labelled)
+	}
+	// parse+aggregate is split by function, other stage labels are kept
+	want := map[string]time.Duration{"parse": 60 * time.Millisecond, "aggregate": 40 * time.Millisecond, "other": 20 * time.Millisecond}
+	for stage, d := range want {
+		if summary.stage[stage] != d {
+			t.Errorf("got %v for stage %s, want %v", summary.stage[stage], stage, d)
+		}
+	}
+
+	if got := summary.flat["(*RecordScanner).Next"]; got != 70*time.Millisecond {
+		t.Errorf("got flat %v for Next, want 70ms", got)
+	}
+	if got := summary.cum["processBlock"]; got != 90*time.Millisecond {
+		t.Errorf("got cum %v for processBlock, want 90ms", got)
+	}
+	if _, ok := summary.flat["stationtable.(*Table[...]).GetOrInsert"]; !ok {
+		t.Errorf("expected the shape of GetOrInsert to be dropped, got %v", summary.flat)
+	}
+}
+
+func TestWriteProfileDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, prof *pprofile.Profile) string {
+		path := filepath.Join(dir, name)
+		file, _ := os.Create(path)
+		defer file.Close()
+		if err := prof.Write(file); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// the same function of two iterations is compared
+	basePath := write("base.prof", testProfile([]testSample{
+		{stack: []string{"strconv.ParseFloat", "1brc-go/iterations/iter_05.ParseRecord"}, count: 5},
+		{stack: []string{"runtime.mapaccess2_faststr", "1brc-go/iterations/iter_05.(*Aggregator).AddRecord"}, count: 5},
+	}))
+	candidatePath := write("candidate.prof", testProfile([]testSample{
+		{stack: []string{"1brc-go/iterations/iter_06.parseTemperature", "1brc-go/iterations/iter_06.ParseRecord"}, count: 2},
+		{stack: []string{"runtime.mapaccess2_faststr", "1brc-go/iterations/iter_06.(*Aggregator).AddRecord"}, count: 4},
+	}))
+
+	base, err := readProfileSummary(basePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	candidate, err := readProfileSummary(candidatePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writeProfileDiff(&buf, base, candidate, 2, false)
+	report := buf.String()
+
+	for _, want := range []string{
+		"| " + basePath + " | 0.10s | 1.00s | 0% |",
+		"| parse | 0.05s | 50.0% | 0.02s | 33.3% | -0.03s | -16.7 |",
+		"| aggregate | 0.05s | 50.0% | 0.04s | 66.7% | -0.01s | +16.7 |",
+		"| **total** | 0.10s | 100.0% | 0.06s | 100.0% | -0.04s | +0.0 |",
+		"| `strconv.ParseFloat` | 0.05s | 50.0% | 0.00s | 0.0% | -0.05s | -50.0 |",
+		"| `parseTemperature` | 0.00s | 0.0% | 0.02s | 33.3% | +0.02s | +33.3 |",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the report:\n%s", want, report)
+		}
+	}
+	// only the top 2 functions
+	if strings.Contains(report, "runtime.mapaccess2_faststr") {
+		t.Errorf("expected at most 2 functions:\n%s", report)
+	}
+
+	buf.Reset()
+	writeProfileDiff(&buf, base, candidate, 3, true)
+	if !strings.Contains(buf.String(), "| `ParseRecord` | 0.05s | 50.0% | 0.02s | 33.3% | -0.03s | -16.7 |") {
+		t.Errorf("expected the cumulative time of ParseRecord:\n%s", buf.String())
+	}
+}
+
+func TestReadProfileSummary_NotCPU(t *testing.T) {
+	prof := testProfile(nil)
+	prof.SampleType = []*pprofile.ValueType{{Type: "alloc_space", Unit: "bytes"}}
+	path := filepath.Join(t.TempDir(), "mem.prof")
+	file, _ := os.Create(path)
+	prof.Write(file)
+	file.Close()
+
+	if _, err := readProfileSummary(path); err == nil || !strings.Contains(err.Error(), "not a CPU profile") {
+		t.Errorf("expected an error for a heap profile, got %v", err)
+	}
+}
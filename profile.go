@@ -0,0 +1,224 @@
+package main
+
+import (
+	"1brc-go/solver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"slices"
+	"strings"
+)
+
+// Profiles selects what Measure captures of a run
+type Profiles uint8
+
+const (
+	ProfileCPU Profiles = 1 << iota
+	// live objects after the run
+	ProfileHeap
+	// every allocation since the program started, sampled
+	ProfileAllocs
+	// time spent waiting on channels, selects and locks
+	ProfileBlock
+	// contended mutexes
+	ProfileMutex
+	// runtime/trace of the goroutines, GC and syscalls
+	ProfileTrace
+)
+
+// profileKind names a profile for -profiles and its file
+type profileKind struct {
+	profile Profiles
+	name    string
+	file    string
+}
+
+// the heap profile keeps the mem_ prefix of the files written so far
+var profileKinds = []profileKind{
+	{ProfileCPU, "cpu", "cpu_%s_%s.prof"},
+	{ProfileHeap, "heap", "mem_%s_%s.prof"},
+	{ProfileAllocs, "allocs", "allocs_%s_%s.prof"},
+	{ProfileBlock, "block", "block_%s_%s.prof"},
+	{ProfileMutex, "mutex", "mutex_%s_%s.prof"},
+	{ProfileTrace, "trace", "trace_%s_%s.out"},
+}
+
+// defaultProfiles are captured by -p alone
+const defaultProfiles = ProfileCPU | ProfileHeap
+
+// profileDir is created on the first profiled run
+var profileDir = "profiles"
+
+// parseProfiles parses a comma separated list of profile names, "all" selects
+// every profile
+func parseProfiles(value string) (Profiles, error) {
+	var profiles Profiles
+	for name := range strings.SplitSeq(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			profiles |= ProfileCPU | ProfileHeap | ProfileAllocs | ProfileBlock | ProfileMutex | ProfileTrace
+			continue
+		}
+		i := slices.IndexFunc(profileKinds, func(kind profileKind) bool {
+			return kind.name == name
+		})
+		if i == -1 {
+			return 0, fmt.Errorf("unknown profile %q, expected cpu, heap, allocs, block, mutex, trace or all", name)
+		}
+		profiles |= profileKinds[i].profile
+	}
+	return profiles, nil
+}
+
+func (p Profiles) String() string {
+	var names []string
+	for _, kind := range profileKinds {
+		if p&kind.profile != 0 {
+			names = append(names, kind.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// selectedProfiles are the profiles of the -p and -profiles flags, naming
+// profiles also turns profiling on
+func selectedProfiles() (Profiles, error) {
+	if *profileList != "" {
+		return parseProfiles(*profileList)
+	}
+	if *profile {
+		return defaultProfiles, nil
+	}
+	return 0, nil
+}
+
+// withStageLabels turns on the labels=1 knob of solvers that label their CPU
+// profile samples by stage when a CPU profile is captured, unless the knobs
+// already set it
+func withStageLabels(name string, knobs string, profiles Profiles) string {
+	if profiles&ProfileCPU == 0 || !slices.Contains(solver.Knobs(name), "labels") {
+		return knobs
+	}
+	for knob := range strings.SplitSeq(knobs, ",") {
+		if strings.HasPrefix(strings.TrimSpace(knob), "labels=") {
+			return knobs
+		}
+	}
+	if knobs == "" {
+		return "labels=1"
+	}
+	return knobs + ",labels=1"
+}
+
+// profileCapture holds the files of the profiles of one measured run
+type profileCapture struct {
+	profiles Profiles
+	files    map[Profiles]*os.File
+	// restored when the run is over
+	mutexFraction int
+}
+
+// startProfiles creates the files of every selected profile before the run,
+// so a missing directory or a full disk fails before anything is measured,
+// then starts the CPU profile and trace and the block and mutex sampling
+func startProfiles(profiles Profiles, name string, timestamp string) (*profileCapture, error) {
+	capture := &profileCapture{profiles: profiles, files: make(map[Profiles]*os.File)}
+	if profiles == 0 {
+		return capture, nil
+	}
+
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	for _, kind := range profileKinds {
+		if profiles&kind.profile == 0 {
+			continue
+		}
+		file, err := os.Create(filepath.Join(profileDir, fmt.Sprintf(kind.file, name, timestamp)))
+		if err != nil {
+			capture.closeFiles()
+			return nil, fmt.Errorf("failed to create %s profile: %w", kind.name, err)
+		}
+		capture.files[kind.profile] = file
+	}
+
+	if profiles&ProfileBlock != 0 {
+		runtime.SetBlockProfileRate(1)
+	}
+	if profiles&ProfileMutex != 0 {
+		capture.mutexFraction = runtime.SetMutexProfileFraction(1)
+	}
+	if profiles&ProfileCPU != 0 {
+		if err := pprof.StartCPUProfile(capture.files[ProfileCPU]); err != nil {
+			capture.stopSampling()
+			capture.closeFiles()
+			return nil, fmt.Errorf("failed to start cpu profile: %w", err)
+		}
+	}
+	if profiles&ProfileTrace != 0 {
+		if err := trace.Start(capture.files[ProfileTrace]); err != nil {
+			if profiles&ProfileCPU != 0 {
+				pprof.StopCPUProfile()
+			}
+			capture.stopSampling()
+			capture.closeFiles()
+			return nil, fmt.Errorf("failed to start trace: %w", err)
+		}
+	}
+	return capture, nil
+}
+
+// stop ends the CPU profile and trace and writes the profiles taken after the
+// run, every file is closed even when one of them fails
+func (c *profileCapture) stop() error {
+	if c.profiles&ProfileTrace != 0 {
+		trace.Stop()
+	}
+	if c.profiles&ProfileCPU != 0 {
+		pprof.StopCPUProfile()
+	}
+
+	// the other profiles are named like their runtime/pprof profile
+	var errs []error
+	for _, kind := range profileKinds {
+		if c.profiles&kind.profile == 0 || kind.profile == ProfileCPU || kind.profile == ProfileTrace {
+			continue
+		}
+		if err := pprof.Lookup(kind.name).WriteTo(c.files[kind.profile], 0); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write %s profile: %w", kind.name, err))
+		}
+	}
+
+	c.stopSampling()
+	errs = append(errs, c.closeFiles())
+	return errors.Join(errs...)
+}
+
+// stopSampling turns the block and mutex sampling back off
+func (c *profileCapture) stopSampling() {
+	if c.profiles&ProfileBlock != 0 {
+		runtime.SetBlockProfileRate(0)
+	}
+	if c.profiles&ProfileMutex != 0 {
+		runtime.SetMutexProfileFraction(c.mutexFraction)
+	}
+}
+
+func (c *profileCapture) closeFiles() error {
+	var errs []error
+	for _, kind := range profileKinds {
+		if file, ok := c.files[kind.profile]; ok {
+			if err := file.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to write %s profile: %w", kind.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := parseProfiles("cpu, trace,block")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profiles != ProfileCPU|ProfileTrace|ProfileBlock || profiles.String() != "cpu,block,trace" {
+		t.Errorf("got %s", profiles)
+	}
+	if all, _ := parseProfiles("all"); all.String() != "cpu,heap,allocs,block,mutex,trace" {
+		t.Errorf("got %s for all", all)
+	}
+	if _, err := parseProfiles("cpu,goroutine"); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+}
+
+func TestWithStageLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		knobs    string
+		profiles Profiles
+		want     string
+	}{
+		{name: "iter_10", profiles: ProfileCPU, want: "labels=1"},
+		{name: "iter_10", knobs: "section=1024", profiles: ProfileCPU | ProfileHeap, want: "section=1024,labels=1"},
+		{name: "iter_10", knobs: "labels=0", profiles: ProfileCPU, want: "labels=0"},
+		// the labels only matter to the CPU profile
+		{name: "iter_10", profiles: ProfileTrace, want: ""},
+		{name: "iter_07", profiles: ProfileCPU, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := withStageLabels(tt.name, tt.knobs, tt.profiles); got != tt.want {
+			t.Errorf("withStageLabels(%q, %q, %s) = %q, want %q", tt.name, tt.knobs, tt.profiles, got, tt.want)
+		}
+	}
+}
+
+func TestMeasure_Profiles(t *testing.T) {
+	profileDir = filepath.Join(t.TempDir(), "profiles")
+	defer func() { profileDir = "profiles" }()
+
+	all, _ := parseProfiles("all")
+	_, err := Measure("profiled", all, func() {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Go(func() {
+				mu.Lock()
+				time.Sleep(time.Millisecond)
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the directory is created and every profile has a file
+	for _, pattern := range []string{"cpu_*.prof", "mem_*.prof", "allocs_*.prof", "block_*.prof", "mutex_*.prof", "trace_*.out"} {
+		matches, _ := filepath.Glob(filepath.Join(profileDir, pattern))
+		if len(matches) != 1 {
+			t.Errorf("got %d files for %s, want 1", len(matches), pattern)
+			continue
+		}
+		if info, err := os.Stat(matches[0]); err != nil || info.Size() == 0 {
+			t.Errorf("expected %s to hold a profile", matches[0])
+		}
+	}
+
+	// the sampling is off again after the run
+	if fraction := runtime.SetMutexProfileFraction(-1); fraction != 0 {
+		t.Errorf("got mutex profile fraction %d after the run, want 0", fraction)
+	}
+}
+
+func TestMeasure_ProfileDirectoryError(t *testing.T) {
+	// a file where the directory should be
+	profileDir = filepath.Join(t.TempDir(), "profiles")
+	defer func() { profileDir = "profiles" }()
+	os.WriteFile(profileDir, nil, 0666)
+
+	ran := false
+	if _, err := Measure("profiled", ProfileCPU, func() { ran = true }); err == nil || ran {
+		t.Errorf("expected an error before the run, got %v and ran=%v", err, ran)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress line is redrawn
+const progressInterval = 250 * time.Millisecond
+
+// progressRenderer draws the progress a solver reports on a single line of
+// out, redrawing it on a timer so the workers only add to two counters
+type progressRenderer struct {
+	out   io.Writer
+	bytes atomic.Int64
+	rows  atomic.Int64
+
+	mu      sync.Mutex
+	total   int64
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newProgressRenderer(out io.Writer) *progressRenderer {
+	return &progressRenderer{out: out}
+}
+
+// Start resets the counters for a new run and starts redrawing the line
+func (p *progressRenderer) Start(totalBytes int64) {
+	p.Finish()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bytes.Store(0)
+	p.rows.Store(0)
+	p.total = totalBytes
+	p.started = time.Now()
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go p.redraw(p.stop, p.done)
+}
+
+func (p *progressRenderer) Add(bytes int64, rows int64) {
+	p.bytes.Add(bytes)
+	p.rows.Add(rows)
+}
+
+// Finish stops redrawing and leaves the last state on its own line, it does
+// nothing when the run was already finished
+func (p *progressRenderer) Finish() {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (p *progressRenderer) redraw(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprint(p.out, "\r"+p.line(time.Now()))
+		case <-stop:
+			fmt.Fprint(p.out, "\r"+p.line(time.Now())+"\n")
+			return
+		}
+	}
+}
+
+// line formats the progress at now, the percentage and ETA are left out when
+// the size of the input is not known
+func (p *progressRenderer) line(now time.Time) string {
+	p.mu.Lock()
+	total, started := p.total, p.started
+	p.mu.Unlock()
+
+	bytes, rows := p.bytes.Load(), p.rows.Load()
+	elapsed := now.Sub(started).Seconds()
+
+	var parts []string
+	if total > 0 {
+		parts = append(parts, fmt.Sprintf("%5.1f%%", 100*float64(bytes)/float64(total)))
+		parts = append(parts, fmt.Sprintf("%s of %s", formatBytes(bytes), formatBytes(total)))
+	} else {
+		parts = append(parts, formatBytes(bytes))
+	}
+
+	if elapsed > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f MB/s", float64(bytes)/elapsed/1e6))
+		parts = append(parts, fmt.Sprintf("%.2fM rows/s", float64(rows)/elapsed/1e6))
+	}
+
+	if total > 0 && bytes > 0 && elapsed > 0 {
+		remaining := time.Duration(float64(total-bytes) / (float64(bytes) / elapsed) * float64(time.Second))
+		parts = append(parts, "ETA "+max(remaining, 0).Round(100*time.Millisecond).String())
+	}
+
+	return fmt.Sprintf("➜ [%-15s] %s", "progress", strings.Join(parts, " | "))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.2f GB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	default:
+		return fmt.Sprintf("%.1f kB", float64(n)/1e3)
+	}
+}
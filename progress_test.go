@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressRenderer_Line(t *testing.T) {
+	p := newProgressRenderer(nil)
+	p.total = 4e9
+	p.started = time.Unix(0, 0)
+	p.Add(1e9, 70e6)
+
+	got := p.line(time.Unix(2, 0))
+	for _, want := range []string{"25.0%", "1.00 GB of 4.00 GB", "500.0 MB/s", "35.00M rows/s", "ETA 6s"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("line %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestProgressRenderer_UnknownTotal(t *testing.T) {
+	p := newProgressRenderer(nil)
+	p.total = -1
+	p.started = time.Unix(0, 0)
+	p.Add(5e6, 1000)
+
+	got := p.line(time.Unix(1, 0))
+	if strings.Contains(got, "%") || strings.Contains(got, "ETA") {
+		t.Errorf("line %q shows a percentage or ETA without a total", got)
+	}
+	if !strings.Contains(got, "5.0 MB") || !strings.Contains(got, "5.0 MB/s") {
+		t.Errorf("line %q does not show the bytes and throughput", got)
+	}
+}
+
+func TestProgressRenderer_StartFinish(t *testing.T) {
+	var out bytes.Buffer
+	p := newProgressRenderer(&out)
+
+	p.Start(100)
+	p.Add(100, 10)
+	p.Finish()
+	p.Finish()
+
+	if got := out.String(); !strings.HasSuffix(got, "\n") || !strings.Contains(got, "100.0%") {
+		t.Errorf("got %q, want the final state on its own line", got)
+	}
+
+	// a new run starts from zero again
+	p.Start(100)
+	if p.bytes.Load() != 0 || p.rows.Load() != 0 {
+		t.Errorf("counters were not reset by Start")
+	}
+	p.Finish()
+}
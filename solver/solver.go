@@ -0,0 +1,396 @@
+// Package solver is the common entry point of every iteration.
+//
+// Each iteration package registers itself under its directory name (base,
+// iter_01, ...) from an init function, so the CLI, the tests and the
+// benchmarks can enumerate and run them without knowing their Execute signature.
+package solver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Options are the tuning knobs shared by the iterations, zero values fall back
+// to the defaults the iteration was registered with.
+type Options struct {
+	BufferSize int
+	Workers    int
+
+	// OnError is fail (default), skip or quarantine, see LenientParsing
+	OnError        string
+	QuarantinePath string
+
+	// Format is canonical (default), json, csv or ndjson, see OutputFormats
+	Format string
+
+	// Stats is a comma separated list of optional statistics, see ExtendedStats
+	Stats string
+
+	// PerFile also writes the results of every input on its own, see MultipleInputs
+	PerFile bool
+
+	// Progress receives the work done during a run, see ProgressReporting
+	Progress Progress
+
+	// Knobs is a comma separated list of solver specific tuning parameters,
+	// e.g. "section=8388608", see RegisterKnobs and Knob
+	Knobs string
+
+	// Records describes the layout of the input, see RecordFormats
+	Records RecordFormat
+}
+
+// RecordFormat describes the records of an input. Zero fields are those of
+// the 1BRC format, "Hamburg;12.3\n".
+type RecordFormat struct {
+	// between the station and the temperature, ';' when zero
+	FieldSeparator byte
+	// ends every record, '\n' when zero
+	RecordSeparator byte
+	// decimal places of the temperatures, 1 when zero
+	Decimals int
+	// also accept temperatures with fewer decimal places
+	FewerDecimals bool
+	// records may end in "\r" followed by the record separator
+	CRLF bool
+	// the first record of every input is a header and is skipped
+	Header bool
+}
+
+// IsDefault reports whether f is the 1BRC format, spelled out or not
+func (f RecordFormat) IsDefault() bool {
+	return (f.FieldSeparator == 0 || f.FieldSeparator == ';') &&
+		(f.RecordSeparator == 0 || f.RecordSeparator == '\n') &&
+		(f.Decimals == 0 || f.Decimals == 1) &&
+		!f.FewerDecimals && !f.CRLF && !f.Header
+}
+
+// Progress is told the size of the input when a run starts, -1 when it is
+// not known up front (streams, compressed input), and then the bytes and rows
+// processed as the workers finish parts of it. Add is called concurrently.
+// Finish is called when the run ends, also when it failed, before the solver
+// prints anything else.
+type Progress interface {
+	Start(totalBytes int64)
+	Add(bytes int64, rows int64)
+	Finish()
+}
+
+// Feature marks optional options a solver understands, solvers that were not
+// registered with a feature reject options that need it.
+type Feature uint
+
+const (
+	LenientParsing    Feature = 1 << iota // OnError and QuarantinePath
+	OutputFormats                         // Format
+	ExtendedStats                         // Stats
+	Streaming                             // Stream, added by RegisterStream
+	CompressedInput                       // Run accepts gzip and bzip2 files
+	MultipleInputs                        // RunFiles and PerFile, added by RegisterFiles
+	ProgressReporting                     // Progress
+	Cancellation                          // Run, Stream and RunFiles stop when ctx is cancelled
+	RecordFormats                         // Records
+)
+
+var featureNames = map[Feature]string{
+	LenientParsing:    "lenient parsing",
+	OutputFormats:     "output formats",
+	ExtendedStats:     "extended statistics",
+	Streaming:         "streaming input",
+	CompressedInput:   "compressed input",
+	MultipleInputs:    "multiple inputs",
+	ProgressReporting: "progress reporting",
+	Cancellation:      "cancellation",
+	RecordFormats:     "record formats",
+}
+
+func (f Feature) String() string {
+	var names []string
+	for feature, name := range featureNames {
+		if f&feature != 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// requires returns the features needed to honour opts
+func (opts Options) requires() Feature {
+	var required Feature
+	if (opts.OnError != "" && opts.OnError != "fail") || opts.QuarantinePath != "" {
+		required |= LenientParsing
+	}
+	if opts.Format != "" && opts.Format != "canonical" {
+		required |= OutputFormats
+	}
+	if opts.Stats != "" {
+		required |= ExtendedStats
+	}
+	if opts.PerFile {
+		required |= MultipleInputs
+	}
+	if opts.Progress != nil {
+		required |= ProgressReporting
+	}
+	if !opts.Records.IsDefault() {
+		required |= RecordFormats
+	}
+	return required
+}
+
+// Knob returns the value of a knob, zero when it is not set. New has already
+// rejected malformed knobs.
+func (opts Options) Knob(name string) int {
+	knobs, _ := opts.parseKnobs()
+	return knobs[name]
+}
+
+func (opts Options) parseKnobs() (map[string]int, error) {
+	knobs := make(map[string]int)
+	for knob := range strings.SplitSeq(opts.Knobs, ",") {
+		if strings.TrimSpace(knob) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(knob, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid knob %q, expected name=integer", knob)
+		}
+		knobs[strings.TrimSpace(name)] = n
+	}
+	return knobs, nil
+}
+
+// withDefaults fills the unset fields of opts from defaults
+func (opts Options) withDefaults(defaults Options) Options {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaults.BufferSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaults.Workers
+	}
+	return opts
+}
+
+type Solver interface {
+	Name() string
+	Options() Options
+	Run(ctx context.Context, inputPath string, outputPath string) error
+	// Stream reads the records sequentially from input, it fails unless the
+	// solver supports Streaming
+	Stream(ctx context.Context, input io.Reader, outputPath string) error
+	// RunFiles aggregates all inputPaths into one result, it fails unless the
+	// solver supports MultipleInputs
+	RunFiles(ctx context.Context, inputPaths []string, outputPath string) error
+	Supports(feature Feature) bool
+}
+
+// RunFunc processes inputPath and writes the results to outputPath
+type RunFunc func(ctx context.Context, inputPath string, outputPath string, opts Options) error
+
+// StreamFunc processes the records read from input and writes the results to outputPath
+type StreamFunc func(ctx context.Context, input io.Reader, outputPath string, opts Options) error
+
+// FilesFunc processes all inputPaths together and writes the results to outputPath
+type FilesFunc func(ctx context.Context, inputPaths []string, outputPath string, opts Options) error
+
+type registration struct {
+	defaults Options
+	run      RunFunc
+	stream   StreamFunc
+	files    FilesFunc
+	features Feature
+	knobs    []string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]registration)
+)
+
+// Register makes a solver available by name, it panics if the name is already taken.
+func Register(name string, defaults Options, run RunFunc, features ...Feature) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if run == nil {
+		panic("solver: Register run func is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("solver: Register called twice for " + name)
+	}
+	reg := registration{defaults: defaults, run: run}
+	for _, feature := range features {
+		reg.features |= feature
+	}
+	registry[name] = reg
+}
+
+// RegisterStream adds a streaming entry point to the solver registered under
+// name, it panics if there is no such solver or it already has one.
+func RegisterStream(name string, stream StreamFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if stream == nil {
+		panic("solver: RegisterStream stream func is nil for " + name)
+	}
+	reg, ok := registry[name]
+	if !ok {
+		panic("solver: RegisterStream called before Register for " + name)
+	}
+	if reg.stream != nil {
+		panic("solver: RegisterStream called twice for " + name)
+	}
+	reg.stream = stream
+	reg.features |= Streaming
+	registry[name] = reg
+}
+
+// RegisterFiles adds a multi-file entry point to the solver registered under
+// name, it panics if there is no such solver or it already has one.
+func RegisterFiles(name string, files FilesFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if files == nil {
+		panic("solver: RegisterFiles files func is nil for " + name)
+	}
+	reg, ok := registry[name]
+	if !ok {
+		panic("solver: RegisterFiles called before Register for " + name)
+	}
+	if reg.files != nil {
+		panic("solver: RegisterFiles called twice for " + name)
+	}
+	reg.files = files
+	reg.features |= MultipleInputs
+	registry[name] = reg
+}
+
+// RegisterKnobs declares the knobs the solver registered under name reads
+// from Options.Knobs, it panics if there is no such solver.
+func RegisterKnobs(name string, knobs ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	reg, ok := registry[name]
+	if !ok {
+		panic("solver: RegisterKnobs called before Register for " + name)
+	}
+	reg.knobs = append(reg.knobs, knobs...)
+	registry[name] = reg
+}
+
+// Knobs returns the knobs a solver declared, sorted by name.
+func Knobs(name string) []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	knobs := slices.Clone(registry[name].knobs)
+	slices.Sort(knobs)
+	return knobs
+}
+
+// New returns the solver registered under name configured with opts.
+func New(name string, opts Options) (Solver, error) {
+	registryMu.RLock()
+	reg, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown solver %q (registered: %v)", name, Names())
+	}
+	if missing := opts.requires() &^ reg.features; missing != 0 {
+		return nil, fmt.Errorf("solver %q does not support %s", name, missing)
+	}
+	knobs, err := opts.parseKnobs()
+	if err != nil {
+		return nil, err
+	}
+	for knob := range knobs {
+		if !slices.Contains(reg.knobs, knob) {
+			return nil, fmt.Errorf("solver %q has no knob %q (knobs: %v)", name, knob, reg.knobs)
+		}
+	}
+
+	return &funcSolver{name: name, opts: opts.withDefaults(reg.defaults), run: reg.run, stream: reg.stream, files: reg.files, features: reg.features}, nil
+}
+
+// Names returns the registered solver names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Defaults returns the options a solver was registered with.
+func Defaults(name string) (Options, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	reg, ok := registry[name]
+	return reg.defaults, ok
+}
+
+type funcSolver struct {
+	name     string
+	opts     Options
+	run      RunFunc
+	stream   StreamFunc
+	files    FilesFunc
+	features Feature
+}
+
+func (s *funcSolver) Name() string {
+	return s.name
+}
+
+func (s *funcSolver) Options() Options {
+	return s.opts
+}
+
+func (s *funcSolver) Run(ctx context.Context, inputPath string, outputPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.run(ctx, inputPath, outputPath, s.opts)
+}
+
+func (s *funcSolver) Stream(ctx context.Context, input io.Reader, outputPath string) error {
+	if s.stream == nil {
+		return fmt.Errorf("solver %q does not support %s", s.name, Streaming)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.stream(ctx, input, outputPath, s.opts)
+}
+
+func (s *funcSolver) RunFiles(ctx context.Context, inputPaths []string, outputPath string) error {
+	if s.files == nil {
+		return fmt.Errorf("solver %q does not support %s", s.name, MultipleInputs)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.files(ctx, inputPaths, outputPath, s.opts)
+}
+
+func (s *funcSolver) Supports(feature Feature) bool {
+	return s.features&feature == feature
+}
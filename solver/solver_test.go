@@ -0,0 +1,239 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNew_FillsDefaults(t *testing.T) {
+	var got Options
+	Register("test_defaults", Options{BufferSize: 1024, Workers: 4}, func(ctx context.Context, inputPath string, outputPath string, opts Options) error {
+		got = opts
+		return nil
+	})
+
+	s, err := New("test_defaults", Options{Workers: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Name() != "test_defaults" {
+		t.Errorf("got name %q, want %q", s.Name(), "test_defaults")
+	}
+
+	want := Options{BufferSize: 1024, Workers: 8}
+	if s.Options() != want {
+		t.Errorf("got options %+v, want %+v", s.Options(), want)
+	}
+
+	if err := s.Run(context.Background(), "in", "out"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("run got options %+v, want %+v", got, want)
+	}
+}
+
+func TestNew_UnknownSolver(t *testing.T) {
+	if _, err := New("does_not_exist", Options{}); err == nil {
+		t.Errorf("expected error for unknown solver, got nil")
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	noop := func(ctx context.Context, inputPath string, outputPath string, opts Options) error { return nil }
+	Register("test_duplicate", Options{}, noop)
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on duplicate registration")
+		}
+	}()
+	Register("test_duplicate", Options{}, noop)
+}
+
+func TestNames_Sorted(t *testing.T) {
+	noop := func(ctx context.Context, inputPath string, outputPath string, opts Options) error { return nil }
+	Register("test_names_b", Options{}, noop)
+	Register("test_names_a", Options{}, noop)
+
+	names := Names()
+	if !slices.IsSorted(names) {
+		t.Errorf("names are not sorted: %v", names)
+	}
+	if !slices.Contains(names, "test_names_a") || !slices.Contains(names, "test_names_b") {
+		t.Errorf("registered solvers missing from %v", names)
+	}
+}
+
+func TestRun_CancelledContext(t *testing.T) {
+	called := false
+	Register("test_cancelled", Options{}, func(ctx context.Context, inputPath string, outputPath string, opts Options) error {
+		called = true
+		return nil
+	})
+
+	s, err := New("test_cancelled", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Run(ctx, "in", "out"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if called {
+		t.Errorf("solver must not run with a cancelled context")
+	}
+}
+
+func TestNew_UnsupportedFeature(t *testing.T) {
+	noop := func(ctx context.Context, inputPath string, outputPath string, opts Options) error { return nil }
+	Register("test_basic", Options{}, noop)
+	Register("test_lenient", Options{}, noop, LenientParsing)
+
+	if _, err := New("test_basic", Options{OnError: "skip"}); err == nil {
+		t.Errorf("expected error for unsupported option, got nil")
+	}
+	if _, err := New("test_basic", Options{OnError: "fail"}); err != nil {
+		t.Errorf("the default error mode must be accepted by every solver: %v", err)
+	}
+	if _, err := New("test_lenient", Options{OnError: "quarantine", QuarantinePath: "rejected.txt"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := New("test_lenient", Options{Format: "json"}); err == nil {
+		t.Errorf("expected error for unsupported output format, got nil")
+	}
+	if _, err := New("test_lenient", Options{Progress: nopProgress{}}); err == nil {
+		t.Errorf("expected error for unsupported progress reporting, got nil")
+	}
+	if _, err := New("test_basic", Options{Records: RecordFormat{Header: true}}); err == nil {
+		t.Errorf("expected error for unsupported record format, got nil")
+	}
+	if _, err := New("test_basic", Options{Records: RecordFormat{FieldSeparator: ';', RecordSeparator: '\n', Decimals: 1}}); err != nil {
+		t.Errorf("the spelled out 1BRC format must be accepted by every solver: %v", err)
+	}
+}
+
+func TestRegisterStream(t *testing.T) {
+	noop := func(ctx context.Context, inputPath string, outputPath string, opts Options) error { return nil }
+	Register("test_file_only", Options{}, noop)
+	Register("test_streaming", Options{}, noop)
+
+	var got string
+	RegisterStream("test_streaming", func(ctx context.Context, input io.Reader, outputPath string, opts Options) error {
+		data, err := io.ReadAll(input)
+		got = string(data)
+		return err
+	})
+
+	fileOnly, err := New("test_file_only", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fileOnly.Supports(Streaming) {
+		t.Errorf("solver without a stream func must not support streaming")
+	}
+	if err := fileOnly.Stream(context.Background(), strings.NewReader("a;1.0\n"), "out"); err == nil {
+		t.Errorf("expected error streaming into a solver without a stream func, got nil")
+	}
+
+	streaming, err := New("test_streaming", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !streaming.Supports(Streaming) {
+		t.Errorf("solver with a stream func must support streaming")
+	}
+	if err := streaming.Stream(context.Background(), strings.NewReader("a;1.0\n"), "out"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "a;1.0\n" {
+		t.Errorf("stream func read %q, want %q", got, "a;1.0\n")
+	}
+}
+
+func TestRegisterFiles(t *testing.T) {
+	noop := func(ctx context.Context, inputPath string, outputPath string, opts Options) error { return nil }
+	Register("test_single_file", Options{}, noop)
+	Register("test_many_files", Options{}, noop)
+
+	var got []string
+	RegisterFiles("test_many_files", func(ctx context.Context, inputPaths []string, outputPath string, opts Options) error {
+		got = inputPaths
+		return nil
+	})
+
+	if _, err := New("test_single_file", Options{PerFile: true}); err == nil {
+		t.Errorf("expected error for per file results on a single file solver, got nil")
+	}
+	single, err := New("test_single_file", Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := single.RunFiles(context.Background(), []string{"a", "b"}, "out"); err == nil {
+		t.Errorf("expected error running several files on a single file solver, got nil")
+	}
+
+	many, err := New("test_many_files", Options{PerFile: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !many.Supports(MultipleInputs) {
+		t.Errorf("solver with a files func must support multiple inputs")
+	}
+	if err := many.RunFiles(context.Background(), []string{"a", "b"}, "out"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("files func got %v, want [a b]", got)
+	}
+}
+
+type nopProgress struct{}
+
+func (nopProgress) Start(totalBytes int64)      {}
+func (nopProgress) Add(bytes int64, rows int64) {}
+func (nopProgress) Finish()                     {}
+
+func TestRegisterKnobs(t *testing.T) {
+	var got Options
+	Register("test_knobs", Options{}, func(ctx context.Context, inputPath string, outputPath string, opts Options) error {
+		got = opts
+		return nil
+	})
+	RegisterKnobs("test_knobs", "section", "batch")
+
+	if knobs := Knobs("test_knobs"); !slices.Equal(knobs, []string{"batch", "section"}) {
+		t.Errorf("got knobs %v, want [batch section]", knobs)
+	}
+	if _, err := New("test_knobs", Options{Knobs: "sections=4"}); err == nil {
+		t.Errorf("expected error for an unknown knob, got nil")
+	}
+	if _, err := New("test_knobs", Options{Knobs: "section=4MiB"}); err == nil {
+		t.Errorf("expected error for a malformed knob, got nil")
+	}
+
+	s, err := New("test_knobs", Options{Knobs: "section=4, batch=2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Run(context.Background(), "in", "out"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Knob("section") != 4 || got.Knob("batch") != 2 || got.Knob("other") != 0 {
+		t.Errorf("run func got knobs %q, want section=4 and batch=2", got.Knobs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected RegisterKnobs to panic for an unregistered solver")
+		}
+	}()
+	RegisterKnobs("test_no_such_solver", "section")
+}
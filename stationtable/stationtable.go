@@ -0,0 +1,123 @@
+// Package stationtable is an open-addressing hash table keyed on the raw
+// station bytes of a record.
+//
+// It replaces map[string]*V on the hot path: the hash is computed while
+// scanning for the separator, lookups compare the stored key bytes with
+// bytes.Equal and never convert the station to a string, and the capacity is
+// a fixed power of two so the table never rehashes.
+package stationtable
+
+import (
+	"bytes"
+	"iter"
+)
+
+// the 1BRC rules allow up to 10,000 distinct stations, DefaultCapacity keeps
+// the load factor below ~0.6 for that
+const DefaultCapacity = 1 << 14
+
+// FNV-1a, 64 bit
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// Hash returns the FNV-1a hash of key, it is the hash SplitStation computes
+func Hash(key []byte) uint64 {
+	h := uint64(offset64)
+	for _, b := range key {
+		h ^= uint64(b)
+		h *= prime64
+	}
+	return h
+}
+
+// SplitStation scans record for separator and hashes the station on the way,
+// idx is the separator's index or -1 when it was not found
+func SplitStation(record []byte, separator byte) (station []byte, hash uint64, idx int) {
+	h := uint64(offset64)
+	for i, b := range record {
+		if b == separator {
+			return record[:i], h, i
+		}
+		h ^= uint64(b)
+		h *= prime64
+	}
+	return nil, h, -1
+}
+
+type entry[V any] struct {
+	hash  uint64
+	key   []byte // nil for an empty slot
+	value V
+}
+
+// Table maps station bytes to a V stored inline in the table's slots
+type Table[V any] struct {
+	entries []entry[V]
+	mask    uint64
+	len     int
+}
+
+// New returns a table with capacity rounded up to a power of two
+func New[V any](capacity int) *Table[V] {
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	return &Table[V]{entries: make([]entry[V], size), mask: uint64(size - 1)}
+}
+
+// Len returns the number of stations in the table
+func (t *Table[V]) Len() int {
+	return t.len
+}
+
+// Get returns the value of key, hash must be Hash(key)
+func (t *Table[V]) Get(key []byte, hash uint64) (*V, bool) {
+	for i, probes := hash&t.mask, 0; probes < len(t.entries); i, probes = (i+1)&t.mask, probes+1 {
+		e := &t.entries[i]
+		if e.key == nil {
+			return nil, false
+		}
+		if e.hash == hash && bytes.Equal(e.key, key) {
+			return &e.value, true
+		}
+	}
+	return nil, false
+}
+
+// GetOrInsert returns the value of key, inserting a zero V when the key is
+// new. The key is copied on insert so the caller's buffer can be reused.
+// It returns nil when the table is full.
+func (t *Table[V]) GetOrInsert(key []byte, hash uint64) (value *V, inserted bool) {
+	for i, probes := hash&t.mask, 0; probes < len(t.entries); i, probes = (i+1)&t.mask, probes+1 {
+		e := &t.entries[i]
+		if e.key == nil {
+			// an empty station still needs a non-nil key to mark the slot as used
+			e.key = append(make([]byte, 0, max(len(key), 1)), key...)
+			e.hash = hash
+			t.len++
+			return &e.value, true
+		}
+		if e.hash == hash && bytes.Equal(e.key, key) {
+			return &e.value, false
+		}
+	}
+	return nil, false
+}
+
+// All iterates over the stations in slot order, the key must not be modified
+func (t *Table[V]) All() iter.Seq2[[]byte, *V] {
+	return func(yield func([]byte, *V) bool) {
+		for i := range t.entries {
+			e := &t.entries[i]
+			if e.key == nil {
+				continue
+			}
+			if !yield(e.key, &e.value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package stationtable
+
+import (
+	"1brc-go/datagen"
+	"math/rand/v2"
+	"testing"
+)
+
+type measurements struct {
+	min   int
+	max   int
+	sum   int
+	count int
+}
+
+func TestSplitStation(t *testing.T) {
+	station, hash, idx := SplitStation([]byte("Hamburg;12.3"), ';')
+	if string(station) != "Hamburg" || idx != 7 {
+		t.Errorf("got station %q at %d, want Hamburg at 7", station, idx)
+	}
+	if hash != Hash([]byte("Hamburg")) {
+		t.Errorf("hash computed while scanning differs from Hash")
+	}
+
+	if _, _, idx := SplitStation([]byte("Hamburg12.3"), ';'); idx != -1 {
+		t.Errorf("got index %d for a record without separator, want -1", idx)
+	}
+}
+
+func TestTable_GetOrInsert(t *testing.T) {
+	table := New[measurements](16)
+
+	buf := []byte("Oslo")
+	m, inserted := table.GetOrInsert(buf, Hash(buf))
+	if !inserted {
+		t.Fatalf("expected Oslo to be inserted")
+	}
+	m.count++
+
+	// the key must be copied, reusing the caller's buffer must not change it
+	copy(buf, "Rome")
+
+	m, inserted = table.GetOrInsert([]byte("Oslo"), Hash([]byte("Oslo")))
+	if inserted || m.count != 1 {
+		t.Errorf("expected the existing Oslo entry, got inserted %v count %d", inserted, m.count)
+	}
+	if _, ok := table.Get([]byte("Rome"), Hash([]byte("Rome"))); ok {
+		t.Errorf("Rome was never inserted")
+	}
+	if table.Len() != 1 {
+		t.Errorf("got len %d, want 1", table.Len())
+	}
+}
+
+func TestTable_Collisions(t *testing.T) {
+	table := New[int](8)
+
+	// the same hash forces every key to probe
+	keys := []string{"a", "b", "c", ""}
+	for i, key := range keys {
+		v, _ := table.GetOrInsert([]byte(key), 42)
+		*v = i
+	}
+
+	for i, key := range keys {
+		v, ok := table.Get([]byte(key), 42)
+		if !ok || *v != i {
+			t.Errorf("key %q: got %v, %v, want %d", key, v, ok, i)
+		}
+	}
+}
+
+func TestTable_Full(t *testing.T) {
+	table := New[int](2)
+	table.GetOrInsert([]byte("a"), Hash([]byte("a")))
+	table.GetOrInsert([]byte("b"), Hash([]byte("b")))
+
+	if v, _ := table.GetOrInsert([]byte("c"), Hash([]byte("c"))); v != nil {
+		t.Errorf("expected nil from a full table")
+	}
+	if _, ok := table.Get([]byte("c"), Hash([]byte("c"))); ok {
+		t.Errorf("c is not in the table")
+	}
+}
+
+func TestTable_All(t *testing.T) {
+	table := New[int](DefaultCapacity)
+	for i, station := range datagen.DefaultStations {
+		key := []byte(station.Name)
+		v, _ := table.GetOrInsert(key, Hash(key))
+		*v = i
+	}
+
+	seen := 0
+	for key, v := range table.All() {
+		if datagen.DefaultStations[*v].Name != string(key) {
+			t.Errorf("key %q has value of %q", key, datagen.DefaultStations[*v].Name)
+		}
+		seen++
+	}
+	if seen != len(datagen.DefaultStations) {
+		t.Errorf("iterated %d stations, want %d", seen, len(datagen.DefaultStations))
+	}
+}
+
+// benchmarkRecords returns station keys in random order, like the stations
+// of consecutive records
+func benchmarkRecords(n int) [][]byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	records := make([][]byte, n)
+	for i := range records {
+		records[i] = []byte(datagen.DefaultStations[rng.IntN(len(datagen.DefaultStations))].Name + ";12.3")
+	}
+	return records
+}
+
+func BenchmarkLookup(b *testing.B) {
+	records := benchmarkRecords(1 << 16)
+
+	b.Run("map", func(b *testing.B) {
+		stations := make(map[string]*measurements)
+		for b.Loop() {
+			for _, record := range records {
+				idx := 0
+				for record[idx] != ';' {
+					idx++
+				}
+				m, ok := stations[string(record[:idx])]
+				if !ok {
+					m = &measurements{}
+					stations[string(record[:idx])] = m
+				}
+				m.count++
+			}
+		}
+	})
+
+	b.Run("stationtable", func(b *testing.B) {
+		stations := New[measurements](DefaultCapacity)
+		for b.Loop() {
+			for _, record := range records {
+				station, hash, _ := SplitStation(record, ';')
+				m, _ := stations.GetOrInsert(station, hash)
+				m.count++
+			}
+		}
+	})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"1brc-go/solver"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knobRange is the values a sweep takes for one solver specific knob
+type knobRange struct {
+	name   string
+	values []int
+}
+
+// knobRanges collects the repeated -knob flags of a sweep
+type knobRanges []knobRange
+
+func (k *knobRanges) String() string {
+	var parts []string
+	for _, r := range *k {
+		parts = append(parts, fmt.Sprintf("%s=%v", r.name, r.values))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (k *knobRanges) Set(value string) error {
+	name, values, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid knob range %q, expected name=values", value)
+	}
+	parsed, err := parseRange(values)
+	if err != nil {
+		return err
+	}
+	*k = append(*k, knobRange{name: name, values: parsed})
+	return nil
+}
+
+// sweepPoint is one combination of a sweep and its runs
+type sweepPoint struct {
+	workers    int
+	bufferSize int
+	// in the order of the -knob flags
+	knobs  []int
+	record benchRecord
+}
+
+func runSweep(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset: small, mid, full")
+	in := fs.String("in", "", "input path, overrides the dataset path")
+	impl := fs.String("impl", "base", "registered solver to run")
+	workerRange := fs.String("workers", "0", "worker counts, e.g. 10:60:10 or 8,16,32, 0 uses the solver default")
+	bufferRange := fs.String("buffer", "0", "buffer sizes, e.g. 1MiB:16MiB:x2 or 4MiB,8MiB, 0 uses the solver default")
+	var knobs knobRanges
+	fs.Var(&knobs, "knob", "solver specific knob values, e.g. section=4MiB:16MiB:x2, can be repeated")
+	runs := fs.Int("runs", 3, "number of measured runs per combination")
+	warmup := fs.Int("warmup", 1, "number of runs before the measured ones of every combination")
+	out := fs.String("out", "", "CSV file of the grid, defaults to stat/sweep_<impl>_<timestamp>.csv")
+	fs.Parse(args)
+
+	workerCounts, err := parseRange(*workerRange)
+	if err != nil {
+		return err
+	}
+	bufferSizes, err := parseRange(*bufferRange)
+	if err != nil {
+		return err
+	}
+	if *runs < 1 {
+		return fmt.Errorf("invalid number of runs: %d", *runs)
+	}
+
+	inputPath, _ := resolveFileSize(*size)
+	if *in != "" {
+		inputPath = *in
+	}
+	outputPath := *out
+	if outputPath == "" {
+		outputPath = fmt.Sprintf("stat/sweep_%s_%s.csv", *impl, time.Now().Format("20060102_150405"))
+	}
+
+	numPoints, err := countSweepPoints(workerCounts, bufferSizes, knobs)
+	if err != nil {
+		return err
+	}
+
+	// every combination is checked before the first run
+	points := make([]sweepPoint, 0, numPoints)
+	for _, workers := range workerCounts {
+		for _, bufferSize := range bufferSizes {
+			for _, values := range knobCombinations(knobs) {
+				points = append(points, sweepPoint{workers: workers, bufferSize: bufferSize, knobs: values})
+			}
+		}
+	}
+	solvers := make([]solver.Solver, len(points))
+	for i, point := range points {
+		solvers[i], err = solver.New(*impl, solver.Options{BufferSize: point.bufferSize, Workers: point.workers, Knobs: knobsOption(knobs, point.knobs)})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range points {
+		label := fmt.Sprintf("%d/%d", i+1, len(points))
+		points[i].record, err = benchSolver(solvers[i], label, inputPath, *warmup, *runs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", describePoint(points[i], knobs), err)
+		}
+	}
+
+	if err := writeSweep(outputPath, points, knobs); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printSweepHeatmaps(os.Stdout, points, knobs, workerCounts, bufferSizes)
+
+	best := bestPoint(points)
+	fmt.Printf("\n➜ best on %s (%s/%s, %d CPUs, GOMAXPROCS %d): %s, median %.3fs\n",
+		hostname(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.GOMAXPROCS(0), describePoint(best, knobs), median(best.record.Times))
+	fmt.Printf("➜ grid written to %s\n", outputPath)
+	return nil
+}
+
+// maxRangeValues caps the values of a -workers, -buffer or -knob range, every
+// combination is a full benchmark
+const maxRangeValues = 1000
+
+// parseRange parses comma separated values and start:end[:step] ranges, a
+// step of xN multiplies instead of adding. Values take the sizes of -buffer,
+// e.g. 1MiB:16MiB:x2 is 1, 2, 4, 8 and 16 MiB. Repeated values are dropped.
+func parseRange(value string) ([]int, error) {
+	var values []int
+	for part := range strings.SplitSeq(value, ",") {
+		bounds := strings.Split(part, ":")
+		if len(bounds) > 3 {
+			return nil, fmt.Errorf("invalid range %q, expected start:end[:step]", part)
+		}
+
+		start, err := parseByteSize(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(bounds) == 1 {
+			values = appendUnique(values, start)
+			continue
+		}
+
+		end, err := parseByteSize(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+
+		step, multiply := 1, false
+		if len(bounds) == 3 {
+			stepValue, isFactor := strings.CutPrefix(bounds[2], "x")
+			if step, err = parseByteSize(stepValue); err != nil {
+				return nil, err
+			}
+			multiply = isFactor
+		}
+		if step < 1 || multiply && (step < 2 || start < 1) {
+			return nil, fmt.Errorf("invalid range %q, the range would not end", part)
+		}
+
+		for v := start; v <= end; {
+			if len(values) == maxRangeValues {
+				return nil, fmt.Errorf("invalid range %q, more than %d values", part, maxRangeValues)
+			}
+			values = appendUnique(values, v)
+			// the next value would overflow, so it is past end too
+			if multiply && v > math.MaxInt/step || !multiply && v > math.MaxInt-step {
+				break
+			}
+			if multiply {
+				v *= step
+			} else {
+				v += step
+			}
+		}
+	}
+	return values, nil
+}
+
+// appendUnique appends v unless values already holds it, a value given twice
+// would be benchmarked twice but show up once in the heatmaps
+func appendUnique(values []int, v int) []int {
+	if slices.Contains(values, v) {
+		return values
+	}
+	return append(values, v)
+}
+
+// maxSweepPoints caps the combinations of a sweep, every one of them is a
+// full benchmark
+const maxSweepPoints = 1000
+
+// countSweepPoints returns the number of combinations of the worker counts,
+// buffer sizes and knob values, more than maxSweepPoints is an error
+func countSweepPoints(workerCounts []int, bufferSizes []int, knobs knobRanges) (int, error) {
+	// at most maxRangeValues each, so the products stay far from overflowing
+	count := len(workerCounts) * len(bufferSizes)
+	for _, knob := range knobs {
+		if count > maxSweepPoints {
+			break
+		}
+		count *= len(knob.values)
+	}
+	if count > maxSweepPoints {
+		return 0, fmt.Errorf("the sweep has more than %d combinations of workers, buffer sizes and knobs", maxSweepPoints)
+	}
+	return count, nil
+}
+
+// knobCombinations returns every combination of the knob values, a single
+// empty one without knobs
+func knobCombinations(knobs knobRanges) [][]int {
+	combinations := [][]int{nil}
+	for _, knob := range knobs {
+		var next [][]int
+		for _, combination := range combinations {
+			for _, value := range knob.values {
+				next = append(next, append(slices.Clone(combination), value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// knobsOption formats the knob values for solver.Options
+func knobsOption(knobs knobRanges, values []int) string {
+	var parts []string
+	for i, knob := range knobs {
+		parts = append(parts, fmt.Sprintf("%s=%d", knob.name, values[i]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func describePoint(point sweepPoint, knobs knobRanges) string {
+	parts := []string{"workers=" + formatSweepValue(point.workers, false), "buffer=" + formatSweepValue(point.bufferSize, true)}
+	for i, knob := range knobs {
+		parts = append(parts, fmt.Sprintf("%s=%d", knob.name, point.knobs[i]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatSweepValue prints a zero value as the solver default and sizes in
+// the largest unit dividing them
+func formatSweepValue(value int, isSize bool) string {
+	switch {
+	case value == 0:
+		return "default"
+	case isSize && value%(1024*1024) == 0:
+		return fmt.Sprintf("%dMiB", value/(1024*1024))
+	case isSize && value%1024 == 0:
+		return fmt.Sprintf("%dKiB", value/1024)
+	default:
+		return strconv.Itoa(value)
+	}
+}
+
+// bestPoint is the combination with the lowest median time
+func bestPoint(points []sweepPoint) sweepPoint {
+	return slices.MinFunc(points, func(a, b sweepPoint) int {
+		return cmpFloat(median(a.record.Times), median(b.record.Times))
+	})
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func writeSweep(path string, points []sweepPoint, knobs knobRanges) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create sweep directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	header := []string{"workers", "buffer_size"}
+	for _, knob := range knobs {
+		header = append(header, knob.name)
+	}
+	header = append(header, "runs", "median_exec_time", "min_exec_time", "avg_exec_time", "max_exec_time", "alloc_mb", "host", "gomaxprocs")
+	writer.Write(header)
+
+	host := hostname()
+	for _, point := range points {
+		times := point.record.Times
+		row := []string{strconv.Itoa(point.workers), strconv.Itoa(point.bufferSize)}
+		for _, value := range point.knobs {
+			row = append(row, strconv.Itoa(value))
+		}
+		row = append(row,
+			strconv.Itoa(len(times)),
+			fmt.Sprintf("%.3f", median(times)),
+			fmt.Sprintf("%.3f", slices.Min(times)),
+			fmt.Sprintf("%.3f", mean(times)),
+			fmt.Sprintf("%.3f", slices.Max(times)),
+			fmt.Sprintf("%.2f", point.record.AllocMB),
+			host,
+			strconv.Itoa(point.record.MaxProcs),
+		)
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// heatmapShades go from the fastest to the slowest median of a sweep
+var heatmapShades = []rune(" ░▒▓█")
+
+// printSweepHeatmaps prints the median times as a grid of workers by buffer
+// size, one grid per combination of the knobs. The shade of a cell places it
+// between the fastest and the slowest combination of the whole sweep, the
+// fastest is marked with *.
+func printSweepHeatmaps(w io.Writer, points []sweepPoint, knobs knobRanges, workerCounts []int, bufferSizes []int) {
+	fastest, slowest := median(points[0].record.Times), median(points[0].record.Times)
+	for _, point := range points {
+		fastest = min(fastest, median(point.record.Times))
+		slowest = max(slowest, median(point.record.Times))
+	}
+	best := bestPoint(points)
+
+	for _, combination := range knobCombinations(knobs) {
+		if len(knobs) > 0 {
+			fmt.Fprintf(w, "%s\n", knobsOption(knobs, combination))
+		}
+
+		fmt.Fprintf(w, "%8s", "workers")
+		for _, bufferSize := range bufferSizes {
+			fmt.Fprintf(w, " %10s", formatSweepValue(bufferSize, true))
+		}
+		fmt.Fprintln(w)
+
+		for _, workers := range workerCounts {
+			fmt.Fprintf(w, "%8s", formatSweepValue(workers, false))
+			for _, bufferSize := range bufferSizes {
+				i := slices.IndexFunc(points, func(p sweepPoint) bool {
+					return p.workers == workers && p.bufferSize == bufferSize && slices.Equal(p.knobs, combination)
+				})
+				point := points[i]
+				seconds := median(point.record.Times)
+
+				shade := 0
+				if slowest > fastest {
+					shade = int((seconds - fastest) / (slowest - fastest) * float64(len(heatmapShades)-1))
+				}
+				marker := ' '
+				if point.workers == best.workers && point.bufferSize == best.bufferSize && slices.Equal(point.knobs, best.knobs) {
+					marker = '*'
+				}
+				fmt.Fprintf(w, " %7.3fs%c%c", seconds, heatmapShades[shade], marker)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "fastest %.3fs '%c' .. '%c' %.3fs slowest, * best\n", fastest, heatmapShades[0], heatmapShades[len(heatmapShades)-1], slowest)
+}
+
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
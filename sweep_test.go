@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{input: "0", want: []int{0}},
+		{input: "8,16,32", want: []int{8, 16, 32}},
+		{input: "10:40:10", want: []int{10, 20, 30, 40}},
+		{input: "1:3", want: []int{1, 2, 3}},
+		{input: "1MiB:8MiB:x2", want: []int{1 << 20, 2 << 20, 4 << 20, 8 << 20}},
+		{input: "4,10:30:10", want: []int{4, 10, 20, 30}},
+		{input: "1:10:0", wantErr: true},
+		{input: "0:10:x2", wantErr: true},
+		{input: "1:2:3:4", wantErr: true},
+		{input: "many", wantErr: true},
+		{input: "1:1001", wantErr: true},
+		{input: "0,1:1000", wantErr: true},
+		{input: "8,8,16", want: []int{8, 16}},
+		{input: "4,1:3,2", want: []int{4, 1, 2, 3}},
+		{input: "1:9223372036854775807:x2", want: powersOfTwo(63)},
+		{input: "9223372036854775806:9223372036854775807", want: []int{math.MaxInt - 1, math.MaxInt}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRange(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRange(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseRange(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	if got, err := parseRange("1:1000"); err != nil || len(got) != maxRangeValues {
+		t.Errorf("got %d values, %v, want the %d values of the cap", len(got), err, maxRangeValues)
+	}
+}
+
+// powersOfTwo returns 1, 2, 4, ... up to 2^(n-1)
+func powersOfTwo(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = 1 << i
+	}
+	return values
+}
+
+func TestCountSweepPoints(t *testing.T) {
+	knobs := knobRanges{{name: "section", values: []int{1, 2, 3}}}
+	if got, err := countSweepPoints([]int{1, 2}, []int{0}, knobs); err != nil || got != 6 {
+		t.Errorf("got %d, %v, want 6 combinations", got, err)
+	}
+
+	values := make([]int, maxRangeValues)
+	many := knobRanges{{name: "section", values: values}, {name: "labels", values: values}}
+	if _, err := countSweepPoints(values, values, many); err == nil {
+		t.Errorf("expected an error for %d⁴ combinations", maxRangeValues)
+	}
+	if _, err := countSweepPoints(values, []int{0, 1}, nil); err == nil {
+		t.Errorf("expected an error for %d combinations", 2*maxRangeValues)
+	}
+}
+
+func TestKnobCombinations(t *testing.T) {
+	if got := knobCombinations(nil); len(got) != 1 || got[0] != nil {
+		t.Errorf("got %v, want a single empty combination", got)
+	}
+
+	knobs := knobRanges{{name: "section", values: []int{1, 2}}, {name: "batch", values: []int{3, 4, 5}}}
+	got := knobCombinations(knobs)
+	if len(got) != 6 || !slices.Equal(got[0], []int{1, 3}) || !slices.Equal(got[5], []int{2, 5}) {
+		t.Errorf("got %v, want the 6 combinations in flag order", got)
+	}
+	if option := knobsOption(knobs, got[4]); option != "section=2,batch=4" {
+		t.Errorf("got %q, want %q", option, "section=2,batch=4")
+	}
+}
+
+func testSweep() []sweepPoint {
+	var points []sweepPoint
+	for _, workers := range []int{1, 2} {
+		for _, bufferSize := range []int{1 << 20, 4 << 20} {
+			seconds := 1 / float64(workers) * float64(bufferSize>>20)
+			points = append(points, sweepPoint{workers: workers, bufferSize: bufferSize, record: benchRecord{Times: []float64{seconds, seconds + 0.5}, MaxProcs: 4}})
+		}
+	}
+	return points
+}
+
+func TestPrintSweepHeatmaps(t *testing.T) {
+	points := testSweep()
+
+	var buf bytes.Buffer
+	printSweepHeatmaps(&buf, points, nil, []int{1, 2}, []int{1 << 20, 4 << 20})
+
+	lines := strings.Split(buf.String(), "\n")
+	// the slowest cell is 1 worker with 4MiB, the fastest 2 workers with 1MiB
+	if !strings.Contains(lines[0], "1MiB") || !strings.Contains(lines[1], "4.250s█") || !strings.Contains(lines[2], "0.750s *") {
+		t.Errorf("unexpected heatmap:\n%s", buf.String())
+	}
+	if best := bestPoint(points); best.workers != 2 || best.bufferSize != 1<<20 {
+		t.Errorf("got best %+v, want 2 workers with 1MiB", best)
+	}
+}
+
+func TestWriteSweep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat", "sweep.csv")
+	knobs := knobRanges{{name: "section", values: []int{8}}}
+	points := testSweep()
+	for i := range points {
+		points[i].knobs = []int{8}
+	}
+
+	if err := writeSweep(path, points, knobs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "workers,buffer_size,section,runs,median_exec_time,") ||
+		!strings.HasPrefix(lines[1], "1,1048576,8,2,1.250,1.000,1.250,1.500,") {
+		t.Errorf("unexpected grid:\n%s", data)
+	}
+}
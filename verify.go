@@ -0,0 +1,108 @@
+package main
+
+import (
+	"1brc-go/oracle"
+	"1brc-go/solver"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset: small, mid, full")
+	in := fs.String("in", "", "input path, overrides the dataset path")
+	impl := fs.String("impl", "base", "implementation to verify")
+	fs.Parse(args)
+
+	s, err := solver.New(*impl, solver.Options{})
+	if err != nil {
+		return err
+	}
+
+	inputPath := *in
+	if inputPath == "" {
+		inputPath, _ = resolveFileSize(*size)
+	}
+
+	expected, err := computeReference(inputPath)
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.CreateTemp("", "1brc-verify-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary output: %w", err)
+	}
+	outputFile.Close()
+	defer os.Remove(outputFile.Name())
+
+	if err := s.Run(context.Background(), inputPath, outputFile.Name()); err != nil {
+		return fmt.Errorf("%s failed: %w", *impl, err)
+	}
+
+	output, err := os.ReadFile(outputFile.Name())
+	if err != nil {
+		return fmt.Errorf("failed to read %s output: %w", *impl, err)
+	}
+	actual, err := oracle.ParseCanonical(string(output))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s output: %w", *impl, err)
+	}
+
+	if mismatch := oracle.Compare(expected, actual); mismatch != nil {
+		return fmt.Errorf("%s does not match the reference: %w", *impl, mismatch)
+	}
+
+	fmt.Printf("➜ [%-15s] all %d stations match the reference\n", *impl, len(expected))
+	return nil
+}
+
+func runReference(args []string) error {
+	fs := flag.NewFlagSet("reference", flag.ExitOnError)
+	size := fs.String("f", "small", "dataset: small, mid, full")
+	in := fs.String("in", "", "input path, overrides the dataset path")
+	out := fs.String("out", "", "output path, defaults to the dataset's file in results/reference")
+	fs.Parse(args)
+
+	inputPath, outputPath := resolveFileSize(*size)
+	outputPath = filepath.Join("results", "reference", filepath.Base(outputPath))
+	if *in != "" {
+		inputPath = *in
+	}
+	if *out != "" {
+		outputPath = *out
+	}
+
+	results, err := computeReference(inputPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(outputPath, []byte(oracle.FormatCanonical(results)), 0666); err != nil {
+		return fmt.Errorf("failed to write reference output: %w", err)
+	}
+
+	fmt.Printf("➜ reference for %d stations written to %s\n", len(results), outputPath)
+	return nil
+}
+
+func computeReference(inputPath string) ([]oracle.Result, error) {
+	inputFile, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file at %s: %w", inputPath, err)
+	}
+	defer inputFile.Close()
+
+	results, err := oracle.Compute(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute reference for %s: %w", inputPath, err)
+	}
+
+	return results, nil
+}